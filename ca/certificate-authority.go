@@ -13,6 +13,7 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"sync"
 	"time"
 
 	"github.com/letsencrypt/boulder/core"
@@ -38,14 +39,24 @@ type Config struct {
 	// LifespanOCSP is how long OCSP responses are valid for; It should be longer
 	// than the minTimeToExpiry field for the OCSP Updater.
 	LifespanOCSP string
-	// How long issued certificates are valid for, should match expiry field
-	// in cfssl config.
+	// How long issued certificates are valid for. This takes precedence over
+	// the expiry field in the cfssl config.
 	Expiry string
 	// The maximum number of subjectAltNames in a single certificate
 	MaxNames int
-	CFSSL    cfsslConfig.Config
+	// What to do with a certificate that would outlive the shortest of the
+	// authorizations for its names: "clamp" its notAfter to that expiry, or
+	// "refuse" to issue it.  Defaults to "refuse".
+	AuthzExpiryPolicy string
+	CFSSL             cfsslConfig.Config
 }
 
+// Values for Config.AuthzExpiryPolicy
+const (
+	AuthzExpiryRefuse = "refuse"
+	AuthzExpiryClamp  = "clamp"
+)
+
 type KeyConfig struct {
 	File   string
 	PKCS11 PKCS11Config
@@ -73,6 +84,14 @@ type CertificateAuthorityImpl struct {
 	NotAfter       time.Time
 	MaxNames       int
 	MaxKeySize     int
+
+	// Shorten certificates that would outlive their authorizations, rather
+	// than refusing to issue them
+	ClampToAuthzExpiry bool
+
+	// The notAfter of each certificate is passed to the signer through its
+	// policy, so signing must be serialized
+	signMu sync.Mutex
 }
 
 // NewCertificateAuthorityImpl creates a CA that talks to a remote CFSSL
@@ -157,6 +176,14 @@ func NewCertificateAuthorityImpl(cadb core.CertificateAuthorityDatabase, config
 
 	ca.MaxNames = config.MaxNames
 
+	switch config.AuthzExpiryPolicy {
+	case "", AuthzExpiryRefuse:
+	case AuthzExpiryClamp:
+		ca.ClampToAuthzExpiry = true
+	default:
+		return nil, fmt.Errorf("Unknown authorization expiry policy %q", config.AuthzExpiryPolicy)
+	}
+
 	return ca, nil
 }
 
@@ -256,6 +283,43 @@ func (ca *CertificateAuthorityImpl) RevokeCertificate(serial string, reasonCode
 	return err
 }
 
+// policyWithNotAfter returns a copy of policy in which the profile the signer
+// will use for profileName has its notAfter fixed to the given time.
+func policyWithNotAfter(policy *cfsslConfig.Signing, profileName string, notAfter time.Time) *cfsslConfig.Signing {
+	if policy == nil {
+		return nil
+	}
+	fixed := *policy
+	// This mirrors how signer.Profile picks a profile
+	if policy.Profiles != nil && profileName != "" {
+		fixed.Profiles = make(map[string]*cfsslConfig.SigningProfile, len(policy.Profiles))
+		for name, profile := range policy.Profiles {
+			fixed.Profiles[name] = profile
+		}
+		if profile, ok := policy.Profiles[profileName]; ok {
+			withNotAfter := *profile
+			withNotAfter.NotAfter = notAfter
+			fixed.Profiles[profileName] = &withNotAfter
+		}
+	} else if policy.Default != nil {
+		withNotAfter := *policy.Default
+		withNotAfter.NotAfter = notAfter
+		fixed.Default = &withNotAfter
+	}
+	return &fixed
+}
+
+// sign has the signer issue a certificate that expires at notAfter.
+func (ca *CertificateAuthorityImpl) sign(req signer.SignRequest, notAfter time.Time) ([]byte, error) {
+	ca.signMu.Lock()
+	defer ca.signMu.Unlock()
+
+	policy := ca.Signer.Policy()
+	ca.Signer.SetPolicy(policyWithNotAfter(policy, req.Profile, notAfter))
+	defer ca.Signer.SetPolicy(policy)
+	return ca.Signer.Sign(req)
+}
+
 // IssueCertificate attempts to convert a CSR into a signed Certificate, while
 // enforcing all policies.
 func (ca *CertificateAuthorityImpl) IssueCertificate(csr x509.CertificateRequest, regID int64, earliestExpiry time.Time) (core.Certificate, error) {
@@ -263,13 +327,13 @@ func (ca *CertificateAuthorityImpl) IssueCertificate(csr x509.CertificateRequest
 	var err error
 	key, ok := csr.PublicKey.(crypto.PublicKey)
 	if !ok {
-		err = fmt.Errorf("Invalid public key in CSR.")
+		err = core.BadCSRError("Invalid public key in CSR.")
 		// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
 		ca.log.AuditErr(err)
 		return emptyCert, err
 	}
 	if err = core.GoodKey(key, ca.MaxKeySize); err != nil {
-		err = fmt.Errorf("Invalid public key in CSR: %s", err.Error())
+		err = core.BadCSRError(fmt.Sprintf("Invalid public key in CSR: %s", err.Error()))
 		// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
 		ca.log.AuditErr(err)
 		return emptyCert, err
@@ -286,7 +350,7 @@ func (ca *CertificateAuthorityImpl) IssueCertificate(csr x509.CertificateRequest
 	} else if len(hostNames) > 0 {
 		commonName = hostNames[0]
 	} else {
-		err = fmt.Errorf("Cannot issue a certificate without a hostname.")
+		err = core.BadCSRError("Cannot issue a certificate without a hostname.")
 		// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
 		ca.log.AuditErr(err)
 		return emptyCert, err
@@ -295,7 +359,7 @@ func (ca *CertificateAuthorityImpl) IssueCertificate(csr x509.CertificateRequest
 	// Collapse any duplicate names.  Note that this operation may re-order the names
 	hostNames = core.UniqueNames(hostNames)
 	if ca.MaxNames > 0 && len(hostNames) > ca.MaxNames {
-		err = fmt.Errorf("Certificate request has %d > %d names", len(hostNames), ca.MaxNames)
+		err = core.BadCSRError(fmt.Sprintf("Certificate request has %d > %d names", len(hostNames), ca.MaxNames))
 		ca.log.WarningErr(err)
 		return emptyCert, err
 	}
@@ -303,7 +367,7 @@ func (ca *CertificateAuthorityImpl) IssueCertificate(csr x509.CertificateRequest
 	// Verify that names are allowed by policy
 	identifier := core.AcmeIdentifier{Type: core.IdentifierDNS, Value: commonName}
 	if err = ca.PA.WillingToIssue(identifier); err != nil {
-		err = fmt.Errorf("Policy forbids issuing for name %s", commonName)
+		err = core.UnauthorizedError(fmt.Sprintf("Policy forbids issuing for name %s", commonName))
 		// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
 		ca.log.AuditErr(err)
 		return emptyCert, err
@@ -311,14 +375,28 @@ func (ca *CertificateAuthorityImpl) IssueCertificate(csr x509.CertificateRequest
 	for _, name := range hostNames {
 		identifier = core.AcmeIdentifier{Type: core.IdentifierDNS, Value: name}
 		if err = ca.PA.WillingToIssue(identifier); err != nil {
-			err = fmt.Errorf("Policy forbids issuing for name %s", name)
+			err = core.UnauthorizedError(fmt.Sprintf("Policy forbids issuing for name %s", name))
 			// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
 			ca.log.AuditErr(err)
 			return emptyCert, err
 		}
 	}
 
-	notAfter := time.Now().Add(ca.ValidityPeriod)
+	now := time.Now()
+	notAfter := now.Add(ca.ValidityPeriod)
+
+	// Don't sign anything the RA would have to throw away because it outlives
+	// the authorizations it was issued under
+	if earliestExpiry.Before(notAfter) {
+		if !ca.ClampToAuthzExpiry || !earliestExpiry.After(now) {
+			err = core.UnauthorizedError(fmt.Sprintf(
+				"Cannot issue a certificate that expires after the shortest underlying authorization. [%v] [%v]", earliestExpiry, notAfter))
+			// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+			ca.log.AuditErr(err)
+			return emptyCert, err
+		}
+		notAfter = earliestExpiry
+	}
 
 	if ca.NotAfter.Before(notAfter) {
 		// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
@@ -327,13 +405,6 @@ func (ca *CertificateAuthorityImpl) IssueCertificate(csr x509.CertificateRequest
 		return emptyCert, err
 	}
 
-	// Note: We do not current enforce that certificate lifetimes match
-	// authorization lifetimes, because it was breaking integration tests.
-	if earliestExpiry.Before(notAfter) {
-		message := fmt.Sprintf("Issuing a certificate that expires after the shortest underlying authorization. [%v] [%v]", earliestExpiry, notAfter)
-		ca.log.Notice(message)
-	}
-
 	// Convert the CSR to PEM
 	csrPEM := string(pem.EncodeToMemory(&pem.Block{
 		Type:  "CERTIFICATE REQUEST",
@@ -368,7 +439,7 @@ func (ca *CertificateAuthorityImpl) IssueCertificate(csr x509.CertificateRequest
 		SerialSeq: serialHex,
 	}
 
-	certPEM, err := ca.Signer.Sign(req)
+	certPEM, err := ca.sign(req, notAfter)
 	if err != nil {
 		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 		ca.log.Audit(fmt.Sprintf("Signer failed, rolling back: serial=[%s] err=[%v]", serialHex, err))
@@ -524,11 +524,19 @@ func TestRejectValidityTooLong(t *testing.T) {
 	ca.SA = storageAuthority
 	ca.MaxKeySize = 4096
 
-	// Test that the CA rejects CSRs that would expire after the intermediate cert
+	// Test that the CA rejects CSRs that would expire after the underlying
+	// authorizations, whether or not it may shorten certificates to fit
 	csrDER, _ := hex.DecodeString(NO_CN_CSR_HEX)
 	csr, _ := x509.ParseCertificateRequest(csrDER)
+	_, err = ca.IssueCertificate(*csr, 1, time.Now().Add(time.Hour))
+	_, ok := err.(core.UnauthorizedError)
+	test.Assert(t, ok, "Can issue a certificate that expires after the underlying authorization.")
+
+	ca.ClampToAuthzExpiry = true
 	_, err = ca.IssueCertificate(*csr, 1, FarPast)
-	test.Assert(t, err == nil, "Can issue a certificate that expires after the underlying authorization.")
+	_, ok = err.(core.UnauthorizedError)
+	test.Assert(t, ok, "Can issue a certificate under an expired authorization.")
+	ca.ClampToAuthzExpiry = false
 
 	// Test that the CA rejects CSRs that would expire after the intermediate cert
 	csrDER, _ = hex.DecodeString(NO_CN_CSR_HEX)
@@ -538,6 +546,37 @@ func TestRejectValidityTooLong(t *testing.T) {
 	test.AssertEquals(t, err.Error(), "Cannot issue a certificate that expires after the intermediate certificate.")
 }
 
+func TestAuthzExpiryPolicy(t *testing.T) {
+	cadb, _, caConfig := setup(t)
+	ca, err := NewCertificateAuthorityImpl(cadb, caConfig, caCertFile)
+	test.AssertNotError(t, err, "Failed to create CA")
+	test.Assert(t, !ca.ClampToAuthzExpiry, "CA clamps certificates by default")
+
+	caConfig.AuthzExpiryPolicy = AuthzExpiryClamp
+	ca, err = NewCertificateAuthorityImpl(cadb, caConfig, caCertFile)
+	test.AssertNotError(t, err, "Failed to create CA")
+	test.Assert(t, ca.ClampToAuthzExpiry, "CA doesn't clamp certificates")
+
+	caConfig.AuthzExpiryPolicy = "ignore"
+	_, err = NewCertificateAuthorityImpl(cadb, caConfig, caCertFile)
+	test.AssertError(t, err, "CA accepted an unknown authorization expiry policy")
+}
+
+func TestPolicyWithNotAfter(t *testing.T) {
+	_, _, caConfig := setup(t)
+	policy := caConfig.CFSSL.Signing
+	notAfter := time.Now().Add(time.Hour)
+
+	fixed := policyWithNotAfter(policy, profileName, notAfter)
+	test.AssertEquals(t, fixed.Profiles[profileName].NotAfter, notAfter)
+	test.Assert(t, policy.Profiles[profileName].NotAfter.IsZero(), "Original profile was modified")
+	test.Assert(t, fixed.Default == policy.Default, "Default profile was replaced")
+
+	fixed = policyWithNotAfter(policy, "", notAfter)
+	test.AssertEquals(t, fixed.Default.NotAfter, notAfter)
+	test.Assert(t, policy.Default.NotAfter.IsZero(), "Original default profile was modified")
+}
+
 func TestShortKey(t *testing.T) {
 	cadb, storageAuthority, caConfig := setup(t)
 	ca, err := NewCertificateAuthorityImpl(cadb, caConfig, caCertFile)
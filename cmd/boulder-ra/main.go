@@ -6,6 +6,8 @@
 package main
 
 import (
+	"time"
+
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/streadway/amqp"
 
@@ -34,6 +36,29 @@ func main() {
 		rai := ra.NewRegistrationAuthorityImpl()
 		rai.AuthzBase = c.Common.BaseURL + wfe.AuthzPath
 		rai.MaxKeySize = c.Common.MaxKeySize
+		rai.DNSResolver = cmd.NewDNSResolver(c, stats)
+		rai.SubscriberAgreementURL = c.SubscriberAgreementURL
+		if c.RA.AuthzReuseWindow != "" {
+			rai.AuthzReuseWindow, err = time.ParseDuration(c.RA.AuthzReuseWindow)
+			cmd.FailOnError(err, "Could not parse AuthzReuseWindow from config")
+		}
+		if c.RA.AuthorizationLifetime != "" {
+			rai.AuthorizationLifetime, err = time.ParseDuration(c.RA.AuthorizationLifetime)
+			cmd.FailOnError(err, "Could not parse AuthorizationLifetime from config")
+		}
+		if c.RA.PendingAuthorizationLifetime != "" {
+			rai.PendingAuthorizationLifetime, err = time.ParseDuration(c.RA.PendingAuthorizationLifetime)
+			cmd.FailOnError(err, "Could not parse PendingAuthorizationLifetime from config")
+		}
+		if c.RA.OrderLifetime != "" {
+			rai.OrderLifetime, err = time.ParseDuration(c.RA.OrderLifetime)
+			cmd.FailOnError(err, "Could not parse OrderLifetime from config")
+		}
+		if c.RA.OrderProcessingTimeout != "" {
+			rai.OrderProcessingTimeout, err = time.ParseDuration(c.RA.OrderProcessingTimeout)
+			cmd.FailOnError(err, "Could not parse OrderProcessingTimeout from config")
+		}
+		rai.RateLimits = c.RA.RateLimits
 
 		go cmd.ProfileCmd("RA", stats)
 
@@ -10,6 +10,7 @@ import (
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/streadway/amqp"
 
 	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
 	blog "github.com/letsencrypt/boulder/log"
 	"github.com/letsencrypt/boulder/rpc"
 	"github.com/letsencrypt/boulder/va"
@@ -33,6 +34,15 @@ func main() {
 		go cmd.ProfileCmd("VA", stats)
 
 		vai := va.NewValidationAuthorityImpl(c.CA.TestMode)
+		vai.DNSResolver = cmd.NewDNSResolver(c, stats)
+		vai.CAAIdentities = c.Common.CAAIdentities
+		if len(c.VA.BlockedNetworks) > 0 {
+			vai.BlockedNetworks, err = core.ParseNetworks(c.VA.BlockedNetworks)
+			cmd.FailOnError(err, "Couldn't parse blocked networks")
+		}
+		vai.Validation = c.VA.Validation
+		vai.Stats = stats
+		vai.Start()
 
 		for {
 			ch := cmd.AmqpChannel(c.AMQP.Server)
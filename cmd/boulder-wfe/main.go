@@ -6,7 +6,9 @@
 package main
 
 import (
+	"encoding/hex"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"time"
 
@@ -14,6 +16,7 @@ import (
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/streadway/amqp"
 
 	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
 	blog "github.com/letsencrypt/boulder/log"
 	"github.com/letsencrypt/boulder/rpc"
 	"github.com/letsencrypt/boulder/wfe"
@@ -84,15 +87,27 @@ func main() {
 
 		blog.SetAuditLogger(auditlogger)
 
-		wfe := wfe.NewWebFrontEndImpl()
+		nonceKey, err := hex.DecodeString(c.WFE.NonceKey)
+		cmd.FailOnError(err, "Couldn't parse nonce key")
+		wfe, err := wfe.NewWebFrontEndImpl(nonceKey)
+		cmd.FailOnError(err, "Unable to create WFE")
 		rac, sac, closeChan := setupWFE(c)
 		wfe.RA = &rac
 		wfe.SA = &sac
 		wfe.Stats = stats
 		wfe.SubscriberAgreementURL = c.SubscriberAgreementURL
+		wfe.CAAIdentities = c.Common.CAAIdentities
+		wfe.TrustedProxies, err = core.ParseNetworks(c.WFE.TrustedProxies)
+		cmd.FailOnError(err, "Couldn't parse trusted proxies")
+		if c.WFE.SubscriberAgreement != "" {
+			wfe.SubscriberAgreement, err = ioutil.ReadFile(c.WFE.SubscriberAgreement)
+			cmd.FailOnError(err, fmt.Sprintf("Couldn't read subscriber agreement [%s]", c.WFE.SubscriberAgreement))
+		}
 
 		wfe.IssuerCert, err = cmd.LoadCert(c.Common.IssuerCert)
 		cmd.FailOnError(err, fmt.Sprintf("Couldn't read issuer cert [%s]", c.Common.IssuerCert))
+		wfe.IssuerChain, err = cmd.LoadCertChain(c.WFE.IssuerChain)
+		cmd.FailOnError(err, fmt.Sprintf("Couldn't read issuer chain %v", c.WFE.IssuerChain))
 
 		go cmd.ProfileCmd("WFE", stats)
 
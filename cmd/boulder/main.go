@@ -6,7 +6,9 @@
 package main
 
 import (
+	"encoding/hex"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"time"
@@ -15,6 +17,7 @@ import (
 
 	"github.com/letsencrypt/boulder/ca"
 	"github.com/letsencrypt/boulder/cmd"
+	"github.com/letsencrypt/boulder/core"
 	blog "github.com/letsencrypt/boulder/log"
 	"github.com/letsencrypt/boulder/ra"
 	"github.com/letsencrypt/boulder/sa"
@@ -72,14 +75,28 @@ func main() {
 		go cmd.ProfileCmd("Monolith", stats)
 
 		// Create the components
-		wfei := wfe.NewWebFrontEndImpl()
+		nonceKey, err := hex.DecodeString(c.WFE.NonceKey)
+		cmd.FailOnError(err, "Couldn't parse nonce key")
+		wfei, err := wfe.NewWebFrontEndImpl(nonceKey)
+		cmd.FailOnError(err, "Unable to create WFE")
 		sa, err := sa.NewSQLStorageAuthority(c.SA.DBDriver, c.SA.DBName)
 		cmd.FailOnError(err, "Unable to create SA")
 		sa.SetSQLDebug(c.SQL.SQLDebug)
 
-		ra := ra.NewRegistrationAuthorityImpl()
+		dnsResolver := cmd.NewDNSResolver(c, stats)
 
-		va := va.NewValidationAuthorityImpl(c.CA.TestMode)
+		ra := ra.NewRegistrationAuthorityImpl()
+		ra.DNSResolver = dnsResolver
+
+		vai := va.NewValidationAuthorityImpl(c.CA.TestMode)
+		vai.DNSResolver = dnsResolver
+		vai.CAAIdentities = c.Common.CAAIdentities
+		if len(c.VA.BlockedNetworks) > 0 {
+			vai.BlockedNetworks, err = core.ParseNetworks(c.VA.BlockedNetworks)
+			cmd.FailOnError(err, "Couldn't parse blocked networks")
+		}
+		vai.Validation = c.VA.Validation
+		vai.Stats = stats
 
 		cadb, err := ca.NewCertificateAuthorityDatabaseImpl(c.CA.DBDriver, c.CA.DBName)
 		cmd.FailOnError(err, "Failed to create CA database")
@@ -100,14 +117,24 @@ func main() {
 		wfei.SA = sa
 		wfei.Stats = stats
 		wfei.SubscriberAgreementURL = c.SubscriberAgreementURL
+		if c.WFE.SubscriberAgreement != "" {
+			wfei.SubscriberAgreement, err = ioutil.ReadFile(c.WFE.SubscriberAgreement)
+			cmd.FailOnError(err, fmt.Sprintf("Couldn't read subscriber agreement [%s]", c.WFE.SubscriberAgreement))
+		}
+		wfei.CAAIdentities = c.Common.CAAIdentities
+		wfei.TrustedProxies, err = core.ParseNetworks(c.WFE.TrustedProxies)
+		cmd.FailOnError(err, "Couldn't parse trusted proxies")
 
 		wfei.IssuerCert, err = cmd.LoadCert(c.Common.IssuerCert)
 		cmd.FailOnError(err, fmt.Sprintf("Couldn't read issuer cert [%s]", c.Common.IssuerCert))
+		wfei.IssuerChain, err = cmd.LoadCertChain(c.WFE.IssuerChain)
+		cmd.FailOnError(err, fmt.Sprintf("Couldn't read issuer chain %v", c.WFE.IssuerChain))
 
 		ra.CA = ca
 		ra.SA = sa
-		ra.VA = &va
-		va.RA = &ra
+		ra.VA = &vai
+		vai.RA = &ra
+		vai.Start()
 		ca.SA = sa
 
 		// Set up paths
@@ -116,6 +143,28 @@ func main() {
 		wfei.HandlePaths()
 
 		ra.MaxKeySize = c.Common.MaxKeySize
+		ra.SubscriberAgreementURL = c.SubscriberAgreementURL
+		if c.RA.AuthzReuseWindow != "" {
+			ra.AuthzReuseWindow, err = time.ParseDuration(c.RA.AuthzReuseWindow)
+			cmd.FailOnError(err, "Could not parse AuthzReuseWindow from config")
+		}
+		if c.RA.AuthorizationLifetime != "" {
+			ra.AuthorizationLifetime, err = time.ParseDuration(c.RA.AuthorizationLifetime)
+			cmd.FailOnError(err, "Could not parse AuthorizationLifetime from config")
+		}
+		if c.RA.PendingAuthorizationLifetime != "" {
+			ra.PendingAuthorizationLifetime, err = time.ParseDuration(c.RA.PendingAuthorizationLifetime)
+			cmd.FailOnError(err, "Could not parse PendingAuthorizationLifetime from config")
+		}
+		if c.RA.OrderLifetime != "" {
+			ra.OrderLifetime, err = time.ParseDuration(c.RA.OrderLifetime)
+			cmd.FailOnError(err, "Could not parse OrderLifetime from config")
+		}
+		if c.RA.OrderProcessingTimeout != "" {
+			ra.OrderProcessingTimeout, err = time.ParseDuration(c.RA.OrderProcessingTimeout)
+			cmd.FailOnError(err, "Could not parse OrderProcessingTimeout from config")
+		}
+		ra.RateLimits = c.RA.RateLimits
 		ca.MaxKeySize = c.Common.MaxKeySize
 
 		auditlogger.Info(app.VersionString())
@@ -40,7 +40,9 @@ import (
 	"github.com/letsencrypt/boulder/ca"
 	"github.com/letsencrypt/boulder/core"
 	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/ra"
 	"github.com/letsencrypt/boulder/rpc"
+	"github.com/letsencrypt/boulder/va"
 )
 
 // Config stores configuration parameters that applications
@@ -62,6 +64,54 @@ type Config struct {
 	WFE struct {
 		BaseURL       string
 		ListenAddress string
+		// Paths to PEM-encoded copies of any certificates above the issuer,
+		// in order, for clients that ask for the full chain.
+		IssuerChain []string
+		// Path to a copy of the current subscriber agreement, served to
+		// clients at /terms
+		SubscriberAgreement string
+		// Addresses of the proxies in front of the WFE, in CIDR notation,
+		// whose X-Real-IP header gives the client's address.  The header is
+		// ignored if this is empty.
+		TrustedProxies []string
+		// Hex-encoded 16, 24 or 32 byte AES key that anti-replay nonces are
+		// encrypted under.  Every WFE behind the same load balancer must be
+		// given the same key, or a nonce issued by one will be rejected by
+		// the others.  If empty, each WFE makes a random key of its own when
+		// it starts, which only works for a single WFE.
+		NonceKey string
+	}
+
+	RA struct {
+		// How long an existing authorization must remain valid for new-authz
+		// to hand it back instead of creating a new one, e.g. "720h".  Leave
+		// empty to always create new authorizations.
+		AuthzReuseWindow string
+
+		// How long valid and pending authorizations last, e.g. "720h".  Leave
+		// empty for the RA's defaults.
+		AuthorizationLifetime        string
+		PendingAuthorizationLifetime string
+
+		// How long clients have to finalize orders, and how long an order can
+		// be left processing before it may be finalized again, e.g. "168h".
+		// Leave empty for the RA's defaults.
+		OrderLifetime          string
+		OrderProcessingTimeout string
+
+		// Limits on certificate issuance; policies left out are disabled
+		RateLimits ra.RateLimitConfig
+	}
+
+	VA struct {
+		// Address ranges the VA won't connect to when validating, in CIDR
+		// notation.  Leave empty for va.DefaultBlockedNetworks.
+		BlockedNetworks []string
+
+		// Limits on concurrent validations, retries and timeouts, and the
+		// ports and schemes to validate on; anything left out gets the VA's
+		// defaults
+		Validation va.ValidationConfig
 	}
 
 	CA ca.Config
@@ -118,6 +168,17 @@ type Config struct {
 		// Path to a PEM-encoded copy of the issuer certificate.
 		IssuerCert string
 		MaxKeySize int
+
+		// Domain names identifying this CA in CAA issue records, checked by
+		// the VA before issuance and advertised to clients in the directory
+		CAAIdentities []string
+
+		// Recursive resolvers the RA and VA send their DNS queries to, e.g.
+		// "8.8.8.8:53", with how long to wait for each attempt, e.g. "5s",
+		// and how many times to retry queries that time out
+		DNSResolvers []string
+		DNSTimeout   string
+		DNSRetries   int
 	}
 
 	SubscriberAgreementURL string
@@ -182,6 +243,14 @@ func (as *AppShell) VersionString() string {
 	return fmt.Sprintf("%s (build %s)", as.App.Name, core.GetBuildID())
 }
 
+// NewDNSResolver creates the resolver described by the Common section of the
+// configuration.
+func NewDNSResolver(c Config, stats statsd.Statter) *core.DNSResolverImpl {
+	timeout, err := time.ParseDuration(c.Common.DNSTimeout)
+	FailOnError(err, "Couldn't parse DNS timeout")
+	return core.NewDNSResolverImpl(c.Common.DNSResolvers, timeout, c.Common.DNSRetries, stats)
+}
+
 // FailOnError exits and prints an error message if we encountered a problem
 func FailOnError(err error, msg string) {
 	if err != nil {
@@ -262,3 +331,17 @@ func LoadCert(path string) (cert []byte, err error) {
 	cert = block.Bytes
 	return
 }
+
+// LoadCertChain loads each of the PEM-encoded certificates at the given paths,
+// in order.
+func LoadCertChain(paths []string) (chain [][]byte, err error) {
+	for _, path := range paths {
+		var cert []byte
+		cert, err = LoadCert(path)
+		if err != nil {
+			return
+		}
+		chain = append(chain, cert)
+	}
+	return
+}
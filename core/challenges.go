@@ -19,6 +19,30 @@ func SimpleHTTPSChallenge() Challenge {
 	}
 }
 
+func HTTP01Challenge() Challenge {
+	return Challenge{
+		Type:   ChallengeTypeHTTP01,
+		Status: StatusPending,
+		Token:  NewToken(),
+	}
+}
+
+func TLSALPN01Challenge() Challenge {
+	return Challenge{
+		Type:   ChallengeTypeTLSALPN01,
+		Status: StatusPending,
+		Token:  NewToken(),
+	}
+}
+
+func DNSChallenge() Challenge {
+	return Challenge{
+		Type:   ChallengeTypeDNS,
+		Status: StatusPending,
+		Token:  NewToken(),
+	}
+}
+
 func DvsniChallenge() Challenge {
 	nonce := make([]byte, 16)
 	_, err := rand.Read(nonce)
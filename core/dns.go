@@ -0,0 +1,474 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+)
+
+// DNS record types we look up
+const (
+	dnsTypeA     = 1
+	dnsTypeCNAME = 5
+	dnsTypeMX    = 15
+	dnsTypeTXT   = 16
+	dnsTypeAAAA  = 28
+	dnsTypeCAA   = 257
+	dnsClassINET = 1
+)
+
+var dnsTypeNames = map[uint16]string{
+	dnsTypeA:    "A",
+	dnsTypeMX:   "MX",
+	dnsTypeTXT:  "TXT",
+	dnsTypeAAAA: "AAAA",
+	dnsTypeCAA:  "CAA",
+}
+
+// DNS response codes we distinguish
+const (
+	dnsRcodeSuccess  = 0
+	dnsRcodeServFail = 2
+	dnsRcodeNXDomain = 3
+)
+
+// CAA is a single CAA resource record (RFC 6844).
+type CAA struct {
+	Flag  uint8
+	Tag   string
+	Value string
+}
+
+// Critical reports whether the issuer critical flag is set.
+func (caa CAA) Critical() bool {
+	return caa.Flag&0x80 != 0
+}
+
+// DNSResolverImpl looks up records by asking a configured recursive resolver,
+// over UDP and falling back to TCP for truncated responses.
+type DNSResolverImpl struct {
+	// Addresses of the recursive resolvers, e.g. "127.0.0.1:53", tried in
+	// turn as queries are retried
+	Servers []string
+
+	// How long to wait for each attempt at a query
+	Timeout time.Duration
+
+	// How many times to retry a query that timed out or failed temporarily
+	Retries int
+
+	stats statsd.Statter
+}
+
+// NewDNSResolverImpl creates a resolver that asks the given servers,
+// reporting query counts and latencies to stats.
+func NewDNSResolverImpl(servers []string, timeout time.Duration, retries int, stats statsd.Statter) *DNSResolverImpl {
+	return &DNSResolverImpl{
+		Servers: servers,
+		Timeout: timeout,
+		Retries: retries,
+		stats:   stats,
+	}
+}
+
+// LookupHost returns the IPv4 and IPv6 addresses of hostname.
+func (dnsResolver *DNSResolverImpl) LookupHost(hostname string) (addrs []net.IP, rtt time.Duration, err error) {
+	for _, qtype := range []uint16{dnsTypeA, dnsTypeAAAA} {
+		msg, rrs, queryRTT, err := dnsResolver.lookup(hostname, qtype)
+		rtt += queryRTT
+		if err != nil {
+			return nil, rtt, err
+		}
+		for _, rr := range rrs {
+			rdata := rr.data(msg)
+			if len(rdata) == net.IPv4len || len(rdata) == net.IPv6len {
+				addrs = append(addrs, net.IP(rdata))
+			}
+		}
+	}
+	return
+}
+
+// LookupTXT returns the contents of the TXT records at hostname, with the
+// strings making up each record joined together.
+func (dnsResolver *DNSResolverImpl) LookupTXT(hostname string) (txts []string, rtt time.Duration, err error) {
+	msg, rrs, rtt, err := dnsResolver.lookup(hostname, dnsTypeTXT)
+	if err != nil {
+		return
+	}
+	for _, rr := range rrs {
+		rdata := rr.data(msg)
+		var txt []byte
+		for len(rdata) > 0 {
+			length := int(rdata[0])
+			if 1+length > len(rdata) {
+				return nil, rtt, &net.DNSError{Err: "malformed TXT record", Name: hostname}
+			}
+			txt = append(txt, rdata[1:1+length]...)
+			rdata = rdata[1+length:]
+		}
+		txts = append(txts, string(txt))
+	}
+	return
+}
+
+// LookupMX returns the hosts named in the MX records for domain.
+func (dnsResolver *DNSResolverImpl) LookupMX(domain string) (hosts []string, rtt time.Duration, err error) {
+	msg, rrs, rtt, err := dnsResolver.lookup(domain, dnsTypeMX)
+	if err != nil {
+		return
+	}
+	for _, rr := range rrs {
+		// Skip the preference
+		host, err := readDNSName(msg, rr.offset+2)
+		if err != nil {
+			return nil, rtt, &net.DNSError{Err: err.Error(), Name: domain}
+		}
+		hosts = append(hosts, host)
+	}
+	return
+}
+
+// LookupCAA returns the CAA records at domain itself.  A domain that doesn't
+// exist has no CAA records rather than being an error.
+func (dnsResolver *DNSResolverImpl) LookupCAA(domain string) (caas []*CAA, rtt time.Duration, err error) {
+	msg, rrs, rtt, err := dnsResolver.lookup(domain, dnsTypeCAA)
+	if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+		return nil, rtt, nil
+	}
+	if err != nil {
+		return
+	}
+	for _, rr := range rrs {
+		rdata := rr.data(msg)
+		if len(rdata) < 2 || len(rdata) < 2+int(rdata[1]) {
+			return nil, rtt, &net.DNSError{Err: "malformed CAA record", Name: domain}
+		}
+		tagEnd := 2 + int(rdata[1])
+		caas = append(caas, &CAA{
+			Flag:  rdata[0],
+			Tag:   string(rdata[2:tagEnd]),
+			Value: string(rdata[tagEnd:]),
+		})
+	}
+	return
+}
+
+// lookup asks each server in turn for the records of type qtype at name
+// until one answers, the query fails for good or we run out of retries.
+// It returns the response and where in it the records of that type are.
+func (dnsResolver *DNSResolverImpl) lookup(name string, qtype uint16) (msg []byte, rrs []dnsRR, rtt time.Duration, err error) {
+	if len(dnsResolver.Servers) == 0 {
+		return nil, nil, 0, errors.New("No DNS resolvers configured")
+	}
+	typeName := dnsTypeNames[qtype]
+
+	start := time.Now()
+	for attempt := 0; attempt <= dnsResolver.Retries; attempt++ {
+		if attempt > 0 {
+			dnsResolver.stats.Inc("DNS.Retries."+typeName, 1, 1.0)
+		}
+		server := dnsResolver.Servers[attempt%len(dnsResolver.Servers)]
+		msg, rrs, err = dnsResolver.exchange(server, name, qtype)
+		if err == nil || !temporaryDNSError(err) {
+			break
+		}
+	}
+	rtt = time.Since(start)
+
+	dnsResolver.stats.Inc("DNS.Queries."+typeName, 1, 1.0)
+	dnsResolver.stats.TimingDuration("DNS.Latency."+typeName, rtt, 1.0)
+	if err != nil {
+		dnsResolver.stats.Inc("DNS.Errors."+typeName, 1, 1.0)
+	}
+	return
+}
+
+// temporaryDNSError reports whether a query that failed with err is worth
+// retrying.
+func temporaryDNSError(err error) bool {
+	if dnsErr, ok := err.(*net.DNSError); ok {
+		return dnsErr.IsTimeout || dnsErr.IsTemporary
+	}
+	return false
+}
+
+// exchange sends a single query for name and qtype to server.  Errors are
+// reported as *net.DNSError, like the standard library's lookups.
+func (dnsResolver *DNSResolverImpl) exchange(server, name string, qtype uint16) ([]byte, []dnsRR, error) {
+	name = strings.TrimSuffix(name, ".")
+	query, id, err := buildDNSQuery(name, qtype)
+	if err != nil {
+		return nil, nil, &net.DNSError{Err: err.Error(), Name: name, Server: server}
+	}
+
+	msg, err := dnsResolver.exchangeOver("udp", server, query, id)
+	if err == nil && msg[2]&0x02 != 0 {
+		// Truncated, so ask again over TCP
+		msg, err = dnsResolver.exchangeOver("tcp", server, query, id)
+	}
+	if err != nil {
+		dnsErr := &net.DNSError{Err: err.Error(), Name: name, Server: server}
+		if netErr, ok := err.(net.Error); ok {
+			dnsErr.IsTimeout = netErr.Timeout()
+		}
+		return nil, nil, dnsErr
+	}
+
+	rcode, rrs, err := parseDNSResponse(msg, name, qtype)
+	if err != nil {
+		return nil, nil, &net.DNSError{Err: err.Error(), Name: name, Server: server}
+	}
+	switch rcode {
+	case dnsRcodeSuccess:
+		return msg, rrs, nil
+	case dnsRcodeNXDomain:
+		return nil, nil, &net.DNSError{Err: "no such host", Name: name, Server: server, IsNotFound: true}
+	default:
+		return nil, nil, &net.DNSError{
+			Err:         fmt.Sprintf("server returned rcode %d", rcode),
+			Name:        name,
+			Server:      server,
+			IsTemporary: rcode == dnsRcodeServFail,
+		}
+	}
+}
+
+// exchangeOver sends query to server over the given network and reads back
+// the response with a matching ID.
+func (dnsResolver *DNSResolverImpl) exchangeOver(network, server string, query []byte, id uint16) ([]byte, error) {
+	conn, err := net.DialTimeout(network, server, dnsResolver.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(dnsResolver.Timeout))
+
+	if network == "tcp" {
+		// Messages over TCP are prefixed with their length
+		framed := make([]byte, 2+len(query))
+		binary.BigEndian.PutUint16(framed, uint16(len(query)))
+		copy(framed[2:], query)
+		if _, err = conn.Write(framed); err != nil {
+			return nil, err
+		}
+		var length [2]byte
+		if _, err = io.ReadFull(conn, length[:]); err != nil {
+			return nil, err
+		}
+		msg := make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err = io.ReadFull(conn, msg); err != nil {
+			return nil, err
+		}
+		if len(msg) < 12 || binary.BigEndian.Uint16(msg) != id {
+			return nil, errors.New("DNS response doesn't match query")
+		}
+		return msg, nil
+	}
+
+	if _, err = conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 65535)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		// Ignore stray responses to other queries
+		if n >= 12 && binary.BigEndian.Uint16(buf) == id {
+			return buf[:n], nil
+		}
+	}
+}
+
+// buildDNSQuery returns a recursive query for name and qtype, and its ID.
+func buildDNSQuery(name string, qtype uint16) ([]byte, uint16, error) {
+	var idBytes [2]byte
+	if _, err := rand.Read(idBytes[:]); err != nil {
+		return nil, 0, err
+	}
+
+	query := []byte{
+		idBytes[0], idBytes[1],
+		0x01, 0x00, // Recursion desired
+		0, 1, // One question
+		0, 0, 0, 0, 0, 0,
+	}
+	for _, label := range strings.Split(name, ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return nil, 0, fmt.Errorf("invalid name %s", name)
+		}
+		query = append(query, byte(len(label)))
+		query = append(query, label...)
+	}
+	query = append(query, 0, byte(qtype>>8), byte(qtype), 0, dnsClassINET)
+	return query, binary.BigEndian.Uint16(idBytes[:]), nil
+}
+
+// A dnsRR locates the data of a resource record within a DNS message.
+type dnsRR struct {
+	offset int
+	length int
+}
+
+func (rr dnsRR) data(msg []byte) []byte {
+	return msg[rr.offset : rr.offset+rr.length]
+}
+
+// maxCNAMEs bounds how long a CNAME chain parseDNSResponse will follow.
+const maxCNAMEs = 8
+
+// parseDNSResponse returns the response code of msg and the answers of type
+// qtype for name.  The response has to be to the question we asked, and
+// only answers owned by name, or by the names a CNAME chain from name leads
+// to, are taken; anything else in the answer section is ignored.
+func parseDNSResponse(msg []byte, name string, qtype uint16) (rcode int, rrs []dnsRR, err error) {
+	if msg[2]&0x80 == 0 {
+		return 0, nil, errors.New("DNS message isn't a response")
+	}
+	rcode = int(msg[3] & 0x0f)
+	questions := int(binary.BigEndian.Uint16(msg[4:]))
+	answers := int(binary.BigEndian.Uint16(msg[6:]))
+
+	if questions != 1 {
+		return 0, nil, errors.New("DNS response doesn't have exactly one question")
+	}
+	question, err := readDNSName(msg, 12)
+	if err != nil {
+		return
+	}
+	offset, err := skipDNSName(msg, 12)
+	if err != nil {
+		return
+	}
+	if offset+4 > len(msg) {
+		return 0, nil, errors.New("DNS question runs past end of message")
+	}
+	if !strings.EqualFold(question, name+".") ||
+		binary.BigEndian.Uint16(msg[offset:]) != qtype ||
+		binary.BigEndian.Uint16(msg[offset+2:]) != dnsClassINET {
+		return 0, nil, errors.New("DNS response doesn't match query")
+	}
+	offset += 4
+
+	type answer struct {
+		owner  string
+		rrType uint16
+		rr     dnsRR
+	}
+	var all []answer
+	for i := 0; i < answers; i++ {
+		var owner string
+		if owner, err = readDNSName(msg, offset); err != nil {
+			return
+		}
+		if offset, err = skipDNSName(msg, offset); err != nil {
+			return
+		}
+		if offset+10 > len(msg) {
+			return 0, nil, errors.New("DNS answer runs past end of message")
+		}
+		rrType := binary.BigEndian.Uint16(msg[offset:])
+		length := int(binary.BigEndian.Uint16(msg[offset+8:]))
+		offset += 10
+		if offset+length > len(msg) {
+			return 0, nil, errors.New("DNS answer runs past end of message")
+		}
+		all = append(all, answer{owner, rrType, dnsRR{offset: offset, length: length}})
+		offset += length
+	}
+
+	// Follow the CNAME chain from the name we asked about
+	owners := []string{question}
+	for hops := 0; ; hops++ {
+		target := ""
+		for _, a := range all {
+			if a.rrType == dnsTypeCNAME && strings.EqualFold(a.owner, owners[len(owners)-1]) {
+				if target, err = readDNSName(msg, a.rr.offset); err != nil {
+					return
+				}
+				break
+			}
+		}
+		if target == "" {
+			break
+		}
+		if hops == maxCNAMEs {
+			return 0, nil, errors.New("DNS response has too long a CNAME chain")
+		}
+		owners = append(owners, target)
+	}
+
+	for _, a := range all {
+		if a.rrType != qtype {
+			continue
+		}
+		for _, owner := range owners {
+			if strings.EqualFold(a.owner, owner) {
+				rrs = append(rrs, a.rr)
+				break
+			}
+		}
+	}
+	return
+}
+
+// skipDNSName returns the offset just past the name starting at offset.
+func skipDNSName(msg []byte, offset int) (int, error) {
+	for offset < len(msg) {
+		length := int(msg[offset])
+		switch {
+		case length == 0:
+			return offset + 1, nil
+		case length&0xc0 == 0xc0:
+			return offset + 2, nil
+		default:
+			offset += 1 + length
+		}
+	}
+	return 0, errors.New("DNS name runs past end of message")
+}
+
+// readDNSName decodes the name starting at offset, following compression
+// pointers (RFC 1035 section 4.1.4).
+func readDNSName(msg []byte, offset int) (string, error) {
+	var labels []string
+	// Every pointer must lead further back, which rules out loops
+	limit := offset
+	for offset < len(msg) {
+		length := int(msg[offset])
+		switch {
+		case length == 0:
+			return strings.Join(labels, ".") + ".", nil
+		case length&0xc0 == 0xc0:
+			if offset+1 >= len(msg) {
+				return "", errors.New("DNS name runs past end of message")
+			}
+			pointer := int(binary.BigEndian.Uint16(msg[offset:]) & 0x3fff)
+			if pointer >= limit {
+				return "", errors.New("DNS name compression pointer doesn't point backwards")
+			}
+			offset, limit = pointer, pointer
+		default:
+			if offset+1+length > len(msg) {
+				return "", errors.New("DNS name runs past end of message")
+			}
+			labels = append(labels, string(msg[offset+1:offset+1+length]))
+			offset += 1 + length
+		}
+	}
+	return "", errors.New("DNS name runs past end of message")
+}
@@ -0,0 +1,307 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package core
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
+	"github.com/letsencrypt/boulder/test"
+)
+
+type stubRR struct {
+	rrType uint16
+	data   []byte
+}
+
+// Records served by the stub DNS server, by name and then type
+var stubRecords = map[string][]stubRR{
+	"example.test": []stubRR{
+		{dnsTypeA, []byte{127, 0, 0, 1}},
+		{dnsTypeAAAA, net.ParseIP("::1")},
+		// Preference 10, then mail plus a pointer to the question name
+		{dnsTypeMX, []byte{0, 10, 4, 'm', 'a', 'i', 'l', 0xc0, 12}},
+		{dnsTypeTXT, []byte("\x05hello\x06 world")},
+		{dnsTypeTXT, []byte("\x07another")},
+		{dnsTypeCAA, append([]byte{0, 5}, "issueletsencrypt.org"...)},
+	},
+	// Only answered in full over TCP
+	"big.test": []stubRR{
+		{dnsTypeCAA, append([]byte{128, 3}, "tbsUnknown"...)},
+	},
+	"empty.test": []stubRR{},
+}
+
+// Names the stub DNS server answers with a CNAME to another name, followed
+// by the other name's records
+var stubCNAMEs = map[string]string{
+	"alias.test": "example.test",
+	"loop1.test": "loop2.test",
+	"loop2.test": "loop1.test",
+}
+
+// encodeStubName returns name in DNS wire format, without compression.
+func encodeStubName(name string) []byte {
+	var encoded []byte
+	for _, label := range strings.Split(name, ".") {
+		encoded = append(encoded, byte(len(label)))
+		encoded = append(encoded, label...)
+	}
+	return append(encoded, 0)
+}
+
+func appendStubRR(msg, owner []byte, rr stubRR) []byte {
+	msg = append(msg, owner...)
+	msg = append(msg,
+		byte(rr.rrType>>8), byte(rr.rrType),
+		0, dnsClassINET,
+		0, 0, 0, 60, // TTL
+		byte(len(rr.data)>>8), byte(len(rr.data)))
+	return append(msg, rr.data...)
+}
+
+// answerDNS returns the stub server's response to query, which is truncated
+// for big.test when it came over UDP.
+func answerDNS(query []byte, udp bool) []byte {
+	if len(query) < 12 {
+		return nil
+	}
+	var labels []string
+	i := 12
+	for i < len(query) && query[i] != 0 {
+		length := int(query[i])
+		if i+1+length > len(query) {
+			return nil
+		}
+		labels = append(labels, string(query[i+1:i+1+length]))
+		i += 1 + length
+	}
+	questionEnd := i + 5 // Terminating zero, type and class
+	if questionEnd > len(query) {
+		return nil
+	}
+	name := strings.ToLower(strings.Join(labels, "."))
+	qtype := binary.BigEndian.Uint16(query[i+1:])
+
+	flags := []byte{0x81, 0x80} // Response, recursion available
+	question := query[12:questionEnd]
+	owner := []byte{0xc0, 12} // Pointer to the question name
+	var answers []byte
+	count := 0
+	for hops := 0; hops < 10; hops++ {
+		target, ok := stubCNAMEs[name]
+		if !ok {
+			break
+		}
+		answers = appendStubRR(answers, owner, stubRR{dnsTypeCNAME, encodeStubName(target)})
+		count++
+		name, owner = target, encodeStubName(target)
+	}
+	switch name {
+	case "stray.test":
+		// Answers for a name the query didn't lead to
+		name, owner = "example.test", encodeStubName("elsewhere.test")
+	case "mismatch.test":
+		// Answers a different question
+		name = "example.test"
+		question = append(encodeStubName(name), question[len(question)-4:]...)
+	}
+
+	records, found := stubRecords[name]
+	switch {
+	case name == "servfail.test":
+		flags[1] |= dnsRcodeServFail
+	case !found && count == 0:
+		flags[1] |= dnsRcodeNXDomain
+	case name == "big.test" && udp:
+		flags[0] |= 0x02
+	default:
+		for _, rr := range records {
+			if rr.rrType == qtype {
+				answers = appendStubRR(answers, owner, rr)
+				count++
+			}
+		}
+	}
+
+	response := []byte{query[0], query[1], flags[0], flags[1], 0, 1, 0, byte(count), 0, 0, 0, 0}
+	response = append(response, question...)
+	response = append(response, answers...)
+	return response
+}
+
+// dnsSrv runs the stub DNS server on UDP and TCP on the same port of
+// localhost.  It returns the address and a function that stops it.
+func dnsSrv(t *testing.T) (string, func()) {
+	udpConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	test.AssertNotError(t, err, "Couldn't listen for DNS over UDP")
+	addr := udpConn.LocalAddr().String()
+	tcpListener, err := net.Listen("tcp", addr)
+	test.AssertNotError(t, err, "Couldn't listen for DNS over TCP")
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, from, err := udpConn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if response := answerDNS(buf[:n], true); response != nil {
+				udpConn.WriteTo(response, from)
+			}
+		}
+	}()
+
+	go func() {
+		for {
+			conn, err := tcpListener.Accept()
+			if err != nil {
+				return
+			}
+			var length [2]byte
+			if _, err = io.ReadFull(conn, length[:]); err == nil {
+				query := make([]byte, binary.BigEndian.Uint16(length[:]))
+				if _, err = io.ReadFull(conn, query); err == nil {
+					response := answerDNS(query, false)
+					binary.BigEndian.PutUint16(length[:], uint16(len(response)))
+					conn.Write(append(length[:], response...))
+				}
+			}
+			conn.Close()
+		}
+	}()
+
+	return addr, func() {
+		udpConn.Close()
+		tcpListener.Close()
+	}
+}
+
+func newTestResolver(t *testing.T, servers ...string) *DNSResolverImpl {
+	stats, _ := statsd.NewNoopClient(nil)
+	return NewDNSResolverImpl(servers, 500*time.Millisecond, 1, stats)
+}
+
+func TestDNSLookupHost(t *testing.T) {
+	addr, stop := dnsSrv(t)
+	defer stop()
+	dns := newTestResolver(t, addr)
+
+	addrs, _, err := dns.LookupHost("example.test")
+	test.AssertNotError(t, err, "Failed to look up host")
+	test.AssertEquals(t, len(addrs), 2)
+	test.Assert(t, addrs[0].Equal(net.ParseIP("127.0.0.1")), "Wrong IPv4 address")
+	test.Assert(t, addrs[1].Equal(net.ParseIP("::1")), "Wrong IPv6 address")
+
+	addrs, _, err = dns.LookupHost("empty.test.")
+	test.AssertNotError(t, err, "Failed to look up host without addresses")
+	test.AssertEquals(t, len(addrs), 0)
+
+	_, _, err = dns.LookupHost("missing.test")
+	dnsErr, ok := err.(*net.DNSError)
+	test.Assert(t, ok && dnsErr.IsNotFound, "Nonexistent host wasn't reported as not found")
+
+	_, _, err = dns.LookupHost("servfail.test")
+	dnsErr, ok = err.(*net.DNSError)
+	test.Assert(t, ok && dnsErr.IsTemporary, "Server failure wasn't reported as temporary")
+
+	addrs, _, err = dns.LookupHost("alias.test")
+	test.AssertNotError(t, err, "Failed to look up host through a CNAME")
+	test.AssertEquals(t, len(addrs), 2)
+	test.Assert(t, addrs[0].Equal(net.ParseIP("127.0.0.1")), "Wrong IPv4 address through a CNAME")
+
+	// Addresses of some other name than the one asked about are ignored
+	addrs, _, err = dns.LookupHost("stray.test")
+	test.AssertNotError(t, err, "Failed to look up host with stray answers")
+	test.AssertEquals(t, len(addrs), 0)
+
+	_, _, err = dns.LookupHost("mismatch.test")
+	test.AssertError(t, err, "Accepted the answer to a different question")
+
+	_, _, err = dns.LookupHost("loop1.test")
+	test.AssertError(t, err, "Followed a CNAME loop")
+}
+
+func TestDNSLookupTXT(t *testing.T) {
+	addr, stop := dnsSrv(t)
+	defer stop()
+	dns := newTestResolver(t, addr)
+
+	txts, _, err := dns.LookupTXT("example.test")
+	test.AssertNotError(t, err, "Failed to look up TXT records")
+	test.AssertEquals(t, len(txts), 2)
+	test.AssertEquals(t, txts[0], "hello world")
+	test.AssertEquals(t, txts[1], "another")
+}
+
+func TestDNSLookupMX(t *testing.T) {
+	addr, stop := dnsSrv(t)
+	defer stop()
+	dns := newTestResolver(t, addr)
+
+	hosts, _, err := dns.LookupMX("example.test")
+	test.AssertNotError(t, err, "Failed to look up MX records")
+	test.AssertEquals(t, len(hosts), 1)
+	test.AssertEquals(t, hosts[0], "mail.example.test.")
+}
+
+func TestDNSLookupCAA(t *testing.T) {
+	addr, stop := dnsSrv(t)
+	defer stop()
+	dns := newTestResolver(t, addr)
+
+	caas, _, err := dns.LookupCAA("example.test")
+	test.AssertNotError(t, err, "Failed to look up CAA records")
+	test.AssertEquals(t, len(caas), 1)
+	test.AssertEquals(t, *caas[0], CAA{Flag: 0, Tag: "issue", Value: "letsencrypt.org"})
+
+	// Truncated over UDP, so this one has to come over TCP
+	caas, _, err = dns.LookupCAA("big.test")
+	test.AssertNotError(t, err, "Failed to look up CAA records over TCP")
+	test.AssertEquals(t, len(caas), 1)
+	test.AssertEquals(t, caas[0].Tag, "tbs")
+	test.Assert(t, caas[0].Critical(), "Critical flag wasn't set")
+
+	caas, _, err = dns.LookupCAA("missing.test")
+	test.AssertNotError(t, err, "Nonexistent domain should just have no CAA records")
+	test.AssertEquals(t, len(caas), 0)
+}
+
+func TestDNSRetries(t *testing.T) {
+	addr, stop := dnsSrv(t)
+	defer stop()
+
+	// Never answers
+	silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	test.AssertNotError(t, err, "Couldn't listen for DNS")
+	defer silent.Close()
+
+	dns := newTestResolver(t, silent.LocalAddr().String(), addr)
+	addrs, _, err := dns.LookupHost("example.test")
+	test.AssertNotError(t, err, "Lookup wasn't retried on the next server")
+	test.AssertEquals(t, len(addrs), 2)
+
+	dns.Retries = 0
+	_, _, err = dns.LookupTXT("example.test")
+	dnsErr, ok := err.(*net.DNSError)
+	test.Assert(t, ok && dnsErr.IsTimeout, "Unanswered query wasn't reported as a timeout")
+
+	// Not worth retrying, so the silent server is never asked
+	dns.Servers = []string{addr, silent.LocalAddr().String()}
+	dns.Retries = 1
+	_, _, err = dns.LookupTXT("missing.test")
+	dnsErr, ok = err.(*net.DNSError)
+	test.Assert(t, ok && dnsErr.IsNotFound, "Nonexistent name wasn't reported as not found")
+
+	dns.Servers = nil
+	_, _, err = dns.LookupTXT("example.test")
+	test.AssertError(t, err, "Looked up a name without any servers")
+}
@@ -7,6 +7,7 @@ package core
 
 import (
 	"crypto/x509"
+	"net"
 	"net/http"
 	"time"
 
@@ -64,11 +65,26 @@ type RegistrationAuthority interface {
 	// [WebFrontEnd]
 	UpdateRegistration(Registration, Registration) (Registration, error)
 
+	// [WebFrontEnd]
+	UpdateRegistrationKey(Registration, jose.JsonWebKey) (Registration, error)
+
+	// [WebFrontEnd]
+	DeactivateRegistration(Registration) (Registration, error)
+
 	// [WebFrontEnd]
 	UpdateAuthorization(Authorization, int, Challenge) (Authorization, error)
 
 	// [WebFrontEnd]
-	RevokeCertificate(x509.Certificate) error
+	DeactivateAuthorization(Authorization) (Authorization, error)
+
+	// [WebFrontEnd]
+	RevokeCertificate(x509.Certificate, int) error
+
+	// [WebFrontEnd]
+	NewOrder(Order, int64) (Order, error)
+
+	// [WebFrontEnd]
+	FinalizeOrder(Order, x509.CertificateRequest) (Order, error)
 
 	// [ValidationAuthority]
 	OnValidationUpdate(Authorization) error
@@ -77,6 +93,9 @@ type RegistrationAuthority interface {
 type ValidationAuthority interface {
 	// [RegistrationAuthority]
 	UpdateValidations(Authorization, int) error
+
+	// [RegistrationAuthority]
+	CheckCAARecords(AcmeIdentifier) (present, valid bool, err error)
 }
 
 type CertificateAuthority interface {
@@ -91,6 +110,15 @@ type PolicyAuthority interface {
 	ChallengesFor(AcmeIdentifier) ([]Challenge, [][]int)
 }
 
+// A DNSResolver looks up the DNS records that validation and policy checks
+// depend on.  Each lookup also returns how long it took.
+type DNSResolver interface {
+	LookupHost(string) ([]net.IP, time.Duration, error)
+	LookupTXT(string) ([]string, time.Duration, error)
+	LookupMX(string) ([]string, time.Duration, error)
+	LookupCAA(string) ([]*CAA, time.Duration, error)
+}
+
 type StorageGetter interface {
 	GetRegistration(int64) (Registration, error)
 	GetRegistrationByKey(jose.JsonWebKey) (Registration, error)
@@ -98,18 +126,36 @@ type StorageGetter interface {
 	GetCertificate(string) ([]byte, error)
 	GetCertificateByShortSerial(string) ([]byte, error)
 	GetCertificateStatus(string) (CertificateStatus, error)
+	GetCertificateRegistrationID(string) (int64, error)
+	GetValidAuthorizations(int64, []string, time.Time) (map[string]Authorization, error)
+	GetLatestAuthorization(int64, AcmeIdentifier, AcmeStatus) (Authorization, error)
+	CountCertificatesByNames([]string, time.Time) (map[string]int64, error)
+	CountCertificatesByFQDNSet([]string, time.Time) (int64, error)
+	CountNamesByRegistration(int64, time.Time) (int64, error)
+	CountRegistrationsByIP(net.IP, time.Time) (int64, error)
+	CountPendingAuthorizations(int64) (int64, error)
+	GetCertificateSerialsByRegistration(CollectionQuery) ([]string, error)
+	GetAuthorizationIDsByRegistration(CollectionQuery) ([]string, error)
+	GetOrder(string) (Order, error)
 	AlreadyDeniedCSR([]string) (bool, error)
 }
 
 type StorageAdder interface {
 	NewRegistration(Registration) (Registration, error)
 	UpdateRegistration(Registration) error
+	UpdateRegistrationKey(Registration, jose.JsonWebKey) (Registration, error)
+	DeactivateRegistration(int64) (Registration, error)
 
 	NewPendingAuthorization(Authorization) (Authorization, error)
 	UpdatePendingAuthorization(Authorization) error
 	FinalizeAuthorization(Authorization) error
+	DeactivateAuthorization(string) (Authorization, error)
 	MarkCertificateRevoked(serial string, ocspResponse []byte, reasonCode int) error
 
+	NewOrder(Order) (Order, error)
+	SetOrderProcessing(string, time.Time) error
+	UpdateOrder(Order) error
+
 	AddCertificate([]byte, int64) (string, error)
 }
 
@@ -12,6 +12,7 @@ import (
 	"encoding/json"
 	"fmt"
 	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/square/go-jose"
+	"net"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -24,12 +25,13 @@ type OCSPStatus string
 type Buffer []byte
 
 const (
-	StatusUnknown    = AcmeStatus("unknown")    // Unknown status; the default
-	StatusPending    = AcmeStatus("pending")    // In process; client has next action
-	StatusProcessing = AcmeStatus("processing") // In process; server has next action
-	StatusValid      = AcmeStatus("valid")      // Validation succeeded
-	StatusInvalid    = AcmeStatus("invalid")    // Validation failed
-	StatusRevoked    = AcmeStatus("revoked")    // Object no longer valid
+	StatusUnknown     = AcmeStatus("unknown")     // Unknown status; the default
+	StatusPending     = AcmeStatus("pending")     // In process; client has next action
+	StatusProcessing  = AcmeStatus("processing")  // In process; server has next action
+	StatusValid       = AcmeStatus("valid")       // Validation succeeded
+	StatusInvalid     = AcmeStatus("invalid")     // Validation failed
+	StatusRevoked     = AcmeStatus("revoked")     // Object no longer valid
+	StatusDeactivated = AcmeStatus("deactivated") // Object withdrawn by its owner
 )
 
 const (
@@ -41,6 +43,8 @@ const (
 	ChallengeTypeSimpleHTTPS   = "simpleHttps"
 	ChallengeTypeDVSNI         = "dvsni"
 	ChallengeTypeDNS           = "dns"
+	ChallengeTypeHTTP01        = "http-01"
+	ChallengeTypeTLSALPN01     = "tls-alpn-01"
 	ChallengeTypeRecoveryToken = "recoveryToken"
 )
 
@@ -147,6 +151,16 @@ type Registration struct {
 	// Agreement with terms of service
 	Agreement string `json:"agreement,omitempty" db:"agreement"`
 
+	// Status of the registration: valid, deactivated by the subscriber, or
+	// revoked by the CA. Only valid registrations may make requests.
+	Status AcmeStatus `json:"status,omitempty" db:"status"`
+
+	// The IP address the registration was created from
+	InitialIP net.IP `json:"initialIp" db:"initialIp"`
+
+	// When the registration was created
+	CreatedAt time.Time `json:"createdAt" db:"createdAt"`
+
 	LockCol int64 `json:"-"`
 }
 
@@ -160,6 +174,54 @@ func (r *Registration) MergeUpdate(input Registration) {
 	}
 }
 
+// ProblemType objects represent problem documents, which are
+// returned with HTTP error responses
+// https://tools.ietf.org/html/draft-ietf-appsawg-http-problem-00
+type ProblemType string
+
+const (
+	MalformedProblem         = ProblemType("urn:acme:error:malformed")
+	UnauthorizedProblem      = ProblemType("urn:acme:error:unauthorized")
+	ServerInternalProblem    = ProblemType("urn:acme:error:serverInternal")
+	BadNonceProblem          = ProblemType("urn:acme:error:badNonce")
+	BadCSRProblem            = ProblemType("urn:acme:error:badCSR")
+	ConnectionProblem        = ProblemType("urn:acme:error:connection")
+	DNSProblem               = ProblemType("urn:acme:error:dns")
+	TLSProblem               = ProblemType("urn:acme:error:tls")
+	RateLimitedProblem       = ProblemType("urn:acme:error:rateLimited")
+	UnknownHostProblem       = ProblemType("urn:acme:error:unknownHost")
+	InvalidEmailProblem      = ProblemType("urn:acme:error:invalidEmail")
+	AgreementRequiredProblem = ProblemType("urn:acme:error:agreementRequired")
+)
+
+// ProblemDetails is the body of a problem document, either sent in response
+// to a failed request or attached to the challenge that failed validation.
+type ProblemDetails struct {
+	Type   ProblemType `json:"type,omitempty"`
+	Detail string      `json:"detail,omitempty"`
+}
+
+func (pd *ProblemDetails) Error() string {
+	return fmt.Sprintf("%s :: %s", pd.Type, pd.Detail)
+}
+
+// A ValidationRecord describes one lookup or connection the VA made while
+// validating a challenge, so that failures can be explained afterwards.
+type ValidationRecord struct {
+	// The URL fetched, for challenges validated over HTTP
+	URL string `json:"url,omitempty"`
+
+	// The name looked up, and the port connected to on it
+	Hostname string `json:"hostname"`
+	Port     string `json:"port,omitempty"`
+
+	// The addresses the name resolved to, and the one connected to.  That's
+	// empty if the name couldn't be resolved or all its addresses were
+	// blocked.
+	AddressesResolved []net.IP `json:"addressesResolved,omitempty"`
+	AddressUsed       net.IP   `json:"addressUsed,omitempty"`
+}
+
 // Rather than define individual types for different types of
 // challenge, we just throw all the elements into one bucket,
 // together with the common metadata elements.
@@ -174,12 +236,21 @@ type Challenge struct {
 	// was completed by the server.
 	Validated *time.Time `json:"validated,omitempty"`
 
+	// If unsuccessful, the problem that caused validation to fail
+	Error *ProblemDetails `json:"error,omitempty"`
+
 	// A URI to which a response can be POSTed
 	URI AcmeURL `json:"uri"`
 
-	// Used by simpleHTTPS, recoveryToken, and dns challenges
+	// Used by simpleHTTPS, recoveryToken, dns, http-01 and tls-alpn-01
+	// challenges
 	Token string `json:"token,omitempty"`
 
+	// Used by http-01, tls-alpn-01 and dns challenges: the token and the
+	// thumbprint of the account key, which the subscriber's server must
+	// prove it knows (for dns, by publishing its SHA-256 digest)
+	KeyAuthorization string `json:"keyAuthorization,omitempty"`
+
 	// Used by simpleHTTPS challenges
 	Path string `json:"path,omitempty"`
 
@@ -187,6 +258,9 @@ type Challenge struct {
 	R     string `json:"r,omitempty"`
 	S     string `json:"s,omitempty"`
 	Nonce string `json:"nonce,omitempty"`
+
+	// What the VA did to validate this challenge, in order
+	ValidationRecord []ValidationRecord `json:"validationRecord,omitempty"`
 }
 
 // Check the sanity of a challenge object before issued to the client (completed = false)
@@ -260,6 +334,37 @@ func (ch Challenge) IsSane(completed bool) bool {
 				return false
 			}
 		}
+	case ChallengeTypeHTTP01, ChallengeTypeTLSALPN01, ChallengeTypeDNS:
+		// check extra fields aren't used
+		if ch.Path != "" || ch.R != "" || ch.S != "" || ch.Nonce != "" {
+			return false
+		}
+
+		if ch.Token == "" || len(ch.Token) != 43 {
+			return false
+		}
+		if _, err := B64dec(ch.Token); err != nil {
+			return false
+		}
+
+		// Once completed there must be a key authorization for this token,
+		// before then there can't be one
+		if completed {
+			if !strings.HasPrefix(ch.KeyAuthorization, ch.Token+".") {
+				return false
+			}
+			thumbprint := strings.TrimPrefix(ch.KeyAuthorization, ch.Token+".")
+			if len(thumbprint) != 43 {
+				return false
+			}
+			if _, err := B64dec(thumbprint); err != nil {
+				return false
+			}
+		} else {
+			if ch.KeyAuthorization != "" {
+				return false
+			}
+		}
 	default:
 		return false
 	}
@@ -279,6 +384,10 @@ func (ch Challenge) MergeResponse(resp Challenge) Challenge {
 		ch.S = resp.S
 	}
 
+	if len(ch.KeyAuthorization) == 0 {
+		ch.KeyAuthorization = resp.KeyAuthorization
+	}
+
 	return ch
 }
 
@@ -317,6 +426,38 @@ type Authorization struct {
 	Combinations [][]int `json:"combinations,omitempty" db:"combinations"`
 }
 
+// An Order is a client's request for a certificate covering a set of
+// identifiers.  The RA attaches an authorization to the order for each
+// identifier, and once those are valid the client finalizes the order with a
+// CSR to have the certificate issued.  As with Authorization, fields that
+// should be suppressed on the wire (ID, regID) must be made empty before
+// marshaling.
+type Order struct {
+	// An identifier for this order, unique within this instance
+	ID string `json:"id,omitempty" db:"id"`
+
+	// The registration ID associated with the order
+	RegistrationID int64 `json:"regId,omitempty" db:"registrationID"`
+
+	// Pending until the order is finalized, processing while the certificate
+	// is issued, then valid once it has been
+	Status AcmeStatus `json:"status,omitempty" db:"status"`
+
+	// The date after which the order can no longer be finalized
+	Expires time.Time `json:"expires,omitempty" db:"expires"`
+
+	// The identifiers the certificate will cover
+	Identifiers []AcmeIdentifier `json:"identifiers,omitempty" db:"identifiers"`
+
+	// The IDs of the authorizations for the identifiers, in the same order
+	Authorizations []string `json:"authorizations,omitempty" db:"authorizations"`
+
+	// The serial number of the certificate, once it has been issued
+	CertificateSerial string `json:"certificateSerial,omitempty" db:"certificateSerial"`
+
+	LockCol int64 `json:"-"`
+}
+
 // Fields of this type get encoded and decoded JOSE-style, in base64url encoding
 // with stripped padding.
 type JsonBuffer []byte
@@ -409,7 +550,7 @@ func (cert Certificate) MatchesCSR(csr *x509.CertificateRequest, earliestExpiry
 		return
 	}
 	if parsedCertificate.NotAfter.After(earliestExpiry) {
-		err = InternalServerError("Generated certificate expires before earliest expiration")
+		err = InternalServerError("Generated certificate expires after earliest expiration")
 		return
 	}
 	now := time.Now()
@@ -433,6 +574,22 @@ func (cert Certificate) MatchesCSR(csr *x509.CertificateRequest, earliestExpiry
 	return
 }
 
+// RevocationReasons maps the RFC 5280 CRLReason codes that a certificate can
+// be revoked with to their names.
+var RevocationReasons = map[int]string{
+	0: "unspecified",
+	1: "keyCompromise",
+	2: "cACompromise",
+	3: "affiliationChanged",
+	4: "superseded",
+	5: "cessationOfOperation",
+	6: "certificateHold",
+	// 7 is unused
+	8:  "removeFromCRL", // needed?
+	9:  "privilegeWithdrawn",
+	10: "aAcompromise",
+}
+
 // CertificateStatus structs are internal to the server. They represent the
 // latest data about the status of the certificate, required for OCSP updating
 // and for validating that the subscriber has accepted the certificate.
@@ -506,3 +663,23 @@ type OCSPSigningRequest struct {
 	Reason    int
 	RevokedAt time.Time
 }
+
+// CollectionQuery selects one page of the certificates or authorizations that
+// belong to a registration, ordered by serial or ID.
+type CollectionQuery struct {
+	RegistrationID int64
+
+	// Cursor is the serial or ID of the last item on the previous page, or
+	// empty for the first page.
+	Cursor string
+
+	// Limit is the largest number of items to return.
+	Limit int
+
+	// Status, if set, restricts the page to certificates with that OCSP status
+	// or to authorizations with that status.
+	Status string
+
+	// ExpiresAfter, if set, restricts the page to items that expire after it.
+	ExpiresAfter time.Time
+}
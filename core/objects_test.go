@@ -93,6 +93,57 @@ func TestSanityCheck(t *testing.T) {
 	chall.S = "KQqLsiS5j0CONR_eUXTUSUDNVaHODtc-0pD6ACif7U4"
 	test.Assert(t, chall.IsSane(true), "IsSane should be true")
 
+	chall = Challenge{Type: ChallengeTypeDNS, Status: StatusPending}
+	test.Assert(t, !chall.IsSane(false), "IsSane should be false")
+	chall.Token = "notlongenough"
+	test.Assert(t, !chall.IsSane(false), "IsSane should be false")
+	chall.Token = "evaGxfADs6pSRb2LAv9IZf17Dt3juxGJ+PCt92wr+o!"
+	test.Assert(t, !chall.IsSane(false), "IsSane should be false")
+	chall.Token = "KQqLsiS5j0CONR_eUXTUSUDNVaHODtc-0pD6ACif7U4"
+	test.Assert(t, chall.IsSane(false), "IsSane should be true")
+	test.Assert(t, !chall.IsSane(true), "IsSane should be false")
+	chall.KeyAuthorization = "KQqLsiS5j0CONR_eUXTUSUDNVaHODtc-0pD6ACif7U4.NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"
+	test.Assert(t, chall.IsSane(true), "IsSane should be true")
+	chall.Path = "bad"
+	test.Assert(t, !chall.IsSane(true), "IsSane should be false")
+	chall.Path = ""
+	chall.S = "KQqLsiS5j0CONR_eUXTUSUDNVaHODtc-0pD6ACif7U4"
+	test.Assert(t, !chall.IsSane(true), "IsSane should be false")
+	test.Assert(t, DNSChallenge().IsSane(false), "New DNS challenge should be sane")
+
+	chall = Challenge{Type: ChallengeTypeHTTP01, Status: StatusPending}
+	test.Assert(t, !chall.IsSane(false), "IsSane should be false")
+	chall.Token = "notlongenough"
+	test.Assert(t, !chall.IsSane(false), "IsSane should be false")
+	chall.Token = "evaGxfADs6pSRb2LAv9IZf17Dt3juxGJ+PCt92wr+o!"
+	test.Assert(t, !chall.IsSane(false), "IsSane should be false")
+	chall.Token = "KQqLsiS5j0CONR_eUXTUSUDNVaHODtc-0pD6ACif7U4"
+	test.Assert(t, chall.IsSane(false), "IsSane should be true")
+	chall.Path = "bad"
+	test.Assert(t, !chall.IsSane(false), "IsSane should be false")
+	chall.Path = ""
+	test.Assert(t, !chall.IsSane(true), "IsSane should be false")
+	chall.KeyAuthorization = "KQqLsiS5j0CONR_eUXTUSUDNVaHODtc-0pD6ACif7U4.notlongenough"
+	test.Assert(t, !chall.IsSane(true), "IsSane should be false")
+	chall.KeyAuthorization = "LoqXcYV8q5ONbJQxbmR7SCTNo3tiAXDfowyjxAjEuX0.NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"
+	test.Assert(t, !chall.IsSane(true), "IsSane should be false")
+	chall.KeyAuthorization = "KQqLsiS5j0CONR_eUXTUSUDNVaHODtc-0pD6ACif7U4.NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"
+	test.Assert(t, chall.IsSane(true), "IsSane should be true")
+	test.Assert(t, !chall.IsSane(false), "IsSane should be false")
+	test.Assert(t, HTTP01Challenge().IsSane(false), "New HTTP01 challenge should be sane")
+
+	chall = Challenge{Type: ChallengeTypeTLSALPN01, Status: StatusPending}
+	test.Assert(t, !chall.IsSane(false), "IsSane should be false")
+	chall.Token = "KQqLsiS5j0CONR_eUXTUSUDNVaHODtc-0pD6ACif7U4"
+	test.Assert(t, chall.IsSane(false), "IsSane should be true")
+	chall.Nonce = "12345678901234567890123456789012"
+	test.Assert(t, !chall.IsSane(false), "IsSane should be false")
+	chall.Nonce = ""
+	test.Assert(t, !chall.IsSane(true), "IsSane should be false")
+	chall.KeyAuthorization = "KQqLsiS5j0CONR_eUXTUSUDNVaHODtc-0pD6ACif7U4.NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"
+	test.Assert(t, chall.IsSane(true), "IsSane should be true")
+	test.Assert(t, TLSALPN01Challenge().IsSane(false), "New TLS-ALPN-01 challenge should be sane")
+
 	chall = Challenge{Type: "bogus", Status: StatusPending}
 	test.Assert(t, !chall.IsSane(false), "IsSane should be false")
 	test.Assert(t, !chall.IsSane(true), "IsSane should be false")
@@ -24,8 +24,10 @@ import (
 	"hash"
 	"io"
 	"math/big"
+	"net"
 	"net/url"
 	"strings"
+	"time"
 )
 
 // Package Variables Variables
@@ -44,6 +46,14 @@ type NotFoundError string
 type SyntaxError string
 type SignatureValidationError string
 type CertificateIssuanceError string
+type BadNonceError string
+type BadCSRError string
+type InvalidEmailError string
+type ConnectionError string
+type DNSError string
+type TLSError string
+type UnknownHostError string
+type AgreementRequiredError string
 
 func (e InternalServerError) Error() string      { return string(e) }
 func (e NotSupportedError) Error() string        { return string(e) }
@@ -53,6 +63,106 @@ func (e NotFoundError) Error() string            { return string(e) }
 func (e SyntaxError) Error() string              { return string(e) }
 func (e SignatureValidationError) Error() string { return string(e) }
 func (e CertificateIssuanceError) Error() string { return string(e) }
+func (e BadNonceError) Error() string            { return string(e) }
+func (e BadCSRError) Error() string              { return string(e) }
+func (e InvalidEmailError) Error() string        { return string(e) }
+func (e ConnectionError) Error() string          { return string(e) }
+func (e DNSError) Error() string                 { return string(e) }
+func (e TLSError) Error() string                 { return string(e) }
+func (e UnknownHostError) Error() string         { return string(e) }
+func (e AgreementRequiredError) Error() string   { return string(e) }
+
+// A RateLimitedError can say when the client may try again, in RetryAt.
+// That's zero if it doesn't.
+type RateLimitedError struct {
+	Detail  string
+	RetryAt time.Time
+}
+
+func (e RateLimitedError) Error() string { return e.Detail }
+
+// NewRateLimitedError returns a RateLimitedError saying that the client may
+// try again after retryAt.
+func NewRateLimitedError(detail string, retryAt time.Time) RateLimitedError {
+	return RateLimitedError{Detail: detail, RetryAt: retryAt}
+}
+
+// RetryAfter returns the time after which the client may try again, if the
+// error says.
+func (e RateLimitedError) RetryAfter() (time.Time, bool) {
+	return e.RetryAt, !e.RetryAt.IsZero()
+}
+
+// ProblemDetailsForError describes an error as an ACME problem document.
+// Errors without a more specific problem type are reported as internal
+// server errors.
+func ProblemDetailsForError(err error) *ProblemDetails {
+	problem := &ProblemDetails{Detail: err.Error()}
+	switch err.(type) {
+	case MalformedRequestError, NotSupportedError, NotFoundError, SyntaxError, SignatureValidationError:
+		problem.Type = MalformedProblem
+	case UnauthorizedError:
+		problem.Type = UnauthorizedProblem
+	case BadNonceError:
+		problem.Type = BadNonceProblem
+	case BadCSRError:
+		problem.Type = BadCSRProblem
+	case RateLimitedError:
+		problem.Type = RateLimitedProblem
+	case InvalidEmailError:
+		problem.Type = InvalidEmailProblem
+	case ConnectionError:
+		problem.Type = ConnectionProblem
+	case DNSError:
+		problem.Type = DNSProblem
+	case TLSError:
+		problem.Type = TLSProblem
+	case UnknownHostError:
+		problem.Type = UnknownHostProblem
+	case AgreementRequiredError:
+		problem.Type = AgreementRequiredProblem
+	default:
+		problem.Type = ServerInternalProblem
+	}
+	return problem
+}
+
+// ConfigDuration is a time.Duration that is written in JSON config files as a
+// string such as "168h".
+type ConfigDuration struct {
+	time.Duration
+}
+
+func (d ConfigDuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.Duration.String())
+}
+
+func (d *ConfigDuration) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(str)
+	if err != nil {
+		return err
+	}
+	d.Duration = duration
+	return nil
+}
+
+// ParseNetworks parses a list of CIDR blocks from a config file, e.g. the
+// VA's blocked networks or the WFE's trusted proxies.
+func ParseNetworks(cidrs []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		networks[i] = network
+	}
+	return networks, nil
+}
 
 // Base64 functions
 
@@ -122,6 +232,40 @@ func KeyDigest(key crypto.PublicKey) (string, error) {
 	}
 }
 
+// Thumbprint computes the JWK thumbprint of a key (RFC 7638): the digest of
+// its required members, in order and without whitespace.
+func Thumbprint(key *jose.JsonWebKey) (string, error) {
+	var members string
+	switch k := key.Key.(type) {
+	case *rsa.PublicKey:
+		members = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`,
+			B64enc(big.NewInt(int64(k.E)).Bytes()), B64enc(k.N.Bytes()))
+	case *ecdsa.PublicKey:
+		// Coordinates are padded to the size of the curve
+		size := (k.Curve.Params().BitSize + 7) / 8
+		x := make([]byte, size)
+		y := make([]byte, size)
+		xBytes, yBytes := k.X.Bytes(), k.Y.Bytes()
+		copy(x[size-len(xBytes):], xBytes)
+		copy(y[size-len(yBytes):], yBytes)
+		members = fmt.Sprintf(`{"crv":"%s","kty":"EC","x":"%s","y":"%s"}`,
+			k.Curve.Params().Name, B64enc(x), B64enc(y))
+	default:
+		return "", fmt.Errorf("Unsupported key type %T", key.Key)
+	}
+	return Fingerprint256([]byte(members)), nil
+}
+
+// KeyAuthorization returns what a subscriber proves control of an identifier
+// with for challenges that bind the token to their account key.
+func KeyAuthorization(token string, key *jose.JsonWebKey) (string, error) {
+	thumbprint, err := Thumbprint(key)
+	if err != nil {
+		return "", err
+	}
+	return token + "." + thumbprint, nil
+}
+
 func KeyDigestEquals(j, k crypto.PublicKey) bool {
 	jDigest, jErr := KeyDigest(j)
 	kDigest, kErr := KeyDigest(k)
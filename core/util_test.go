@@ -6,14 +6,19 @@
 package core
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"encoding/json"
 	"fmt"
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/square/go-jose"
 	"github.com/letsencrypt/boulder/test"
 	"math"
 	"math/big"
+	"net"
 	"net/url"
 	"testing"
+	"time"
 )
 
 // challenges.go
@@ -90,9 +95,106 @@ func TestKeyDigestEquals(t *testing.T) {
 	test.Assert(t, !KeyDigestEquals(struct{}{}, struct{}{}), "Unknown key types should not match anything")
 }
 
+// The example from RFC 7638 section 3.1
+const JWK_RFC7638_JSON = `{
+  "kty": "RSA",
+  "n": "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+  "e": "AQAB"
+}`
+const JWK_RFC7638_THUMBPRINT = `NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs`
+
+func TestThumbprint(t *testing.T) {
+	var jwk jose.JsonWebKey
+	err := json.Unmarshal([]byte(JWK_RFC7638_JSON), &jwk)
+	test.AssertNotError(t, err, "Failed to unmarshal JWK")
+	thumbprint, err := Thumbprint(&jwk)
+	test.AssertNotError(t, err, "Failed to compute thumbprint")
+	test.AssertEquals(t, thumbprint, JWK_RFC7638_THUMBPRINT)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	test.AssertNotError(t, err, "Failed to generate EC key")
+	thumbprint, err = Thumbprint(&jose.JsonWebKey{Key: &ecKey.PublicKey})
+	test.AssertNotError(t, err, "Failed to compute thumbprint of EC key")
+	test.AssertEquals(t, len(thumbprint), 43)
+
+	_, err = Thumbprint(&jose.JsonWebKey{Key: struct{}{}})
+	test.AssertError(t, err, "Should have rejected unknown key type")
+
+	keyAuthz, err := KeyAuthorization("token", &jwk)
+	test.AssertNotError(t, err, "Failed to compute key authorization")
+	test.AssertEquals(t, keyAuthz, "token."+JWK_RFC7638_THUMBPRINT)
+}
+
 func TestAcmeURL(t *testing.T) {
 	s := "http://example.invalid"
 	u, _ := url.Parse(s)
 	a := AcmeURL(*u)
 	test.AssertEquals(t, s, a.String())
 }
+
+func TestProblemDetailsForError(t *testing.T) {
+	testCases := []struct {
+		err  error
+		prob ProblemType
+	}{
+		{MalformedRequestError("foo"), MalformedProblem},
+		{NotFoundError("foo"), MalformedProblem},
+		{UnauthorizedError("foo"), UnauthorizedProblem},
+		{BadNonceError("foo"), BadNonceProblem},
+		{BadCSRError("foo"), BadCSRProblem},
+		{RateLimitedError{Detail: "foo"}, RateLimitedProblem},
+		{InvalidEmailError("foo"), InvalidEmailProblem},
+		{ConnectionError("foo"), ConnectionProblem},
+		{DNSError("foo"), DNSProblem},
+		{TLSError("foo"), TLSProblem},
+		{UnknownHostError("foo"), UnknownHostProblem},
+		{AgreementRequiredError("foo"), AgreementRequiredProblem},
+		{InternalServerError("foo"), ServerInternalProblem},
+		{fmt.Errorf("foo"), ServerInternalProblem},
+	}
+	for _, c := range testCases {
+		problem := ProblemDetailsForError(c.err)
+		test.AssertEquals(t, problem.Type, c.prob)
+		test.AssertEquals(t, problem.Detail, "foo")
+	}
+}
+
+func TestRateLimitedErrorRetryAfter(t *testing.T) {
+	retryAt := time.Date(2015, 6, 1, 12, 30, 0, 0, time.UTC)
+	err := NewRateLimitedError("Too many certificates", retryAt)
+	test.AssertEquals(t, err.Error(), "Too many certificates")
+
+	after, ok := err.RetryAfter()
+	test.Assert(t, ok, "Couldn't get retry time")
+	test.Assert(t, after.Equal(retryAt), "Wrong retry time")
+
+	_, ok = RateLimitedError{Detail: "Too many certificates"}.RetryAfter()
+	test.Assert(t, !ok, "Got a retry time from an error without one")
+}
+
+func TestConfigDuration(t *testing.T) {
+	var d ConfigDuration
+	err := json.Unmarshal([]byte(`"168h"`), &d)
+	test.AssertNotError(t, err, "Couldn't unmarshal duration")
+	test.AssertEquals(t, d.Duration, 168*time.Hour)
+
+	jsonDuration, err := json.Marshal(d)
+	test.AssertNotError(t, err, "Couldn't marshal duration")
+	test.AssertEquals(t, string(jsonDuration), `"168h0m0s"`)
+
+	err = json.Unmarshal([]byte(`"a week"`), &d)
+	test.AssertError(t, err, "Unmarshaled an invalid duration")
+	err = json.Unmarshal([]byte(`168`), &d)
+	test.AssertError(t, err, "Unmarshaled a number as a duration")
+}
+
+func TestParseNetworks(t *testing.T) {
+	networks, err := ParseNetworks([]string{"8.8.8.0/24", "2001:db8::/32"})
+	test.AssertNotError(t, err, "Couldn't parse networks")
+	test.AssertEquals(t, len(networks), 2)
+	test.Assert(t, networks[0].Contains(net.ParseIP("8.8.8.8")), "Parsed the wrong network")
+	test.Assert(t, networks[1].Contains(net.ParseIP("2001:db8::1")), "Parsed the wrong network")
+
+	_, err = ParseNetworks([]string{"bogus"})
+	test.AssertError(t, err, "Parsed a bogus network")
+}
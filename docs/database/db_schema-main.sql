@@ -12,25 +12,32 @@
 CREATE TABLE `registrations` (
   `id` bigint(20) NOT NULL AUTO_INCREMENT,
   `jwk` varchar(1024) NOT NULL,
+  `jwkSHA256` varchar(255) DEFAULT NULL COMMENT 'NULL until GetRegistrationByKey or an update fills it in for registrations stored before it',
   `recoveryToken` varchar(255) DEFAULT NULL,
   `contact` varchar(255) DEFAULT NULL,
   `agreement` varchar(255) DEFAULT NULL,
+  `status` varchar(255) DEFAULT NULL,
+  `initialIp` varbinary(16) NOT NULL DEFAULT '',
+  `createdAt` datetime NOT NULL DEFAULT '1970-01-01 00:00:00' COMMENT 'Registrations from before this was recorded get the epoch, so they never count towards CountRegistrationsByIP',
   `LockCol` bigint(20) DEFAULT NULL,
   PRIMARY KEY (`id`),
-  KEY `idx_registrations_jwk` (`jwk`(255)) COMMENT 'Used by GetRegistrationByKey'
+  UNIQUE KEY `jwkSHA256` (`jwkSHA256`) COMMENT 'Used by GetRegistrationByKey',
+  KEY `idx_registrations_jwk` (`jwk`(255)) COMMENT 'Used by GetRegistrationByKey for registrations without a jwkSHA256',
+  KEY `initialIp_createdAt` (`initialIp`,`createdAt`) COMMENT 'Used by CountRegistrationsByIP'
 ) ENGINE=InnoDB AUTO_INCREMENT=70 DEFAULT CHARSET=utf8;
 
 CREATE TABLE `authz` (
-  `id` varchar(255) NOT NULL,
+  `id` varchar(255) COLLATE utf8_bin NOT NULL,
   `identifier` varchar(255) DEFAULT NULL,
   `registrationID` bigint(20) DEFAULT NULL,
   `status` varchar(255) DEFAULT NULL,
   `expires` datetime DEFAULT NULL,
-  `challenges` varchar(1536) DEFAULT NULL,
+  `challenges` varchar(4096) DEFAULT NULL,
   `combinations` varchar(255) DEFAULT NULL,
   `sequence` bigint(20) DEFAULT NULL,
   PRIMARY KEY (`id`),
-  KEY `regId_idx` (`registrationID`),
+  KEY `regId_idx` (`registrationID`,`id`) COMMENT 'Used by GetAuthorizationIDsByRegistration',
+  KEY `regId_identifier_status_idx` (`registrationID`,`identifier`,`status`) COMMENT 'Used by GetLatestAuthorization',
   CONSTRAINT `regId_authz` FOREIGN KEY (`registrationID`) REFERENCES `registrations` (`id`) ON DELETE NO ACTION ON UPDATE NO ACTION
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
 
@@ -43,7 +50,7 @@ CREATE TABLE `certificates` (
   `issued` datetime DEFAULT NULL,
   `expires` datetime DEFAULT NULL,
   PRIMARY KEY (`serial`),
-  KEY `regId_certificates_idx` (`registrationID`),
+  KEY `regId_certificates_idx` (`registrationID`,`serial`) COMMENT 'Used by GetCertificateSerialsByRegistration',
   CONSTRAINT `regId_certificates` FOREIGN KEY (`registrationID`) REFERENCES `registrations` (`id`) ON DELETE NO ACTION ON UPDATE NO ACTION
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
 
@@ -71,6 +78,26 @@ CREATE TABLE `deniedCSRs` (
   PRIMARY KEY (`id`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
 
+CREATE TABLE `fqdnSets` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `setHash` varchar(255) NOT NULL,
+  `serial` varchar(255) NOT NULL,
+  `issued` datetime NOT NULL,
+  `expires` datetime NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `setHash_issued_idx` (`setHash`,`issued`) COMMENT 'Used by CountCertificatesByFQDNSet'
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `issuedNames` (
+  `id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `reversedName` varchar(640) NOT NULL,
+  `serial` varchar(255) NOT NULL,
+  `issued` datetime NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `reversedName_issued_idx` (`reversedName`(255),`issued`) COMMENT 'Used by CountCertificatesByNames',
+  KEY `serial_idx` (`serial`) COMMENT 'Used by CountNamesByRegistration'
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
 CREATE TABLE `ocspResponses` (
   `id` int(11) NOT NULL AUTO_INCREMENT,
   `serial` varchar(255) NOT NULL,
@@ -80,17 +107,32 @@ CREATE TABLE `ocspResponses` (
   KEY `SERIAL` (`serial`) COMMENT 'Actual lookup mechanism'
 ) ENGINE=InnoDB AUTO_INCREMENT=27 DEFAULT CHARSET=utf8;
 
-CREATE TABLE `pending_authz` (
+CREATE TABLE `orders` (
   `id` varchar(255) NOT NULL,
+  `registrationID` bigint(20) DEFAULT NULL,
+  `status` varchar(255) DEFAULT NULL,
+  `expires` datetime DEFAULT NULL,
+  `identifiers` varchar(1536) DEFAULT NULL,
+  `authorizations` varchar(1536) DEFAULT NULL,
+  `certificateSerial` varchar(255) DEFAULT NULL,
+  `LockCol` bigint(20) DEFAULT NULL,
+  `processingStarted` datetime DEFAULT NULL,
+  PRIMARY KEY (`id`),
+  CONSTRAINT `regId_orders` FOREIGN KEY (`registrationID`) REFERENCES `registrations` (`id`) ON DELETE NO ACTION ON UPDATE NO ACTION
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE `pending_authz` (
+  `id` varchar(255) COLLATE utf8_bin NOT NULL,
   `identifier` varchar(255) DEFAULT NULL,
   `registrationID` bigint(20) DEFAULT NULL,
   `status` varchar(255) DEFAULT NULL,
   `expires` datetime DEFAULT NULL,
-  `challenges` varchar(1536) DEFAULT NULL,
+  `challenges` varchar(4096) DEFAULT NULL,
   `combinations` varchar(255) DEFAULT NULL,
   `LockCol` bigint(20) DEFAULT NULL,
   PRIMARY KEY (`id`),
-  KEY `regId_idx` (`registrationID`),
+  KEY `regId_idx` (`registrationID`,`id`) COMMENT 'Used by GetAuthorizationIDsByRegistration',
+  KEY `regId_identifier_status_idx` (`registrationID`,`identifier`,`status`) COMMENT 'Used by GetLatestAuthorization',
   CONSTRAINT `regId_pending_authz` FOREIGN KEY (`registrationID`) REFERENCES `registrations` (`id`) ON DELETE NO ACTION ON UPDATE NO ACTION
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
 
@@ -0,0 +1,102 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package mocks
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/letsencrypt/boulder/core"
+)
+
+// DNSChallengeToken and DNSChallengeKeyAuthorization are the token and key
+// authorization of the DNS challenge provisioned in the mock DNS at good.test.
+const (
+	DNSChallengeToken            = "LoqXcYV8q5ONbJQxbmR7SCTNo3tiAXDfowyjxAjEuX0"
+	DNSChallengeKeyAuthorization = DNSChallengeToken + ".9jg46WB3rR_AHD-EBXdN7cBkH1WOu0tA3M9fm21mqTI"
+)
+
+// MockDNS is a core.DNSResolver with canned answers:
+//
+// * nxdomain.letsencrypt.org doesn't exist
+// * servfail.letsencrypt.org, and DNS challenges for it, can't be resolved
+// * every other name resolves to 127.0.0.1
+// * letsencrypt.org and example.com have MX records
+// * reserved.com has CAA records only allowing symantec.com to issue,
+//   critical.com a critical record with an unknown property, present.com
+//   one allowing letsencrypt.org to issue, and forbidden.com one allowing
+//   nobody to
+// * _acme-challenge.good.test has a TXT record holding the digest of
+//   DNSChallengeKeyAuthorization,
+//   and _acme-challenge.wrong.test one holding something else
+type MockDNS struct {
+}
+
+func nxdomain(name string) error {
+	return &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func servfail(name string) error {
+	return &net.DNSError{Err: "server returned rcode 2", Name: name, IsTemporary: true}
+}
+
+// LookupHost is a mock
+func (mock *MockDNS) LookupHost(hostname string) ([]net.IP, time.Duration, error) {
+	switch strings.TrimSuffix(hostname, ".") {
+	case "nxdomain.letsencrypt.org":
+		return nil, 0, nxdomain(hostname)
+	case "servfail.letsencrypt.org":
+		return nil, 0, servfail(hostname)
+	}
+	return []net.IP{net.ParseIP("127.0.0.1")}, 0, nil
+}
+
+// LookupTXT is a mock
+func (mock *MockDNS) LookupTXT(hostname string) ([]string, time.Duration, error) {
+	switch strings.TrimSuffix(hostname, ".") {
+	case "_acme-challenge.good.test":
+		return []string{"something else", core.Fingerprint256([]byte(DNSChallengeKeyAuthorization))}, 0, nil
+	case "_acme-challenge.wrong.test":
+		return []string{"something else"}, 0, nil
+	case "servfail.letsencrypt.org", "_acme-challenge.servfail.letsencrypt.org":
+		return nil, 0, servfail(hostname)
+	}
+	return nil, 0, nxdomain(hostname)
+}
+
+// LookupMX is a mock
+func (mock *MockDNS) LookupMX(domain string) ([]string, time.Duration, error) {
+	switch strings.TrimSuffix(domain, ".") {
+	case "letsencrypt.org", "example.com":
+		return []string{"mail." + domain}, 0, nil
+	case "nxdomain.letsencrypt.org":
+		return nil, 0, nxdomain(domain)
+	case "servfail.letsencrypt.org":
+		return nil, 0, servfail(domain)
+	}
+	return nil, 0, nil
+}
+
+// LookupCAA is a mock
+func (mock *MockDNS) LookupCAA(domain string) ([]*core.CAA, time.Duration, error) {
+	switch strings.TrimSuffix(domain, ".") {
+	case "reserved.com":
+		return []*core.CAA{{Tag: "issue", Value: "symantec.com"}}, 0, nil
+	case "critical.com":
+		return []*core.CAA{{Flag: 128, Tag: "tbs", Value: "Unknown"}}, 0, nil
+	case "present.com":
+		return []*core.CAA{
+			{Tag: "issue", Value: "letsencrypt.org; account=123"},
+			{Tag: "iodef", Value: "mailto:security@present.com"},
+		}, 0, nil
+	case "forbidden.com":
+		return []*core.CAA{{Tag: "issue", Value: ";"}}, 0, nil
+	case "servfail.letsencrypt.org":
+		return nil, 0, servfail(domain)
+	}
+	return nil, 0, nil
+}
@@ -0,0 +1,182 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package nonce
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/letsencrypt/boulder/core"
+)
+
+const (
+	// MaxUsed is the default number of used nonces that are remembered
+	// before the oldest ones are forgotten and the window moves forward.
+	MaxUsed = 65536
+	// MaxAge is the default time for which an issued nonce will be accepted.
+	MaxAge = 15 * time.Minute
+
+	nonceLen     = 40
+	gcmNonceLen  = 12
+	randomPrefix = 8
+)
+
+// NonceService generates, redeems and keeps track of anti-replay nonces.
+//
+// A nonce is the AES-GCM encryption of a random identifier and an issuance
+// time under the service's key. This means that nothing needs to be stored
+// for nonces that have been issued but not yet used. Services given the same
+// key (e.g., every WFE behind a load balancer) accept each other's nonces,
+// and a service keeps accepting the nonces it issued before a restart. Each
+// service only remembers the nonces used with it, though, so a nonce can be
+// used once with each service that shares its key.
+//
+// Used nonces are remembered until there are more than maxUsed of them, at
+// which point the oldest ones are forgotten and every nonce issued no later
+// than them is rejected, so memory use is bounded. Nonces older than maxAge
+// are rejected regardless.
+type NonceService struct {
+	mu       sync.Mutex
+	earliest int64
+	used     map[int64]int64
+	gcm      cipher.AEAD
+	maxUsed  int
+	maxAge   time.Duration
+}
+
+// NewNonceService constructs a NonceService with the given AES key, which
+// must be 16, 24 or 32 bytes long, and the default limits. If key is empty, a
+// fresh random key is used, and only this service will accept its nonces.
+func NewNonceService(key []byte) (*NonceService, error) {
+	if len(key) == 0 {
+		key = make([]byte, 16)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NonceService{
+		used:    make(map[int64]int64, MaxUsed),
+		gcm:     gcm,
+		maxUsed: MaxUsed,
+		maxAge:  MaxAge,
+	}, nil
+}
+
+func (ns *NonceService) encrypt(id int64, issued time.Time) (string, error) {
+	// Only the last eight bytes of the GCM nonce are random; the first four
+	// are always zero so that they do not need to be sent.
+	gcmNonce := make([]byte, gcmNonceLen)
+	if _, err := rand.Read(gcmNonce[gcmNonceLen-randomPrefix:]); err != nil {
+		return "", err
+	}
+
+	pt := make([]byte, 16)
+	binary.BigEndian.PutUint64(pt[:8], uint64(id))
+	binary.BigEndian.PutUint64(pt[8:], uint64(issued.Unix()))
+
+	ret := make([]byte, 0, nonceLen)
+	ret = append(ret, gcmNonce[gcmNonceLen-randomPrefix:]...)
+	ret = ns.gcm.Seal(ret, gcmNonce, pt, nil)
+	return core.B64enc(ret), nil
+}
+
+func (ns *NonceService) decrypt(nonce string) (int64, time.Time, error) {
+	decoded, err := core.B64dec(nonce)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	if len(decoded) != nonceLen {
+		return 0, time.Time{}, errors.New("Incorrect nonce length")
+	}
+
+	gcmNonce := make([]byte, gcmNonceLen)
+	copy(gcmNonce[gcmNonceLen-randomPrefix:], decoded[:randomPrefix])
+	pt, err := ns.gcm.Open(nil, gcmNonce, decoded[randomPrefix:], nil)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	id := int64(binary.BigEndian.Uint64(pt[:8]))
+	issued := time.Unix(int64(binary.BigEndian.Uint64(pt[8:])), 0)
+	return id, issued, nil
+}
+
+// Nonce provides a new nonce.
+func (ns *NonceService) Nonce() (string, error) {
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", err
+	}
+	return ns.encrypt(int64(binary.BigEndian.Uint64(idBytes)), time.Now())
+}
+
+// Valid determines whether the provided nonce was issued under this service's
+// key, has not expired and has not been used with this service before, and
+// marks it as used.
+func (ns *NonceService) Valid(nonce string) bool {
+	id, issued, err := ns.decrypt(nonce)
+	if err != nil {
+		return false
+	}
+	if time.Since(issued) > ns.maxAge {
+		return false
+	}
+
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	if _, used := ns.used[id]; used || issued.Unix() <= ns.earliest {
+		return false
+	}
+
+	ns.used[id] = issued.Unix()
+	if len(ns.used) > ns.maxUsed {
+		ns.forgetOldest()
+	}
+	return true
+}
+
+// forgetOldest moves the window forward to the issuance time of the oldest
+// used nonces, which no longer need to be remembered since everything issued
+// no later than the window is rejected anyway. Must be called with ns.mu
+// held.
+func (ns *NonceService) forgetOldest() {
+	issued := make([]int64, 0, len(ns.used))
+	for _, t := range ns.used {
+		issued = append(issued, t)
+	}
+	sort.Sort(int64Slice(issued))
+
+	// Forget an eighth of the remembered nonces at once so that the sort is
+	// not repeated on every request once the service is full.
+	ns.earliest = issued[len(issued)/8]
+	for id, t := range ns.used {
+		if t <= ns.earliest {
+			delete(ns.used, id)
+		}
+	}
+}
+
+type int64Slice []int64
+
+func (s int64Slice) Len() int           { return len(s) }
+func (s int64Slice) Less(i, j int) bool { return s[i] < s[j] }
+func (s int64Slice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
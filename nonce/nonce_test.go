@@ -0,0 +1,106 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package nonce
+
+import (
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestValidNonce(t *testing.T) {
+	ns, err := NewNonceService(nil)
+	test.AssertNotError(t, err, "Could not create nonce service")
+	n, err := ns.Nonce()
+	test.AssertNotError(t, err, "Could not create nonce")
+	test.Assert(t, ns.Valid(n), "Did not recognize fresh nonce")
+}
+
+func TestAlreadyUsed(t *testing.T) {
+	ns, err := NewNonceService(nil)
+	test.AssertNotError(t, err, "Could not create nonce service")
+	n, err := ns.Nonce()
+	test.AssertNotError(t, err, "Could not create nonce")
+	test.Assert(t, ns.Valid(n), "Did not recognize fresh nonce")
+	test.Assert(t, !ns.Valid(n), "Recognized the same nonce twice")
+}
+
+func TestRejectMalformed(t *testing.T) {
+	ns, err := NewNonceService(nil)
+	test.AssertNotError(t, err, "Could not create nonce service")
+	n, err := ns.Nonce()
+	test.AssertNotError(t, err, "Could not create nonce")
+	test.Assert(t, !ns.Valid("asdf"+n), "Accepted an invalid nonce")
+	test.Assert(t, !ns.Valid("!!!"), "Accepted a non-base64 nonce")
+	test.Assert(t, !ns.Valid(""), "Accepted an empty nonce")
+}
+
+func TestRejectTampered(t *testing.T) {
+	ns, err := NewNonceService(nil)
+	test.AssertNotError(t, err, "Could not create nonce service")
+	n, err := ns.Nonce()
+	test.AssertNotError(t, err, "Could not create nonce")
+	decoded, err := core.B64dec(n)
+	test.AssertNotError(t, err, "Could not decode nonce")
+	decoded[len(decoded)-1] ^= 1
+	test.Assert(t, !ns.Valid(core.B64enc(decoded)), "Accepted a tampered nonce")
+}
+
+func TestRejectFromOtherService(t *testing.T) {
+	ns1, err := NewNonceService(nil)
+	test.AssertNotError(t, err, "Could not create nonce service")
+	ns2, err := NewNonceService(nil)
+	test.AssertNotError(t, err, "Could not create nonce service")
+	n, err := ns1.Nonce()
+	test.AssertNotError(t, err, "Could not create nonce")
+	test.Assert(t, !ns2.Valid(n), "Accepted a nonce issued by another service")
+}
+
+func TestAcceptFromSharedKey(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	ns1, err := NewNonceService(key)
+	test.AssertNotError(t, err, "Could not create nonce service")
+	ns2, err := NewNonceService(key)
+	test.AssertNotError(t, err, "Could not create nonce service")
+	n, err := ns1.Nonce()
+	test.AssertNotError(t, err, "Could not create nonce")
+	test.Assert(t, ns2.Valid(n), "Did not recognize a nonce issued under the same key")
+	test.Assert(t, !ns2.Valid(n), "Recognized the same nonce twice")
+}
+
+func TestRejectBadKey(t *testing.T) {
+	_, err := NewNonceService([]byte("too short"))
+	test.AssertError(t, err, "Created a nonce service with a key of the wrong length")
+}
+
+func TestRejectExpired(t *testing.T) {
+	ns, err := NewNonceService(nil)
+	test.AssertNotError(t, err, "Could not create nonce service")
+	n, err := ns.encrypt(1, time.Now().Add(-ns.maxAge-time.Minute))
+	test.AssertNotError(t, err, "Could not encrypt nonce")
+	test.Assert(t, !ns.Valid(n), "Accepted an expired nonce")
+}
+
+func TestRejectTooEarly(t *testing.T) {
+	ns, err := NewNonceService(nil)
+	test.AssertNotError(t, err, "Could not create nonce service")
+	ns.maxUsed = 1
+
+	now := time.Now()
+	n0, err := ns.encrypt(0, now.Add(-2*time.Second))
+	test.AssertNotError(t, err, "Could not encrypt nonce")
+	n1, err := ns.encrypt(1, now.Add(-time.Second))
+	test.AssertNotError(t, err, "Could not encrypt nonce")
+	n2, err := ns.encrypt(2, now)
+	test.AssertNotError(t, err, "Could not encrypt nonce")
+
+	test.Assert(t, ns.Valid(n1), "Did not recognize fresh nonce")
+	test.Assert(t, ns.Valid(n2), "Did not recognize fresh nonce")
+	test.Assert(t, !ns.Valid(n0), "Accepted a nonce below the window")
+	test.AssertEquals(t, len(ns.used), 1)
+}
@@ -61,6 +61,23 @@ func suffixMatch(labels []string, suffixSet map[string]bool, properSuffix bool)
 	return false
 }
 
+// RegisteredDomain returns the domain that the given name was registered
+// under: the longest public suffix the name ends in, plus one more label.
+// Names that don't end in a public suffix, or are one, have no registered
+// domain.
+func RegisteredDomain(name string) (string, error) {
+	labels := strings.Split(strings.ToLower(name), ".")
+	for i := range labels {
+		if publicSuffixList[strings.Join(labels[i:], ".")] {
+			if i == 0 {
+				return "", NonPublicError
+			}
+			return strings.Join(labels[i-1:], "."), nil
+		}
+	}
+	return "", NonPublicError
+}
+
 var InvalidIdentifierError = errors.New("Invalid identifier type")
 var SyntaxError = errors.New("Syntax error")
 var NonPublicError = errors.New("Name does not end in a public suffix")
@@ -145,10 +162,16 @@ func (pa PolicyAuthorityImpl) ChallengesFor(identifier core.AcmeIdentifier) (cha
 	challenges = []core.Challenge{
 		core.SimpleHTTPSChallenge(),
 		core.DvsniChallenge(),
+		core.DNSChallenge(),
+		core.HTTP01Challenge(),
+		core.TLSALPN01Challenge(),
 	}
 	combinations = [][]int{
 		[]int{0},
 		[]int{1},
+		[]int{2},
+		[]int{3},
+		[]int{4},
 	}
 	return
 }
@@ -134,11 +134,37 @@ func TestChallengesFor(t *testing.T) {
 
 	challenges, combinations := pa.ChallengesFor(core.AcmeIdentifier{})
 
-	if len(challenges) != 2 || challenges[0].Type != core.ChallengeTypeSimpleHTTPS ||
-		challenges[1].Type != core.ChallengeTypeDVSNI {
+	if len(challenges) != 5 || challenges[0].Type != core.ChallengeTypeSimpleHTTPS ||
+		challenges[1].Type != core.ChallengeTypeDVSNI || challenges[2].Type != core.ChallengeTypeDNS ||
+		challenges[3].Type != core.ChallengeTypeHTTP01 || challenges[4].Type != core.ChallengeTypeTLSALPN01 {
 		t.Error("Incorrect challenges returned")
 	}
-	if len(combinations) != 2 || combinations[0][0] != 0 || combinations[1][0] != 1 {
+	if len(combinations) != 5 || combinations[0][0] != 0 || combinations[1][0] != 1 ||
+		combinations[2][0] != 2 || combinations[3][0] != 3 || combinations[4][0] != 4 {
 		t.Error("Incorrect combinations returned")
 	}
 }
+
+func TestRegisteredDomain(t *testing.T) {
+	testCases := map[string]string{
+		"example.com":            "example.com",
+		"www.Example.com":        "example.com",
+		"a.b.example.co.uk":      "example.co.uk",
+		"my-app.appspot.com":     "my-app.appspot.com",
+		"www.my-app.appspot.com": "my-app.appspot.com",
+	}
+	for name, expected := range testCases {
+		domain, err := RegisteredDomain(name)
+		if err != nil {
+			t.Errorf("Error getting registered domain of %s: %s", name, err)
+		} else if domain != expected {
+			t.Errorf("Registered domain of %s was %s, expected %s", name, domain, expected)
+		}
+	}
+
+	for _, name := range []string{"com", "co.uk", "example.invalid-tld"} {
+		if _, err := RegisteredDomain(name); err != NonPublicError {
+			t.Errorf("Expected NonPublicError for %s, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package ra
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/policy"
+)
+
+// A RateLimitPolicy caps how many of something may happen within a sliding
+// window.  A policy with a zero Threshold is disabled.
+type RateLimitPolicy struct {
+	// The most that may happen within Window
+	Threshold int
+
+	// How far back to count, e.g. "168h"
+	Window core.ConfigDuration
+
+	// Registration IDs, and for policies counted per domain or per IP also
+	// registered domains or IP addresses, that the policy doesn't apply to
+	Exempt []string
+}
+
+// Enabled reports whether the policy should be checked at all.
+func (p RateLimitPolicy) Enabled() bool {
+	return p.Threshold > 0
+}
+
+// isExempt reports whether the policy doesn't apply to the given registration
+// ID or registered domain.
+func (p RateLimitPolicy) isExempt(key string) bool {
+	for _, exempt := range p.Exempt {
+		if strings.EqualFold(exempt, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// RateLimitConfig holds the policies applied to certificate issuance and to
+// the creation of registrations and authorizations.
+type RateLimitConfig struct {
+	// Certificates covering names under a single registered domain
+	CertificatesPerName RateLimitPolicy
+
+	// Certificates covering exactly the same set of names
+	CertificatesPerFQDNSet RateLimitPolicy
+
+	// Distinct names in certificates issued to a single registration
+	NamesPerRegistration RateLimitPolicy
+
+	// Registrations created from a single IP address
+	RegistrationsPerIP RateLimitPolicy
+
+	// Pending authorizations a single registration may hold at once. Window
+	// is only used to tell the client when to try again.
+	PendingAuthorizationsPerAccount RateLimitPolicy
+}
+
+// checkRegistrationRateLimit returns a RateLimitedError if another
+// registration shouldn't be created from the given IP address.
+func (ra *RegistrationAuthorityImpl) checkRegistrationRateLimit(ip net.IP) error {
+	limit := ra.RateLimits.RegistrationsPerIP
+	if !limit.Enabled() || limit.isExempt(ip.String()) {
+		return nil
+	}
+
+	now := time.Now()
+	count, err := ra.SA.CountRegistrationsByIP(ip, now.Add(-limit.Window.Duration))
+	if err != nil {
+		return core.InternalServerError(err.Error())
+	}
+	if count >= int64(limit.Threshold) {
+		return core.NewRateLimitedError(fmt.Sprintf(
+			"Too many registrations from %s: %d in the last %s", ip, count, limit.Window.Duration),
+			now.Add(limit.Window.Duration))
+	}
+	return nil
+}
+
+// checkPendingAuthorizationRateLimit returns a RateLimitedError if the
+// registration already holds as many pending authorizations as it may.
+func (ra *RegistrationAuthorityImpl) checkPendingAuthorizationRateLimit(regID int64) error {
+	limit := ra.RateLimits.PendingAuthorizationsPerAccount
+	if !limit.Enabled() || limit.isExempt(strconv.FormatInt(regID, 10)) {
+		return nil
+	}
+
+	count, err := ra.SA.CountPendingAuthorizations(regID)
+	if err != nil {
+		return core.InternalServerError(err.Error())
+	}
+	if count >= int64(limit.Threshold) {
+		return core.NewRateLimitedError(fmt.Sprintf(
+			"Too many pending authorizations for registration %d: %d outstanding; complete or deactivate some before requesting more",
+			regID, count), time.Now().Add(limit.Window.Duration))
+	}
+	return nil
+}
+
+// checkCertificateRateLimits returns a RateLimitedError if issuing a
+// certificate for the given names to the given registration would exceed any
+// of the configured limits.
+func (ra *RegistrationAuthorityImpl) checkCertificateRateLimits(names []string, regID int64) error {
+	now := time.Now()
+	regKey := strconv.FormatInt(regID, 10)
+
+	limit := ra.RateLimits.CertificatesPerName
+	if limit.Enabled() && !limit.isExempt(regKey) {
+		var domains []string
+		seen := map[string]bool{}
+		for _, name := range names {
+			domain, err := policy.RegisteredDomain(name)
+			if err != nil {
+				// WillingToIssue has already turned away names without a
+				// public suffix, so count these by themselves
+				domain = strings.ToLower(name)
+			}
+			if seen[domain] || limit.isExempt(domain) {
+				continue
+			}
+			seen[domain] = true
+			domains = append(domains, domain)
+		}
+
+		if len(domains) > 0 {
+			counts, err := ra.SA.CountCertificatesByNames(domains, now.Add(-limit.Window.Duration))
+			if err != nil {
+				return core.InternalServerError(err.Error())
+			}
+			for _, domain := range domains {
+				if counts[domain] >= int64(limit.Threshold) {
+					return core.NewRateLimitedError(fmt.Sprintf(
+						"Too many certificates already issued for %s", domain), now.Add(limit.Window.Duration))
+				}
+			}
+		}
+	}
+
+	limit = ra.RateLimits.CertificatesPerFQDNSet
+	if limit.Enabled() && !limit.isExempt(regKey) {
+		count, err := ra.SA.CountCertificatesByFQDNSet(names, now.Add(-limit.Window.Duration))
+		if err != nil {
+			return core.InternalServerError(err.Error())
+		}
+		if count >= int64(limit.Threshold) {
+			return core.NewRateLimitedError(fmt.Sprintf(
+				"Too many certificates already issued for exact set of names: %s", strings.Join(names, ", ")),
+				now.Add(limit.Window.Duration))
+		}
+	}
+
+	limit = ra.RateLimits.NamesPerRegistration
+	if limit.Enabled() && !limit.isExempt(regKey) {
+		count, err := ra.SA.CountNamesByRegistration(regID, now.Add(-limit.Window.Duration))
+		if err != nil {
+			return core.InternalServerError(err.Error())
+		}
+		if count+int64(len(names)) > int64(limit.Threshold) {
+			return core.NewRateLimitedError(fmt.Sprintf(
+				"Too many names in certificates issued to registration %d", regID), now.Add(limit.Window.Duration))
+		}
+	}
+
+	return nil
+}
@@ -13,10 +13,12 @@ import (
 	"net/mail"
 	"net/url"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/square/go-jose"
 	"github.com/letsencrypt/boulder/core"
 	blog "github.com/letsencrypt/boulder/log"
 	"github.com/letsencrypt/boulder/policy"
@@ -31,15 +33,62 @@ type RegistrationAuthorityImpl struct {
 	PA  core.PolicyAuthority
 	log *blog.AuditLogger
 
+	// Used to check that contact email domains can receive mail
+	DNSResolver core.DNSResolver
+
 	AuthzBase  string
 	MaxKeySize int
+
+	// URL of the current subscriber agreement, which registrations must have
+	// agreed to before they can get authorizations or certificates
+	SubscriberAgreementURL string
+
+	// NewAuthorization hands back a registration's existing valid or pending
+	// authorization for an identifier, rather than creating a new one, as long
+	// as it remains valid for at least this long.  Zero disables reuse.
+	AuthzReuseWindow time.Duration
+
+	// How long a successfully validated authorization can be used for
+	AuthorizationLifetime time.Duration
+
+	// How long a client has to complete a new authorization's challenges
+	PendingAuthorizationLifetime time.Duration
+
+	// How long a client has to finalize an order once it has been created
+	OrderLifetime time.Duration
+
+	// How long an order can be left processing before another attempt to
+	// finalize it is allowed, in case the one that started died before it
+	// could record its outcome
+	OrderProcessingTimeout time.Duration
+
+	// Limits on how many certificates may be issued
+	RateLimits RateLimitConfig
 }
 
+// Default authorization and order lifetimes, used unless configured otherwise
+const (
+	DefaultAuthorizationLifetime        = 30 * 24 * time.Hour
+	DefaultPendingAuthorizationLifetime = 7 * 24 * time.Hour
+	DefaultOrderLifetime                = 7 * 24 * time.Hour
+	DefaultOrderProcessingTimeout       = time.Hour
+)
+
+// How many more times FinalizeOrder tries to record an issued certificate in
+// its order before giving up
+const orderUpdateRetries = 2
+
 func NewRegistrationAuthorityImpl() RegistrationAuthorityImpl {
 	logger := blog.GetAuditLogger()
 	logger.Notice("Registration Authority Starting")
 
-	ra := RegistrationAuthorityImpl{log: logger}
+	ra := RegistrationAuthorityImpl{
+		log:                          logger,
+		AuthorizationLifetime:        DefaultAuthorizationLifetime,
+		PendingAuthorizationLifetime: DefaultPendingAuthorizationLifetime,
+		OrderLifetime:                DefaultOrderLifetime,
+		OrderProcessingTimeout:       DefaultOrderProcessingTimeout,
+	}
 	ra.PA = policy.NewPolicyAuthorityImpl()
 	return ra
 }
@@ -50,27 +99,55 @@ func lastPathSegment(url core.AcmeURL) string {
 	return allButLastPathSegment.ReplaceAllString(url.Path, "")
 }
 
-func validateEmail(address string) (err error) {
+func validateEmail(address string, resolver core.DNSResolver) (err error) {
 	_, err = mail.ParseAddress(address)
 	if err != nil {
-		err = core.MalformedRequestError(err.Error())
+		err = core.InvalidEmailError(err.Error())
 		return
 	}
 	splitEmail := strings.SplitN(address, "@", -1)
 	domain := strings.ToLower(splitEmail[len(splitEmail)-1])
-	var mx []*net.MX
-	mx, err = net.LookupMX(domain)
+	var mx []string
+	mx, _, err = resolver.LookupMX(domain)
+	if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+		err = core.InvalidEmailError(fmt.Sprintf("Domain %s does not exist", domain))
+		return
+	}
 	if err != nil {
 		err = core.InternalServerError(err.Error())
 		return
 	}
 	if len(mx) == 0 {
-		err = core.MalformedRequestError(fmt.Sprintf("No MX record for domain %s", domain))
+		err = core.InvalidEmailError(fmt.Sprintf("No MX record for domain %s", domain))
 		return
 	}
 	return
 }
 
+// checkAgreement returns an error unless the registration has agreed to the
+// current version of the subscriber agreement.
+func (ra *RegistrationAuthorityImpl) checkAgreement(reg core.Registration) error {
+	if reg.Agreement != ra.SubscriberAgreementURL {
+		return core.AgreementRequiredError(fmt.Sprintf("Must agree to the current subscriber agreement [%s]", ra.SubscriberAgreementURL))
+	}
+	return nil
+}
+
+// checkCAARecords returns an error unless the CAA records for every name
+// allow us to issue for it.
+func (ra *RegistrationAuthorityImpl) checkCAARecords(names []string) error {
+	for _, name := range names {
+		_, valid, err := ra.VA.CheckCAARecords(core.AcmeIdentifier{Type: core.IdentifierDNS, Value: name})
+		if err != nil {
+			return err
+		}
+		if !valid {
+			return core.UnauthorizedError(fmt.Sprintf("CAA records for %s forbid issuance", name))
+		}
+	}
+	return nil
+}
+
 type certificateRequestEvent struct {
 	ID                  string    `json:",omitempty"`
 	Requester           int64     `json:",omitempty"`
@@ -91,9 +168,15 @@ func (ra *RegistrationAuthorityImpl) NewRegistration(init core.Registration) (re
 	if err = core.GoodKey(init.Key.Key, ra.MaxKeySize); err != nil {
 		return core.Registration{}, core.MalformedRequestError(fmt.Sprintf("Invalid public key: %s", err.Error()))
 	}
+	if err = ra.checkRegistrationRateLimit(init.InitialIP); err != nil {
+		return core.Registration{}, err
+	}
 	reg = core.Registration{
 		RecoveryToken: core.NewToken(),
 		Key:           init.Key,
+		Status:        core.StatusValid,
+		InitialIP:     init.InitialIP,
+		CreatedAt:     time.Now(),
 	}
 	reg.MergeUpdate(init)
 
@@ -102,7 +185,7 @@ func (ra *RegistrationAuthorityImpl) NewRegistration(init core.Registration) (re
 		case "tel":
 			continue
 		case "mailto":
-			err = validateEmail(contact.Opaque)
+			err = validateEmail(contact.Opaque, ra.DNSResolver)
 			if err != nil {
 				return
 			}
@@ -115,19 +198,57 @@ func (ra *RegistrationAuthorityImpl) NewRegistration(init core.Registration) (re
 	// Store the authorization object, then return it
 	reg, err = ra.SA.NewRegistration(reg)
 	if err != nil {
-		err = core.InternalServerError(err.Error())
+		if _, ok := err.(core.MalformedRequestError); !ok {
+			// Anything but the key having been taken in the meantime
+			err = core.InternalServerError(err.Error())
+		}
 	}
 
 	return
 }
 
+// reusableAuthorization looks for an authorization the registration already
+// holds for the identifier that NewAuthorization can hand back, preferring a
+// valid one to a pending one.
+func (ra *RegistrationAuthorityImpl) reusableAuthorization(regID int64, identifier core.AcmeIdentifier) (core.Authorization, bool) {
+	if ra.AuthzReuseWindow <= 0 {
+		return core.Authorization{}, false
+	}
+
+	cutoff := time.Now().Add(ra.AuthzReuseWindow)
+	for _, status := range []core.AcmeStatus{core.StatusValid, core.StatusPending} {
+		authz, err := ra.SA.GetLatestAuthorization(regID, identifier, status)
+		if err != nil {
+			// Either there isn't one, or we couldn't look; in both cases the
+			// right thing is to fall back to a new authorization
+			continue
+		}
+		if authz.Expires.After(cutoff) {
+			ra.log.Debug(fmt.Sprintf("Reusing %s authorization %s for registration %d", status, authz.ID, regID))
+			return authz, true
+		}
+	}
+	return core.Authorization{}, false
+}
+
 func (ra *RegistrationAuthorityImpl) NewAuthorization(request core.Authorization, regID int64) (authz core.Authorization, err error) {
 	if regID <= 0 {
 		err = core.InternalServerError("Invalid registration ID")
 		return authz, err
 	}
 
+	registration, err := ra.SA.GetRegistration(regID)
+	if err != nil {
+		return authz, err
+	}
+	if err = ra.checkAgreement(registration); err != nil {
+		return authz, err
+	}
+
+	// Names are stored in lower case, so that an authorization is found and
+	// reused however the client capitalizes its name
 	identifier := request.Identifier
+	identifier.Value = strings.ToLower(identifier.Value)
 
 	// Check that the identifier is present and appropriate
 	if err = ra.PA.WillingToIssue(identifier); err != nil {
@@ -135,6 +256,14 @@ func (ra *RegistrationAuthorityImpl) NewAuthorization(request core.Authorization
 		return authz, err
 	}
 
+	if existing, ok := ra.reusableAuthorization(regID, identifier); ok {
+		return existing, nil
+	}
+
+	if err = ra.checkPendingAuthorizationRateLimit(regID); err != nil {
+		return authz, err
+	}
+
 	// Create validations, but we have to update them with URIs later
 	challenges, combinations := ra.PA.ChallengesFor(identifier)
 
@@ -143,6 +272,7 @@ func (ra *RegistrationAuthorityImpl) NewAuthorization(request core.Authorization
 		Identifier:     identifier,
 		RegistrationID: regID,
 		Status:         core.StatusPending,
+		Expires:        time.Now().Add(ra.PendingAuthorizationLifetime),
 		Combinations:   combinations,
 	}
 
@@ -207,12 +337,16 @@ func (ra *RegistrationAuthorityImpl) NewCertificate(req core.CertificateRequest,
 		logEvent.Error = err.Error()
 		return emptyCert, err
 	}
+	if err = ra.checkAgreement(registration); err != nil {
+		logEvent.Error = err.Error()
+		return emptyCert, err
+	}
 
 	// Verify the CSR
 	csr := req.CSR
 	if err = core.VerifyCSR(csr); err != nil {
 		logEvent.Error = err.Error()
-		err = core.UnauthorizedError("Invalid signature on CSR")
+		err = core.BadCSRError("Invalid signature on CSR")
 		return emptyCert, err
 	}
 
@@ -227,7 +361,7 @@ func (ra *RegistrationAuthorityImpl) NewCertificate(req core.CertificateRequest,
 	}
 
 	if len(names) == 0 {
-		err = core.UnauthorizedError("CSR has no names in it")
+		err = core.BadCSRError("CSR has no names in it")
 		logEvent.Error = err.Error()
 		return emptyCert, err
 	}
@@ -244,7 +378,7 @@ func (ra *RegistrationAuthorityImpl) NewCertificate(req core.CertificateRequest,
 	}
 
 	if core.KeyDigestEquals(csr.PublicKey, registration.Key) {
-		err = core.MalformedRequestError("Certificate public key must be different than account key")
+		err = core.BadCSRError("Certificate public key must be different than account key")
 		return emptyCert, err
 	}
 
@@ -297,9 +431,30 @@ func (ra *RegistrationAuthorityImpl) NewCertificate(req core.CertificateRequest,
 	// Mark that we verified the CN and SANs
 	logEvent.VerifiedFields = []string{"subject.commonName", "subjectAltName"}
 
+	lowerNames := make([]string, len(names))
+	for i, name := range names {
+		lowerNames[i] = strings.ToLower(name)
+	}
+	uniqueNames := core.UniqueNames(lowerNames)
+	sort.Strings(uniqueNames)
+	if err = ra.checkCertificateRateLimits(uniqueNames, regID); err != nil {
+		logEvent.Error = err.Error()
+		return emptyCert, err
+	}
+
+	if err = ra.checkCAARecords(uniqueNames); err != nil {
+		logEvent.Error = err.Error()
+		return emptyCert, err
+	}
+
 	// Create the certificate and log the result
 	if cert, err = ra.CA.IssueCertificate(*csr, regID, earliestExpiry); err != nil {
-		err = core.InternalServerError(err.Error())
+		switch err.(type) {
+		case core.BadCSRError, core.UnauthorizedError:
+			// The CA refused the CSR itself; tell the subscriber why
+		default:
+			err = core.InternalServerError(err.Error())
+		}
 		logEvent.Error = err.Error()
 		return emptyCert, err
 	}
@@ -327,6 +482,175 @@ func (ra *RegistrationAuthorityImpl) NewCertificate(req core.CertificateRequest,
 	return cert, nil
 }
 
+func (ra *RegistrationAuthorityImpl) NewOrder(request core.Order, regID int64) (order core.Order, err error) {
+	if regID <= 0 {
+		err = core.InternalServerError("Invalid registration ID")
+		return order, err
+	}
+
+	registration, err := ra.SA.GetRegistration(regID)
+	if err != nil {
+		return order, err
+	}
+	if err = ra.checkAgreement(registration); err != nil {
+		return order, err
+	}
+
+	if len(request.Identifiers) == 0 {
+		err = core.MalformedRequestError("Order has no identifiers in it")
+		return order, err
+	}
+
+	// Check every identifier before creating any authorizations, so that a
+	// bad name doesn't leave stray pending authorizations behind
+	names := make([]string, 0, len(request.Identifiers))
+	seen := map[string]bool{}
+	identifiers := make([]core.AcmeIdentifier, 0, len(request.Identifiers))
+	for _, identifier := range request.Identifiers {
+		identifier.Value = strings.ToLower(identifier.Value)
+		if seen[identifier.Value] {
+			continue
+		}
+		seen[identifier.Value] = true
+
+		if err = ra.PA.WillingToIssue(identifier); err != nil {
+			err = core.UnauthorizedError(err.Error())
+			return order, err
+		}
+		identifiers = append(identifiers, identifier)
+		names = append(names, identifier.Value)
+	}
+
+	// Reuse any valid authorizations the registration already holds, and
+	// create pending ones for the rest
+	existing, err := ra.SA.GetValidAuthorizations(regID, names, time.Now())
+	if err != nil {
+		err = core.InternalServerError(err.Error())
+		return order, err
+	}
+
+	authzIDs := make([]string, 0, len(identifiers))
+	for _, identifier := range identifiers {
+		if authz, ok := existing[identifier.Value]; ok {
+			authzIDs = append(authzIDs, authz.ID)
+			continue
+		}
+
+		var authz core.Authorization
+		authz, err = ra.NewAuthorization(core.Authorization{Identifier: identifier}, regID)
+		if err != nil {
+			return order, err
+		}
+		authzIDs = append(authzIDs, authz.ID)
+	}
+
+	order = core.Order{
+		RegistrationID: regID,
+		Status:         core.StatusPending,
+		Expires:        time.Now().Add(ra.OrderLifetime),
+		Identifiers:    identifiers,
+		Authorizations: authzIDs,
+	}
+
+	order, err = ra.SA.NewOrder(order)
+	if err != nil {
+		err = core.InternalServerError(err.Error())
+	}
+	return order, err
+}
+
+func (ra *RegistrationAuthorityImpl) FinalizeOrder(base core.Order, csr x509.CertificateRequest) (order core.Order, err error) {
+	order = base
+	// A processing order may have been left that way by a finalization that
+	// died; SetOrderProcessing decides whether it's been long enough to retry
+	if order.Status != core.StatusPending && order.Status != core.StatusProcessing {
+		err = core.MalformedRequestError(fmt.Sprintf("Order has status %s and cannot be finalized", order.Status))
+		return
+	}
+	if order.Expires.Before(time.Now()) {
+		err = core.MalformedRequestError("Order has expired")
+		return
+	}
+
+	// The CSR must ask for exactly the names in the order
+	csrNames := map[string]bool{}
+	for _, name := range csr.DNSNames {
+		csrNames[strings.ToLower(name)] = true
+	}
+	if len(csr.Subject.CommonName) > 0 {
+		csrNames[strings.ToLower(csr.Subject.CommonName)] = true
+	}
+	orderNames := map[string]bool{}
+	for _, identifier := range order.Identifiers {
+		orderNames[strings.ToLower(identifier.Value)] = true
+	}
+	if len(csrNames) != len(orderNames) {
+		err = core.BadCSRError("CSR names do not match the order's identifiers")
+		return
+	}
+	for name := range csrNames {
+		if !orderNames[name] {
+			err = core.BadCSRError(fmt.Sprintf("CSR contains name %s, which is not in the order", name))
+			return
+		}
+	}
+
+	req := core.CertificateRequest{CSR: &csr}
+	for _, id := range order.Authorizations {
+		// Ignoring these errors because we construct the URLs to be correct
+		authzURL, _ := url.Parse(ra.AuthzBase + id)
+		req.Authorizations = append(req.Authorizations, core.AcmeURL(*authzURL))
+	}
+
+	// Only one finalization of the order gets to move it on to processing and
+	// issue; any others racing with it fail here
+	if err = ra.SA.SetOrderProcessing(order.ID, time.Now().Add(-ra.OrderProcessingTimeout)); err != nil {
+		if _, ok := err.(core.MalformedRequestError); !ok {
+			err = core.InternalServerError(err.Error())
+		}
+		return base, err
+	}
+
+	cert, err := ra.NewCertificate(req, order.RegistrationID)
+	if err != nil {
+		// Nothing was issued, so the order can be finalized again
+		order.Status = core.StatusPending
+		if updateErr := ra.SA.UpdateOrder(order); updateErr != nil {
+			ra.log.Warning(fmt.Sprintf("Couldn't return order %s to pending: %s", order.ID, updateErr))
+		}
+		return base, err
+	}
+
+	// A certificate has been issued, so from here on any failure leaves the
+	// order processing until OrderProcessingTimeout lets it be finalized
+	// again.  Log those at Error level so the order can be fixed by hand.
+	parsedCertificate, err := x509.ParseCertificate([]byte(cert.DER))
+	if err != nil {
+		ra.log.Err(fmt.Sprintf("Couldn't parse certificate %s issued for order %s: %s", cert.Serial, order.ID, err))
+		err = core.InternalServerError(err.Error())
+		return base, err
+	}
+	serial := core.SerialToString(parsedCertificate.SerialNumber)
+
+	order.Status = core.StatusValid
+	order.CertificateSerial = serial
+	for attempt := 0; ; attempt++ {
+		if err = ra.SA.UpdateOrder(order); err == nil {
+			break
+		}
+		// A malformed request means the order isn't processing any more, which
+		// retrying won't change
+		if _, ok := err.(core.MalformedRequestError); ok || attempt >= orderUpdateRetries {
+			ra.log.Err(fmt.Sprintf("Couldn't record certificate %s in order %s: %s", serial, order.ID, err))
+			err = core.InternalServerError(err.Error())
+			return base, err
+		}
+	}
+
+	ra.log.Notice(fmt.Sprintf("Finalized order %s for registration %d", order.ID, order.RegistrationID))
+	return order, nil
+}
+
 func (ra *RegistrationAuthorityImpl) UpdateRegistration(base core.Registration, update core.Registration) (reg core.Registration, err error) {
 	base.MergeUpdate(update)
 	reg = base
@@ -337,7 +661,70 @@ func (ra *RegistrationAuthorityImpl) UpdateRegistration(base core.Registration,
 	return
 }
 
+func (ra *RegistrationAuthorityImpl) UpdateRegistrationKey(base core.Registration, newKey jose.JsonWebKey) (reg core.Registration, err error) {
+	if err = core.GoodKey(newKey.Key, ra.MaxKeySize); err != nil {
+		err = core.MalformedRequestError(fmt.Sprintf("Invalid public key: %s", err.Error()))
+		return
+	}
+
+	if _, err = ra.SA.GetRegistrationByKey(newKey); err == nil {
+		err = core.MalformedRequestError("New key is already in use for a different registration")
+		return
+	}
+
+	reg, err = ra.SA.UpdateRegistrationKey(base, newKey)
+	if err != nil {
+		if _, ok := err.(core.MalformedRequestError); !ok {
+			// Anything but the key having been taken in the meantime
+			err = core.InternalServerError(err.Error())
+		}
+		return
+	}
+
+	ra.log.Notice(fmt.Sprintf("Changed key of registration %d", reg.ID))
+	return
+}
+
+func (ra *RegistrationAuthorityImpl) DeactivateAuthorization(base core.Authorization) (authz core.Authorization, err error) {
+	if base.Status != core.StatusValid && base.Status != core.StatusPending {
+		err = core.MalformedRequestError(fmt.Sprintf("Authorization has status %s and cannot be deactivated", base.Status))
+		return
+	}
+
+	authz, err = ra.SA.DeactivateAuthorization(base.ID)
+	if err != nil {
+		err = core.InternalServerError(err.Error())
+		return
+	}
+
+	ra.log.Notice(fmt.Sprintf("Deactivated authorization %s for registration %d", authz.ID, authz.RegistrationID))
+	return
+}
+
+func (ra *RegistrationAuthorityImpl) DeactivateRegistration(base core.Registration) (reg core.Registration, err error) {
+	if base.Status == core.StatusDeactivated || base.Status == core.StatusRevoked {
+		err = core.MalformedRequestError(fmt.Sprintf("Registration has status %s and cannot be deactivated", base.Status))
+		return
+	}
+
+	reg, err = ra.SA.DeactivateRegistration(base.ID)
+	if err != nil {
+		err = core.InternalServerError(err.Error())
+		return
+	}
+
+	ra.log.Notice(fmt.Sprintf("Deactivated registration %d", reg.ID))
+	return
+}
+
 func (ra *RegistrationAuthorityImpl) UpdateAuthorization(base core.Authorization, challengeIndex int, response core.Challenge) (authz core.Authorization, err error) {
+	// Pending authorizations created before expiry was tracked have no
+	// expiry date; those are still good.
+	if !base.Expires.IsZero() && base.Expires.Before(time.Now()) {
+		err = core.UnauthorizedError("Authorization has expired")
+		return
+	}
+
 	// Copy information over that the client is allowed to supply
 	authz = base
 	if challengeIndex >= len(authz.Challenges) {
@@ -346,6 +733,29 @@ func (ra *RegistrationAuthorityImpl) UpdateAuthorization(base core.Authorization
 	}
 	authz.Challenges[challengeIndex] = authz.Challenges[challengeIndex].MergeResponse(response)
 
+	// The key authorization has to bind the token to the key of the account
+	// that owns the authorization, so check what the client supplied
+	challenge := &authz.Challenges[challengeIndex]
+	switch challenge.Type {
+	case core.ChallengeTypeHTTP01, core.ChallengeTypeTLSALPN01, core.ChallengeTypeDNS:
+		var reg core.Registration
+		reg, err = ra.SA.GetRegistration(authz.RegistrationID)
+		if err != nil {
+			err = core.InternalServerError(err.Error())
+			return
+		}
+		var expected string
+		expected, err = core.KeyAuthorization(challenge.Token, &reg.Key)
+		if err != nil {
+			err = core.InternalServerError(err.Error())
+			return
+		}
+		if challenge.KeyAuthorization != expected {
+			err = core.MalformedRequestError("Key authorization doesn't match the account key")
+			return
+		}
+	}
+
 	// Store the updated version
 	if err = ra.SA.UpdatePendingAuthorization(authz); err != nil {
 		err = core.InternalServerError(err.Error())
@@ -353,14 +763,22 @@ func (ra *RegistrationAuthorityImpl) UpdateAuthorization(base core.Authorization
 	}
 
 	// Dispatch to the VA for service
-	ra.VA.UpdateValidations(authz, challengeIndex)
+	err = ra.VA.UpdateValidations(authz, challengeIndex)
 
 	return
 }
 
-func (ra *RegistrationAuthorityImpl) RevokeCertificate(cert x509.Certificate) (err error) {
+func (ra *RegistrationAuthorityImpl) RevokeCertificate(cert x509.Certificate, reasonCode int) (err error) {
 	serialString := core.SerialToString(cert.SerialNumber)
-	err = ra.CA.RevokeCertificate(serialString, 0)
+	reason, ok := core.RevocationReasons[reasonCode]
+	if !ok {
+		err = core.MalformedRequestError(fmt.Sprintf("Invalid revocation reason code %d", reasonCode))
+		// AUDIT[ Revocation Requests ] 4e85d791-09c0-4ab3-a837-d3d67e945134
+		ra.log.Audit(fmt.Sprintf("Revocation error - %s - %s", serialString, err))
+		return err
+	}
+
+	err = ra.CA.RevokeCertificate(serialString, reasonCode)
 
 	// AUDIT[ Revocation Requests ] 4e85d791-09c0-4ab3-a837-d3d67e945134
 	if err != nil {
@@ -368,7 +786,7 @@ func (ra *RegistrationAuthorityImpl) RevokeCertificate(cert x509.Certificate) (e
 		return err
 	}
 
-	ra.log.Audit(fmt.Sprintf("Revocation - %s", serialString))
+	ra.log.Audit(fmt.Sprintf("Revocation - %s - %s", serialString, reason))
 	return err
 }
 
@@ -399,8 +817,7 @@ func (ra *RegistrationAuthorityImpl) OnValidationUpdate(authz core.Authorization
 	if authz.Status != core.StatusValid {
 		authz.Status = core.StatusInvalid
 	} else {
-		// TODO: Enable configuration of expiry time
-		authz.Expires = time.Now().Add(365 * 24 * time.Hour)
+		authz.Expires = time.Now().Add(ra.AuthorizationLifetime)
 	}
 
 	// Finalize the authorization (error ignored)
@@ -6,6 +6,7 @@
 package rpc
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
@@ -41,6 +42,119 @@ const (
 	AmqpImmediate    = false
 )
 
+// rpcError is the wire representation of an error returned by a handler.
+// Errors are interfaces, so they cannot be unmarshaled directly; instead the
+// name of the core error type is sent along with the message, and the client
+// rebuilds an error of the same type from it.
+type rpcError struct {
+	Value string `json:"value"`
+	Type  string `json:"type,omitempty"`
+
+	// When a rate limited client may try again, if the error says
+	RetryAfter *time.Time `json:"retryAfter,omitempty"`
+}
+
+// rpcResponse is the wire representation of a handler's result.
+type rpcResponse struct {
+	ReturnVal []byte   `json:"returnVal,omitempty"`
+	Error     rpcError `json:"error,omitempty"`
+}
+
+func wrapError(err error) (rpcErr rpcError) {
+	if err == nil {
+		return
+	}
+	rpcErr.Value = err.Error()
+	switch err.(type) {
+	case core.InternalServerError:
+		rpcErr.Type = "InternalServerError"
+	case core.NotSupportedError:
+		rpcErr.Type = "NotSupportedError"
+	case core.MalformedRequestError:
+		rpcErr.Type = "MalformedRequestError"
+	case core.UnauthorizedError:
+		rpcErr.Type = "UnauthorizedError"
+	case core.NotFoundError:
+		rpcErr.Type = "NotFoundError"
+	case core.SyntaxError:
+		rpcErr.Type = "SyntaxError"
+	case core.SignatureValidationError:
+		rpcErr.Type = "SignatureValidationError"
+	case core.CertificateIssuanceError:
+		rpcErr.Type = "CertificateIssuanceError"
+	case core.BadNonceError:
+		rpcErr.Type = "BadNonceError"
+	case core.BadCSRError:
+		rpcErr.Type = "BadCSRError"
+	case core.RateLimitedError:
+		rpcErr.Type = "RateLimitedError"
+		if retryAt, ok := err.(core.RateLimitedError).RetryAfter(); ok {
+			rpcErr.RetryAfter = &retryAt
+		}
+	case core.InvalidEmailError:
+		rpcErr.Type = "InvalidEmailError"
+	case core.ConnectionError:
+		rpcErr.Type = "ConnectionError"
+	case core.DNSError:
+		rpcErr.Type = "DNSError"
+	case core.TLSError:
+		rpcErr.Type = "TLSError"
+	case core.UnknownHostError:
+		rpcErr.Type = "UnknownHostError"
+	case core.AgreementRequiredError:
+		rpcErr.Type = "AgreementRequiredError"
+	}
+	return
+}
+
+func unwrapError(rpcErr rpcError) error {
+	if rpcErr.Value == "" {
+		return nil
+	}
+	switch rpcErr.Type {
+	case "InternalServerError":
+		return core.InternalServerError(rpcErr.Value)
+	case "NotSupportedError":
+		return core.NotSupportedError(rpcErr.Value)
+	case "MalformedRequestError":
+		return core.MalformedRequestError(rpcErr.Value)
+	case "UnauthorizedError":
+		return core.UnauthorizedError(rpcErr.Value)
+	case "NotFoundError":
+		return core.NotFoundError(rpcErr.Value)
+	case "SyntaxError":
+		return core.SyntaxError(rpcErr.Value)
+	case "SignatureValidationError":
+		return core.SignatureValidationError(rpcErr.Value)
+	case "CertificateIssuanceError":
+		return core.CertificateIssuanceError(rpcErr.Value)
+	case "BadNonceError":
+		return core.BadNonceError(rpcErr.Value)
+	case "BadCSRError":
+		return core.BadCSRError(rpcErr.Value)
+	case "RateLimitedError":
+		rateLimited := core.RateLimitedError{Detail: rpcErr.Value}
+		if rpcErr.RetryAfter != nil {
+			rateLimited.RetryAt = *rpcErr.RetryAfter
+		}
+		return rateLimited
+	case "InvalidEmailError":
+		return core.InvalidEmailError(rpcErr.Value)
+	case "ConnectionError":
+		return core.ConnectionError(rpcErr.Value)
+	case "DNSError":
+		return core.DNSError(rpcErr.Value)
+	case "TLSError":
+		return core.TLSError(rpcErr.Value)
+	case "UnknownHostError":
+		return core.UnknownHostError(rpcErr.Value)
+	case "AgreementRequiredError":
+		return core.AgreementRequiredError(rpcErr.Value)
+	default:
+		return errors.New(rpcErr.Value)
+	}
+}
+
 // A simplified way to get a channel for a given AMQP server
 func amqpConnect(url string) (ch *amqp.Channel, err error) {
 	conn, err := amqp.Dial(url)
@@ -111,12 +225,13 @@ func amqpSubscribe(ch *amqp.Channel, name string, log *blog.AuditLogger) (msgs <
 // and returns the response to the ReplyTo queue.
 //
 // To implement specific functionality, using code should use the Handle
-// method to add specific actions.
+// method to add specific actions.  An error returned by a handler is sent
+// back to the client along with the response, keeping its core error type.
 type AmqpRPCServer struct {
 	serverQueue   string
 	channel       *amqp.Channel
 	log           *blog.AuditLogger
-	dispatchTable map[string]func([]byte) []byte
+	dispatchTable map[string]func([]byte) ([]byte, error)
 }
 
 // Create a new AMQP-RPC server on the given queue and channel.
@@ -128,11 +243,11 @@ func NewAmqpRPCServer(serverQueue string, channel *amqp.Channel) *AmqpRPCServer
 		serverQueue:   serverQueue,
 		channel:       channel,
 		log:           log,
-		dispatchTable: make(map[string]func([]byte) []byte),
+		dispatchTable: make(map[string]func([]byte) ([]byte, error)),
 	}
 }
 
-func (rpc *AmqpRPCServer) Handle(method string, handler func([]byte) []byte) {
+func (rpc *AmqpRPCServer) Handle(method string, handler func([]byte) ([]byte, error)) {
 	rpc.dispatchTable[method] = handler
 }
 
@@ -154,7 +269,13 @@ func (rpc *AmqpRPCServer) Start() (err error) {
 				rpc.log.Audit(fmt.Sprintf(" [s<][%s][%s] Misrouted message: %s - %s - %s", rpc.serverQueue, msg.ReplyTo, msg.Type, core.B64enc(msg.Body), msg.CorrelationId))
 				continue
 			}
-			response := cb(msg.Body)
+			result, err := cb(msg.Body)
+			response, err := json.Marshal(rpcResponse{ReturnVal: result, Error: wrapError(err)})
+			if err != nil {
+				// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+				rpc.log.Audit(fmt.Sprintf(" [s>][%s][%s] Could not marshal response: %s - %s", rpc.serverQueue, msg.ReplyTo, err, msg.CorrelationId))
+				continue
+			}
 			rpc.log.Info(fmt.Sprintf(" [s>][%s][%s] replying %s(%s) [%s]", rpc.serverQueue, msg.ReplyTo, msg.Type, core.B64enc(response), msg.CorrelationId))
 			rpc.channel.Publish(
 				AmqpExchange,
@@ -174,13 +295,13 @@ func (rpc *AmqpRPCServer) Start() (err error) {
 // An AMQP-RPC client sends requests to a specific server queue,
 // and uses a dedicated response queue for responses.
 //
-// To implement specific functionality, using code uses the Dispatch()
+// To implement specific functionality, using code uses the DispatchSync()
 // method to send a method name and body, and get back a response. So
 // you end up with wrapper methods of the form:
 //
 // ```
 //   request = /* serialize request to []byte */
-//   response = <-AmqpRPCCLient.Dispatch(method, request)
+//   response, err = AmqpRPCCLient.DispatchSync(method, request)
 //   return /* deserialized response */
 // ```
 //
@@ -188,7 +309,9 @@ func (rpc *AmqpRPCServer) Start() (err error) {
 // and ignore the return value.
 //
 // DispatchSync will manage the channel for you, and also enforce a
-// timeout on the transaction (default 60 seconds)
+// timeout on the transaction (default 60 seconds).  It also unpacks the
+// server's response, returning the handler's error (if any) as a core error
+// of the same type.
 type AmqpRPCCLient struct {
 	serverQueue string
 	clientQueue string
@@ -272,7 +395,13 @@ func (rpc *AmqpRPCCLient) Dispatch(method string, body []byte) chan []byte {
 
 func (rpc *AmqpRPCCLient) DispatchSync(method string, body []byte) (response []byte, err error) {
 	select {
-	case response = <-rpc.Dispatch(method, body):
+	case jsonResponse := <-rpc.Dispatch(method, body):
+		var rpcResponse rpcResponse
+		if err = json.Unmarshal(jsonResponse, &rpcResponse); err != nil {
+			return
+		}
+		response = rpcResponse.ReturnVal
+		err = unwrapError(rpcResponse.Error)
 		return
 	case <-time.After(rpc.timeout):
 		rpc.log.Warning(fmt.Sprintf(" [c!][%s] AMQP-RPC timeout [%s]", rpc.clientQueue, method))
@@ -4,3 +4,50 @@
 // file, You can obtain one at http://mozilla.org/MPL/2.0/.
 
 package rpc
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/test"
+)
+
+func TestWrapError(t *testing.T) {
+	testErrors := []error{
+		core.InternalServerError("foo"),
+		core.NotSupportedError("foo"),
+		core.MalformedRequestError("foo"),
+		core.UnauthorizedError("foo"),
+		core.NotFoundError("foo"),
+		core.SyntaxError("foo"),
+		core.SignatureValidationError("foo"),
+		core.CertificateIssuanceError("foo"),
+		core.BadNonceError("foo"),
+		core.BadCSRError("foo"),
+		core.RateLimitedError{Detail: "foo"},
+		core.InvalidEmailError("foo"),
+		core.ConnectionError("foo"),
+		core.DNSError("foo"),
+		core.TLSError("foo"),
+		core.UnknownHostError("foo"),
+		core.AgreementRequiredError("foo"),
+	}
+	for _, err := range testErrors {
+		test.AssertEquals(t, unwrapError(wrapError(err)), err)
+	}
+
+	// Rate limit errors keep the time the client may retry after
+	retryAt := time.Date(2015, 6, 1, 12, 30, 0, 0, time.UTC)
+	rateLimited, ok := unwrapError(wrapError(core.NewRateLimitedError("foo", retryAt))).(core.RateLimitedError)
+	test.Assert(t, ok, "Rate limit error didn't survive wrapping")
+	test.AssertEquals(t, rateLimited.Detail, "foo")
+	test.Assert(t, rateLimited.RetryAt.Equal(retryAt), "Wrong retry time after wrapping")
+
+	// Errors of other types keep their message
+	err := unwrapError(wrapError(errors.New("bar")))
+	test.AssertEquals(t, err.Error(), "bar")
+
+	test.AssertEquals(t, unwrapError(wrapError(nil)), nil)
+}
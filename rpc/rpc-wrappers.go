@@ -11,6 +11,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"time"
 
 	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/square/go-jose"
@@ -34,40 +35,69 @@ import (
 // so it doesn't need wrappers.
 
 const (
-	MethodNewRegistration             = "NewRegistration"             // RA, SA
-	MethodNewAuthorization            = "NewAuthorization"            // RA
-	MethodNewCertificate              = "NewCertificate"              // RA
-	MethodUpdateRegistration          = "UpdateRegistration"          // RA, SA
-	MethodUpdateAuthorization         = "UpdateAuthorization"         // RA
-	MethodRevokeCertificate           = "RevokeCertificate"           // RA, CA
-	MethodOnValidationUpdate          = "OnValidationUpdate"          // RA
-	MethodUpdateValidations           = "UpdateValidations"           // VA
-	MethodIssueCertificate            = "IssueCertificate"            // CA
-	MethodGenerateOCSP                = "GenerateOCSP"                // CA
-	MethodGetRegistration             = "GetRegistration"             // SA
-	MethodGetRegistrationByKey        = "GetRegistrationByKey"        // RA, SA
-	MethodGetAuthorization            = "GetAuthorization"            // SA
-	MethodGetCertificate              = "GetCertificate"              // SA
-	MethodGetCertificateByShortSerial = "GetCertificateByShortSerial" // SA
-	MethodGetCertificateStatus        = "GetCertificateStatus"        // SA
-	MethodMarkCertificateRevoked      = "MarkCertificateRevoked"      // SA
-	MethodNewPendingAuthorization     = "NewPendingAuthorization"     // SA
-	MethodUpdatePendingAuthorization  = "UpdatePendingAuthorization"  // SA
-	MethodFinalizeAuthorization       = "FinalizeAuthorization"       // SA
-	MethodAddCertificate              = "AddCertificate"              // SA
-	MethodAlreadyDeniedCSR            = "AlreadyDeniedCSR"            // SA
+	MethodNewRegistration                     = "NewRegistration"                     // RA, SA
+	MethodNewAuthorization                    = "NewAuthorization"                    // RA
+	MethodNewCertificate                      = "NewCertificate"                      // RA
+	MethodUpdateRegistration                  = "UpdateRegistration"                  // RA, SA
+	MethodUpdateRegistrationKey               = "UpdateRegistrationKey"               // RA, SA
+	MethodDeactivateRegistration              = "DeactivateRegistration"              // RA, SA
+	MethodUpdateAuthorization                 = "UpdateAuthorization"                 // RA
+	MethodDeactivateAuthorization             = "DeactivateAuthorization"             // RA, SA
+	MethodRevokeCertificate                   = "RevokeCertificate"                   // RA, CA
+	MethodNewOrder                            = "NewOrder"                            // RA, SA
+	MethodFinalizeOrder                       = "FinalizeOrder"                       // RA
+	MethodOnValidationUpdate                  = "OnValidationUpdate"                  // RA
+	MethodUpdateValidations                   = "UpdateValidations"                   // VA
+	MethodCheckCAARecords                     = "CheckCAARecords"                     // VA
+	MethodIssueCertificate                    = "IssueCertificate"                    // CA
+	MethodGenerateOCSP                        = "GenerateOCSP"                        // CA
+	MethodGetRegistration                     = "GetRegistration"                     // SA
+	MethodGetRegistrationByKey                = "GetRegistrationByKey"                // RA, SA
+	MethodGetAuthorization                    = "GetAuthorization"                    // SA
+	MethodGetOrder                            = "GetOrder"                            // SA
+	MethodGetCertificate                      = "GetCertificate"                      // SA
+	MethodGetCertificateByShortSerial         = "GetCertificateByShortSerial"         // SA
+	MethodGetCertificateStatus                = "GetCertificateStatus"                // SA
+	MethodGetCertificateRegistrationID        = "GetCertificateRegistrationID"        // SA
+	MethodGetValidAuthorizations              = "GetValidAuthorizations"              // SA
+	MethodGetLatestAuthorization              = "GetLatestAuthorization"              // SA
+	MethodCountCertificatesByNames            = "CountCertificatesByNames"            // SA
+	MethodCountCertificatesByFQDNSet          = "CountCertificatesByFQDNSet"          // SA
+	MethodCountNamesByRegistration            = "CountNamesByRegistration"            // SA
+	MethodCountRegistrationsByIP              = "CountRegistrationsByIP"              // SA
+	MethodCountPendingAuthorizations          = "CountPendingAuthorizations"          // SA
+	MethodGetCertificateSerialsByRegistration = "GetCertificateSerialsByRegistration" // SA
+	MethodGetAuthorizationIDsByRegistration   = "GetAuthorizationIDsByRegistration"   // SA
+	MethodMarkCertificateRevoked              = "MarkCertificateRevoked"              // SA
+	MethodNewPendingAuthorization             = "NewPendingAuthorization"             // SA
+	MethodUpdatePendingAuthorization          = "UpdatePendingAuthorization"          // SA
+	MethodFinalizeAuthorization               = "FinalizeAuthorization"               // SA
+	MethodSetOrderProcessing                  = "SetOrderProcessing"                  // SA
+	MethodUpdateOrder                         = "UpdateOrder"                         // SA
+	MethodAddCertificate                      = "AddCertificate"                      // SA
+	MethodAlreadyDeniedCSR                    = "AlreadyDeniedCSR"                    // SA
 )
 
 // RegistrationAuthorityClient / Server
 //  -> NewAuthorization
 //  -> NewCertificate
+//  -> UpdateRegistrationKey
+//  -> DeactivateRegistration
 //  -> UpdateAuthorization
+//  -> DeactivateAuthorization
 //  -> RevokeCertificate
+//  -> NewOrder
+//  -> FinalizeOrder
 //  -> OnValidationUpdate
 type registrationRequest struct {
 	Reg core.Registration
 }
 
+type registrationKeyRequest struct {
+	Reg core.Registration
+	Key jose.JsonWebKey
+}
+
 type authorizationRequest struct {
 	Authz core.Authorization
 	RegID int64
@@ -78,6 +108,16 @@ type certificateRequest struct {
 	RegID int64
 }
 
+type orderRequest struct {
+	Order core.Order
+	RegID int64
+}
+
+type finalizeOrderRequest struct {
+	Order core.Order
+	CSR   []byte
+}
+
 func improperMessage(method string, err error, obj interface{}) {
 	log := blog.GetAuditLogger()
 	log.Audit(fmt.Sprintf("Improper message. method: %s err: %s data: %+v", method, err, obj))
@@ -90,61 +130,61 @@ func errorCondition(method string, err error, obj interface{}) {
 func NewRegistrationAuthorityServer(rpc RPCServer, impl core.RegistrationAuthority) error {
 	log := blog.GetAuditLogger()
 
-	rpc.Handle(MethodNewRegistration, func(req []byte) (response []byte) {
+	rpc.Handle(MethodNewRegistration, func(req []byte) (response []byte, err error) {
 		var rr registrationRequest
 		if err := json.Unmarshal(req, &rr); err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
 			improperMessage(MethodNewRegistration, err, req)
-			return nil
+			return nil, err
 		}
 
 		reg, err := impl.NewRegistration(rr.Reg)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 			errorCondition(MethodNewRegistration, err, reg)
-			return nil
+			return nil, err
 		}
 
 		response, err = json.Marshal(reg)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 			errorCondition(MethodNewRegistration, err, req)
-			return nil
+			return nil, err
 		}
-		return response
+		return response, nil
 	})
 
-	rpc.Handle(MethodNewAuthorization, func(req []byte) (response []byte) {
+	rpc.Handle(MethodNewAuthorization, func(req []byte) (response []byte, err error) {
 		var ar authorizationRequest
 		if err := json.Unmarshal(req, &ar); err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
 			improperMessage(MethodNewAuthorization, err, req)
-			return nil
+			return nil, err
 		}
 
 		authz, err := impl.NewAuthorization(ar.Authz, ar.RegID)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 			errorCondition(MethodNewAuthorization, err, ar)
-			return nil
+			return nil, err
 		}
 
 		response, err = json.Marshal(authz)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 			errorCondition(MethodNewAuthorization, err, req)
-			return nil
+			return nil, err
 		}
-		return response
+		return response, nil
 	})
 
-	rpc.Handle(MethodNewCertificate, func(req []byte) []byte {
+	rpc.Handle(MethodNewCertificate, func(req []byte) (response []byte, err error) {
 		log.Info(fmt.Sprintf(" [.] Entering MethodNewCertificate"))
 		var cr certificateRequest
 		if err := json.Unmarshal(req, &cr); err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
 			improperMessage(MethodNewCertificate, err, req)
-			return nil
+			return nil, err
 		}
 		log.Info(fmt.Sprintf(" [.] No problem unmarshaling request"))
 
@@ -152,105 +192,244 @@ func NewRegistrationAuthorityServer(rpc RPCServer, impl core.RegistrationAuthori
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 			errorCondition(MethodNewCertificate, err, cr)
-			return nil
+			return nil, err
 		}
 		log.Info(fmt.Sprintf(" [.] No problem issuing new cert"))
 
-		response, err := json.Marshal(cert)
+		response, err = json.Marshal(cert)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 			errorCondition(MethodNewCertificate, err, req)
-			return nil
+			return nil, err
 		}
-		return response
+		return response, nil
 	})
 
-	rpc.Handle(MethodUpdateRegistration, func(req []byte) (response []byte) {
+	rpc.Handle(MethodUpdateRegistration, func(req []byte) (response []byte, err error) {
 		var request struct {
 			Base, Update core.Registration
 		}
-		err := json.Unmarshal(req, &request)
+		err = json.Unmarshal(req, &request)
 		if err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
 			improperMessage(MethodUpdateRegistration, err, req)
-			return nil
+			return nil, err
 		}
 
 		reg, err := impl.UpdateRegistration(request.Base, request.Update)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 			errorCondition(MethodUpdateRegistration, err, request)
-			return nil
+			return nil, err
 		}
 
 		response, err = json.Marshal(reg)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 			errorCondition(MethodUpdateRegistration, err, req)
-			return nil
+			return nil, err
+		}
+		return response, nil
+	})
+
+	rpc.Handle(MethodUpdateRegistrationKey, func(req []byte) (response []byte, err error) {
+		var request registrationKeyRequest
+		if err := json.Unmarshal(req, &request); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodUpdateRegistrationKey, err, req)
+			return nil, err
+		}
+
+		reg, err := impl.UpdateRegistrationKey(request.Reg, request.Key)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodUpdateRegistrationKey, err, request)
+			return nil, err
+		}
+
+		response, err = json.Marshal(reg)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodUpdateRegistrationKey, err, req)
+			return nil, err
+		}
+		return response, nil
+	})
+
+	rpc.Handle(MethodDeactivateRegistration, func(req []byte) (response []byte, err error) {
+		var request registrationRequest
+		if err := json.Unmarshal(req, &request); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodDeactivateRegistration, err, req)
+			return nil, err
+		}
+
+		reg, err := impl.DeactivateRegistration(request.Reg)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodDeactivateRegistration, err, request)
+			return nil, err
+		}
+
+		response, err = json.Marshal(reg)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodDeactivateRegistration, err, req)
+			return nil, err
 		}
-		return response
+		return response, nil
 	})
 
-	rpc.Handle(MethodUpdateAuthorization, func(req []byte) (response []byte) {
+	rpc.Handle(MethodUpdateAuthorization, func(req []byte) (response []byte, err error) {
 		var authz struct {
 			Authz    core.Authorization
 			Index    int
 			Response core.Challenge
 		}
-		err := json.Unmarshal(req, &authz)
+		err = json.Unmarshal(req, &authz)
 		if err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
 			improperMessage(MethodUpdateAuthorization, err, req)
-			return nil
+			return nil, err
 		}
 
 		newAuthz, err := impl.UpdateAuthorization(authz.Authz, authz.Index, authz.Response)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 			errorCondition(MethodUpdateAuthorization, err, authz)
-			return nil
+			return nil, err
 		}
 
 		response, err = json.Marshal(newAuthz)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 			errorCondition(MethodUpdateAuthorization, err, req)
-			return nil
+			return nil, err
+		}
+		return response, nil
+	})
+
+	rpc.Handle(MethodDeactivateAuthorization, func(req []byte) (response []byte, err error) {
+		var authz core.Authorization
+		if err := json.Unmarshal(req, &authz); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodDeactivateAuthorization, err, req)
+			return nil, err
+		}
+
+		newAuthz, err := impl.DeactivateAuthorization(authz)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodDeactivateAuthorization, err, authz)
+			return nil, err
+		}
+
+		response, err = json.Marshal(newAuthz)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodDeactivateAuthorization, err, req)
+			return nil, err
 		}
-		return response
+		return response, nil
 	})
 
-	rpc.Handle(MethodRevokeCertificate, func(req []byte) []byte {
-		certs, err := x509.ParseCertificates(req)
-		if err != nil || len(certs) == 0 {
+	rpc.Handle(MethodRevokeCertificate, func(req []byte) (response []byte, err error) {
+		var revokeReq struct {
+			Cert       []byte
+			ReasonCode int
+		}
+		if err := json.Unmarshal(req, &revokeReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodRevokeCertificate, err, req)
+			return nil, err
+		}
+
+		certs, err := x509.ParseCertificates(revokeReq.Cert)
+		if err == nil && len(certs) == 0 {
+			err = core.MalformedRequestError("No certificate in revocation request")
+		}
+		if err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
 			improperMessage(MethodRevokeCertificate, err, req)
-			return nil
+			return nil, err
 		}
 
-		// Error explicitly ignored since response is nil anyway
-		err = impl.RevokeCertificate(*certs[0])
+		err = impl.RevokeCertificate(*certs[0], revokeReq.ReasonCode)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 			errorCondition(MethodRevokeCertificate, err, certs)
 		}
-		return nil
+		return nil, err
+	})
+
+	rpc.Handle(MethodNewOrder, func(req []byte) (response []byte, err error) {
+		var or orderRequest
+		if err := json.Unmarshal(req, &or); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodNewOrder, err, req)
+			return nil, err
+		}
+
+		order, err := impl.NewOrder(or.Order, or.RegID)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodNewOrder, err, or)
+			return nil, err
+		}
+
+		response, err = json.Marshal(order)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodNewOrder, err, req)
+			return nil, err
+		}
+		return response, nil
+	})
+
+	rpc.Handle(MethodFinalizeOrder, func(req []byte) (response []byte, err error) {
+		var fr finalizeOrderRequest
+		if err := json.Unmarshal(req, &fr); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodFinalizeOrder, err, req)
+			return nil, err
+		}
+
+		csr, err := x509.ParseCertificateRequest(fr.CSR)
+		if err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodFinalizeOrder, err, req)
+			return nil, err
+		}
+
+		order, err := impl.FinalizeOrder(fr.Order, *csr)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodFinalizeOrder, err, fr)
+			return nil, err
+		}
+
+		response, err = json.Marshal(order)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodFinalizeOrder, err, req)
+			return nil, err
+		}
+		return response, nil
 	})
 
-	rpc.Handle(MethodOnValidationUpdate, func(req []byte) []byte {
+	rpc.Handle(MethodOnValidationUpdate, func(req []byte) (response []byte, err error) {
 		var authz core.Authorization
 		if err := json.Unmarshal(req, &authz); err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
 			improperMessage(MethodOnValidationUpdate, err, req)
-			return nil
+			return nil, err
 		}
 
-		if err := impl.OnValidationUpdate(authz); err != nil {
+		if err = impl.OnValidationUpdate(authz); err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 			errorCondition(MethodOnValidationUpdate, err, authz)
 		}
-		return nil
+		return nil, err
 	})
 
 	return nil
@@ -333,6 +512,44 @@ func (rac RegistrationAuthorityClient) UpdateRegistration(base core.Registration
 	return
 }
 
+func (rac RegistrationAuthorityClient) UpdateRegistrationKey(reg core.Registration, newKey jose.JsonWebKey) (newReg core.Registration, err error) {
+	data, err := json.Marshal(registrationKeyRequest{Reg: reg, Key: newKey})
+	if err != nil {
+		return
+	}
+
+	newRegData, err := rac.rpc.DispatchSync(MethodUpdateRegistrationKey, data)
+	if err != nil {
+		return
+	}
+	if len(newRegData) == 0 {
+		err = errors.New("UpdateRegistrationKey RPC failed")
+		return
+	}
+
+	err = json.Unmarshal(newRegData, &newReg)
+	return
+}
+
+func (rac RegistrationAuthorityClient) DeactivateRegistration(reg core.Registration) (newReg core.Registration, err error) {
+	data, err := json.Marshal(registrationRequest{Reg: reg})
+	if err != nil {
+		return
+	}
+
+	newRegData, err := rac.rpc.DispatchSync(MethodDeactivateRegistration, data)
+	if err != nil {
+		return
+	}
+	if len(newRegData) == 0 {
+		err = errors.New("DeactivateRegistration RPC failed")
+		return
+	}
+
+	err = json.Unmarshal(newRegData, &newReg)
+	return
+}
+
 func (rac RegistrationAuthorityClient) UpdateAuthorization(authz core.Authorization, index int, response core.Challenge) (newAuthz core.Authorization, err error) {
 	var toSend struct {
 		Authz    core.Authorization
@@ -357,8 +574,77 @@ func (rac RegistrationAuthorityClient) UpdateAuthorization(authz core.Authorizat
 	return
 }
 
-func (rac RegistrationAuthorityClient) RevokeCertificate(cert x509.Certificate) (err error) {
-	rac.rpc.Dispatch(MethodRevokeCertificate, cert.Raw)
+func (rac RegistrationAuthorityClient) DeactivateAuthorization(authz core.Authorization) (newAuthz core.Authorization, err error) {
+	data, err := json.Marshal(authz)
+	if err != nil {
+		return
+	}
+
+	newAuthzData, err := rac.rpc.DispatchSync(MethodDeactivateAuthorization, data)
+	if err != nil {
+		return
+	}
+	if len(newAuthzData) == 0 {
+		err = errors.New("DeactivateAuthorization RPC failed")
+		return
+	}
+
+	err = json.Unmarshal(newAuthzData, &newAuthz)
+	return
+}
+
+func (rac RegistrationAuthorityClient) RevokeCertificate(cert x509.Certificate, reasonCode int) (err error) {
+	var revokeReq struct {
+		Cert       []byte
+		ReasonCode int
+	}
+	revokeReq.Cert = cert.Raw
+	revokeReq.ReasonCode = reasonCode
+
+	data, err := json.Marshal(revokeReq)
+	if err != nil {
+		return
+	}
+
+	_, err = rac.rpc.DispatchSync(MethodRevokeCertificate, data)
+	return
+}
+
+func (rac RegistrationAuthorityClient) NewOrder(order core.Order, regID int64) (newOrder core.Order, err error) {
+	data, err := json.Marshal(orderRequest{order, regID})
+	if err != nil {
+		return
+	}
+
+	newOrderData, err := rac.rpc.DispatchSync(MethodNewOrder, data)
+	if err != nil {
+		return
+	}
+	if len(newOrderData) == 0 {
+		err = errors.New("NewOrder RPC failed")
+		return
+	}
+
+	err = json.Unmarshal(newOrderData, &newOrder)
+	return
+}
+
+func (rac RegistrationAuthorityClient) FinalizeOrder(order core.Order, csr x509.CertificateRequest) (newOrder core.Order, err error) {
+	data, err := json.Marshal(finalizeOrderRequest{Order: order, CSR: csr.Raw})
+	if err != nil {
+		return
+	}
+
+	newOrderData, err := rac.rpc.DispatchSync(MethodFinalizeOrder, data)
+	if err != nil {
+		return
+	}
+	if len(newOrderData) == 0 {
+		err = errors.New("FinalizeOrder RPC failed")
+		return
+	}
+
+	err = json.Unmarshal(newOrderData, &newOrder)
 	return
 }
 
@@ -374,8 +660,14 @@ func (rac RegistrationAuthorityClient) OnValidationUpdate(authz core.Authorizati
 
 // ValidationAuthorityClient / Server
 //  -> UpdateValidations
+//  -> CheckCAARecords
+type caaCheckResponse struct {
+	Present bool
+	Valid   bool
+}
+
 func NewValidationAuthorityServer(rpc RPCServer, impl core.ValidationAuthority) (err error) {
-	rpc.Handle(MethodUpdateValidations, func(req []byte) []byte {
+	rpc.Handle(MethodUpdateValidations, func(req []byte) (response []byte, err error) {
 		var vaReq struct {
 			Authz core.Authorization
 			Index int
@@ -383,14 +675,38 @@ func NewValidationAuthorityServer(rpc RPCServer, impl core.ValidationAuthority)
 		if err := json.Unmarshal(req, &vaReq); err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
 			improperMessage(MethodUpdateValidations, err, req)
-			return nil
+			return nil, err
 		}
 
-		if err := impl.UpdateValidations(vaReq.Authz, vaReq.Index); err != nil {
+		if err = impl.UpdateValidations(vaReq.Authz, vaReq.Index); err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 			errorCondition(MethodUpdateValidations, err, vaReq)
 		}
-		return nil
+		return nil, err
+	})
+
+	rpc.Handle(MethodCheckCAARecords, func(req []byte) (response []byte, err error) {
+		var ident core.AcmeIdentifier
+		if err = json.Unmarshal(req, &ident); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodCheckCAARecords, err, req)
+			return nil, err
+		}
+
+		present, valid, err := impl.CheckCAARecords(ident)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodCheckCAARecords, err, ident)
+			return nil, err
+		}
+
+		response, err = json.Marshal(caaCheckResponse{Present: present, Valid: valid})
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodCheckCAARecords, err, ident)
+			return nil, err
+		}
+		return response, nil
 	})
 
 	return nil
@@ -417,87 +733,109 @@ func (vac ValidationAuthorityClient) UpdateValidations(authz core.Authorization,
 		return err
 	}
 
-	vac.rpc.Dispatch(MethodUpdateValidations, data)
-	return nil
+	// Synchronous so we find out if the VA couldn't take the validation on
+	_, err = vac.rpc.DispatchSync(MethodUpdateValidations, data)
+	return err
+}
+
+func (vac ValidationAuthorityClient) CheckCAARecords(ident core.AcmeIdentifier) (present, valid bool, err error) {
+	data, err := json.Marshal(ident)
+	if err != nil {
+		return
+	}
+
+	response, err := vac.rpc.DispatchSync(MethodCheckCAARecords, data)
+	if err != nil {
+		return
+	}
+	if len(response) == 0 {
+		err = errors.New("CheckCAARecords RPC failed") // XXX
+		return
+	}
+
+	var caaResp caaCheckResponse
+	err = json.Unmarshal(response, &caaResp)
+	present, valid = caaResp.Present, caaResp.Valid
+	return
 }
 
 // CertificateAuthorityClient / Server
 //  -> IssueCertificate
 func NewCertificateAuthorityServer(rpc RPCServer, impl core.CertificateAuthority) (err error) {
-	rpc.Handle(MethodIssueCertificate, func(req []byte) []byte {
+	rpc.Handle(MethodIssueCertificate, func(req []byte) (response []byte, err error) {
 		var icReq struct {
 			Bytes          []byte
 			RegID          int64
 			EarliestExpiry time.Time
 		}
-		err := json.Unmarshal(req, &icReq)
+		err = json.Unmarshal(req, &icReq)
 		if err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
 			improperMessage(MethodIssueCertificate, err, req)
-			return nil
+			return nil, err
 		}
 
 		csr, err := x509.ParseCertificateRequest(icReq.Bytes)
 		if err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
 			improperMessage(MethodIssueCertificate, err, req)
-			return nil // XXX
+			return nil, err // XXX
 		}
 
 		cert, err := impl.IssueCertificate(*csr, icReq.RegID, icReq.EarliestExpiry)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 			errorCondition(MethodIssueCertificate, err, csr)
-			return nil // XXX
+			return nil, err // XXX
 		}
 
 		serialized, err := json.Marshal(cert)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 			errorCondition(MethodGetRegistration, err, req)
-			return nil // XXX
+			return nil, err // XXX
 		}
 
-		return serialized
+		return serialized, nil
 	})
 
-	rpc.Handle(MethodRevokeCertificate, func(req []byte) []byte {
+	rpc.Handle(MethodRevokeCertificate, func(req []byte) (response []byte, err error) {
 		var revokeReq struct {
 			Serial     string
 			ReasonCode int
 		}
-		err := json.Unmarshal(req, &revokeReq)
+		err = json.Unmarshal(req, &revokeReq)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 			errorCondition(MethodRevokeCertificate, err, req)
-			return nil
+			return nil, err
 		}
 
-		if err := impl.RevokeCertificate(revokeReq.Serial, revokeReq.ReasonCode); err != nil {
+		if err = impl.RevokeCertificate(revokeReq.Serial, revokeReq.ReasonCode); err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 			errorCondition(MethodRevokeCertificate, err, req)
 		}
 
-		return nil
+		return nil, err
 	})
 
-	rpc.Handle(MethodGenerateOCSP, func(req []byte) []byte {
+	rpc.Handle(MethodGenerateOCSP, func(req []byte) (response []byte, err error) {
 		var xferObj core.OCSPSigningRequest
-		err := json.Unmarshal(req, &xferObj)
+		err = json.Unmarshal(req, &xferObj)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 			errorCondition(MethodGenerateOCSP, err, req)
-			return nil
+			return nil, err
 		}
 
 		data, err := impl.GenerateOCSP(xferObj)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 			errorCondition(MethodGenerateOCSP, err, req)
-			return nil
+			return nil, err
 		}
 
-		return data
+		return data, nil
 	})
 
 	return
@@ -569,192 +907,348 @@ func (cac CertificateAuthorityClient) GenerateOCSP(signRequest core.OCSPSigningR
 	return
 }
 
+type latestAuthorizationRequest struct {
+	RegID      int64
+	Identifier core.AcmeIdentifier
+	Status     core.AcmeStatus
+}
+
+type countRequest struct {
+	Names []string
+	RegID int64
+	IP    net.IP
+	Since time.Time
+}
+
+type orderProcessingRequest struct {
+	ID          string
+	StaleBefore time.Time
+}
+
 func NewStorageAuthorityServer(rpc RPCServer, impl core.StorageAuthority) error {
-	rpc.Handle(MethodUpdateRegistration, func(req []byte) (response []byte) {
+	rpc.Handle(MethodUpdateRegistration, func(req []byte) (response []byte, err error) {
 		var reg core.Registration
 		if err := json.Unmarshal(req, &reg); err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
 			improperMessage(MethodUpdateRegistration, err, req)
-			return nil
+			return nil, err
 		}
 
-		if err := impl.UpdateRegistration(reg); err != nil {
+		if err = impl.UpdateRegistration(reg); err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 			errorCondition(MethodUpdateRegistration, err, req)
 		}
 
-		return nil
+		return nil, err
+	})
+
+	rpc.Handle(MethodUpdateRegistrationKey, func(req []byte) (response []byte, err error) {
+		var request registrationKeyRequest
+		if err := json.Unmarshal(req, &request); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodUpdateRegistrationKey, err, req)
+			return nil, err
+		}
+
+		reg, err := impl.UpdateRegistrationKey(request.Reg, request.Key)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodUpdateRegistrationKey, err, request)
+			return nil, err
+		}
+
+		response, err = json.Marshal(reg)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodUpdateRegistrationKey, err, req)
+			return nil, err
+		}
+		return response, nil
+	})
+
+	rpc.Handle(MethodDeactivateRegistration, func(req []byte) (response []byte, err error) {
+		var intReq struct {
+			ID int64
+		}
+		if err := json.Unmarshal(req, &intReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodDeactivateRegistration, err, req)
+			return nil, err
+		}
+
+		reg, err := impl.DeactivateRegistration(intReq.ID)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodDeactivateRegistration, err, req)
+			return nil, err
+		}
+
+		response, err = json.Marshal(reg)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodDeactivateRegistration, err, req)
+			return nil, err
+		}
+		return response, nil
 	})
 
-	rpc.Handle(MethodGetRegistration, func(req []byte) (response []byte) {
+	rpc.Handle(MethodGetRegistration, func(req []byte) (response []byte, err error) {
 		var intReq struct {
 			ID int64
 		}
-		err := json.Unmarshal(req, &intReq)
+		err = json.Unmarshal(req, &intReq)
 		if err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
 			improperMessage(MethodGetRegistration, err, req)
-			return nil
+			return nil, err
 		}
 
 		reg, err := impl.GetRegistration(intReq.ID)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 			errorCondition(MethodGetRegistration, err, req)
-			return nil
+			return nil, err
 		}
 
 		response, err = json.Marshal(reg)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 			errorCondition(MethodGetRegistration, err, req)
-			return nil
+			return nil, err
 		}
-		return response
+		return response, nil
 	})
 
-	rpc.Handle(MethodGetRegistrationByKey, func(req []byte) (response []byte) {
+	rpc.Handle(MethodGetRegistrationByKey, func(req []byte) (response []byte, err error) {
 		var jwk jose.JsonWebKey
 		if err := json.Unmarshal(req, &jwk); err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
 			improperMessage(MethodGetRegistrationByKey, err, req)
-			return nil
+			return nil, err
 		}
 
 		reg, err := impl.GetRegistrationByKey(jwk)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 			errorCondition(MethodGetRegistrationByKey, err, jwk)
-			return nil
+			return nil, err
 		}
 
 		response, err = json.Marshal(reg)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 			errorCondition(MethodGetRegistrationByKey, err, req)
-			return nil
+			return nil, err
 		}
-		return response
+		return response, nil
 	})
 
-	rpc.Handle(MethodGetAuthorization, func(req []byte) []byte {
+	rpc.Handle(MethodGetAuthorization, func(req []byte) (response []byte, err error) {
 		authz, err := impl.GetAuthorization(string(req))
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 			errorCondition(MethodGetAuthorization, err, req)
-			return nil
+			return nil, err
 		}
 
 		jsonAuthz, err := json.Marshal(authz)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 			errorCondition(MethodGetAuthorization, err, req)
-			return nil
+			return nil, err
 		}
-		return jsonAuthz
+		return jsonAuthz, nil
 	})
 
-	rpc.Handle(MethodAddCertificate, func(req []byte) []byte {
-		var icReq struct {
-			Bytes []byte
-			RegID int64
-		}
-		err := json.Unmarshal(req, &icReq)
+	rpc.Handle(MethodGetOrder, func(req []byte) (response []byte, err error) {
+		order, err := impl.GetOrder(string(req))
 		if err != nil {
-			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodAddCertificate, err, req)
-			return nil
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodGetOrder, err, req)
+			return nil, err
 		}
 
-		id, err := impl.AddCertificate(icReq.Bytes, icReq.RegID)
+		jsonOrder, err := json.Marshal(order)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-			errorCondition(MethodAddCertificate, err, req)
-			return nil
+			errorCondition(MethodGetOrder, err, req)
+			return nil, err
 		}
-		return []byte(id)
+		return jsonOrder, nil
 	})
 
-	rpc.Handle(MethodNewRegistration, func(req []byte) []byte {
-		var registration core.Registration
-		err := json.Unmarshal(req, &registration)
-		if err != nil {
+	rpc.Handle(MethodNewOrder, func(req []byte) (response []byte, err error) {
+		var order core.Order
+		if err := json.Unmarshal(req, &order); err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodNewRegistration, err, req)
-			return nil
+			improperMessage(MethodNewOrder, err, req)
+			return nil, err
 		}
 
-		output, err := impl.NewRegistration(registration)
+		output, err := impl.NewOrder(order)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-			errorCondition(MethodNewRegistration, err, registration)
-			return nil
+			errorCondition(MethodNewOrder, err, req)
+			return nil, err
 		}
 
-		jsonOutput, err := json.Marshal(output)
+		response, err = json.Marshal(output)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-			errorCondition(MethodNewRegistration, err, req)
-			return nil
+			errorCondition(MethodNewOrder, err, req)
+			return nil, err
 		}
-		return []byte(jsonOutput)
+		return response, nil
 	})
 
-	rpc.Handle(MethodNewPendingAuthorization, func(req []byte) []byte {
-		var authz core.Authorization
-		if err := json.Unmarshal(req, &authz); err != nil {
+	rpc.Handle(MethodSetOrderProcessing, func(req []byte) (response []byte, err error) {
+		var processingReq orderProcessingRequest
+		if err = json.Unmarshal(req, &processingReq); err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
-			improperMessage(MethodNewPendingAuthorization, err, req)
-			return nil
+			improperMessage(MethodSetOrderProcessing, err, req)
+			return nil, err
 		}
 
-		output, err := impl.NewPendingAuthorization(authz)
-		if err != nil {
+		if err = impl.SetOrderProcessing(processingReq.ID, processingReq.StaleBefore); err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
-			errorCondition(MethodNewPendingAuthorization, err, req)
-			return nil
+			errorCondition(MethodSetOrderProcessing, err, processingReq)
 		}
+		return nil, err
+	})
 
-		jsonOutput, err := json.Marshal(output)
-		if err != nil {
-			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+	rpc.Handle(MethodUpdateOrder, func(req []byte) (response []byte, err error) {
+		var order core.Order
+		if err := json.Unmarshal(req, &order); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodUpdateOrder, err, req)
+			return nil, err
+		}
+
+		if err = impl.UpdateOrder(order); err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodUpdateOrder, err, order)
+		}
+		return nil, err
+	})
+
+	rpc.Handle(MethodAddCertificate, func(req []byte) (response []byte, err error) {
+		var icReq struct {
+			Bytes []byte
+			RegID int64
+		}
+		err = json.Unmarshal(req, &icReq)
+		if err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodAddCertificate, err, req)
+			return nil, err
+		}
+
+		id, err := impl.AddCertificate(icReq.Bytes, icReq.RegID)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodAddCertificate, err, req)
+			return nil, err
+		}
+		return []byte(id), nil
+	})
+
+	rpc.Handle(MethodNewRegistration, func(req []byte) (response []byte, err error) {
+		var registration core.Registration
+		err = json.Unmarshal(req, &registration)
+		if err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodNewRegistration, err, req)
+			return nil, err
+		}
+
+		output, err := impl.NewRegistration(registration)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodNewRegistration, err, registration)
+			return nil, err
+		}
+
+		jsonOutput, err := json.Marshal(output)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodNewRegistration, err, req)
+			return nil, err
+		}
+		return []byte(jsonOutput), nil
+	})
+
+	rpc.Handle(MethodNewPendingAuthorization, func(req []byte) (response []byte, err error) {
+		var authz core.Authorization
+		if err := json.Unmarshal(req, &authz); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodNewPendingAuthorization, err, req)
+			return nil, err
+		}
+
+		output, err := impl.NewPendingAuthorization(authz)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 			errorCondition(MethodNewPendingAuthorization, err, req)
-			return nil
+			return nil, err
 		}
-		return []byte(jsonOutput)
+
+		jsonOutput, err := json.Marshal(output)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodNewPendingAuthorization, err, req)
+			return nil, err
+		}
+		return []byte(jsonOutput), nil
 	})
 
-	rpc.Handle(MethodUpdatePendingAuthorization, func(req []byte) []byte {
+	rpc.Handle(MethodUpdatePendingAuthorization, func(req []byte) (response []byte, err error) {
 		var authz core.Authorization
 		if err := json.Unmarshal(req, &authz); err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
 			improperMessage(MethodUpdatePendingAuthorization, err, req)
-			return nil
+			return nil, err
 		}
 
-		if err := impl.UpdatePendingAuthorization(authz); err != nil {
+		if err = impl.UpdatePendingAuthorization(authz); err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 			errorCondition(MethodUpdatePendingAuthorization, err, authz)
 		}
-		return nil
+		return nil, err
 	})
 
-	rpc.Handle(MethodFinalizeAuthorization, func(req []byte) []byte {
+	rpc.Handle(MethodFinalizeAuthorization, func(req []byte) (response []byte, err error) {
 		var authz core.Authorization
 		if err := json.Unmarshal(req, &authz); err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
 			improperMessage(MethodFinalizeAuthorization, err, req)
-			return nil
+			return nil, err
 		}
 
-		if err := impl.FinalizeAuthorization(authz); err != nil {
+		if err = impl.FinalizeAuthorization(authz); err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 			errorCondition(MethodFinalizeAuthorization, err, authz)
 		}
-		return nil
+		return nil, err
+	})
+
+	rpc.Handle(MethodDeactivateAuthorization, func(req []byte) (response []byte, err error) {
+		authz, err := impl.DeactivateAuthorization(string(req))
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodDeactivateAuthorization, err, req)
+			return nil, err
+		}
+
+		response, err = json.Marshal(authz)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodDeactivateAuthorization, err, req)
+			return nil, err
+		}
+		return response, nil
 	})
 
-	rpc.Handle(MethodGetCertificate, func(req []byte) (response []byte) {
+	rpc.Handle(MethodGetCertificate, func(req []byte) (response []byte, err error) {
 		cert, err := impl.GetCertificate(string(req))
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
@@ -762,10 +1256,10 @@ func NewStorageAuthorityServer(rpc RPCServer, impl core.StorageAuthority) error
 		} else {
 			response = []byte(cert)
 		}
-		return response
+		return response, nil
 	})
 
-	rpc.Handle(MethodGetCertificateByShortSerial, func(req []byte) (response []byte) {
+	rpc.Handle(MethodGetCertificateByShortSerial, func(req []byte) (response []byte, err error) {
 		cert, err := impl.GetCertificateByShortSerial(string(req))
 		if err != nil {
 			if err != sql.ErrNoRows {
@@ -775,27 +1269,264 @@ func NewStorageAuthorityServer(rpc RPCServer, impl core.StorageAuthority) error
 		} else {
 			response = []byte(cert)
 		}
-		return response
+		return response, nil
 	})
 
-	rpc.Handle(MethodGetCertificateStatus, func(req []byte) (response []byte) {
+	rpc.Handle(MethodGetCertificateStatus, func(req []byte) (response []byte, err error) {
 		status, err := impl.GetCertificateStatus(string(req))
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 			errorCondition(MethodGetCertificateStatus, err, req)
-			return nil
+			return nil, err
 		}
 
 		jsonStatus, err := json.Marshal(status)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 			errorCondition(MethodGetCertificateStatus, err, req)
-			return nil
+			return nil, err
 		}
-		return jsonStatus
+		return jsonStatus, nil
 	})
 
-	rpc.Handle(MethodMarkCertificateRevoked, func(req []byte) (response []byte) {
+	rpc.Handle(MethodGetCertificateRegistrationID, func(req []byte) (response []byte, err error) {
+		regID, err := impl.GetCertificateRegistrationID(string(req))
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodGetCertificateRegistrationID, err, req)
+			return nil, err
+		}
+
+		response, err = json.Marshal(regID)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodGetCertificateRegistrationID, err, req)
+			return nil, err
+		}
+		return response, nil
+	})
+
+	rpc.Handle(MethodGetValidAuthorizations, func(req []byte) (response []byte, err error) {
+		var authzReq struct {
+			RegID int64
+			Names []string
+			Now   time.Time
+		}
+		if err := json.Unmarshal(req, &authzReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodGetValidAuthorizations, err, req)
+			return nil, err
+		}
+
+		authzs, err := impl.GetValidAuthorizations(authzReq.RegID, authzReq.Names, authzReq.Now)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodGetValidAuthorizations, err, req)
+			return nil, err
+		}
+
+		response, err = json.Marshal(authzs)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodGetValidAuthorizations, err, req)
+			return nil, err
+		}
+		return response, nil
+	})
+
+	rpc.Handle(MethodGetLatestAuthorization, func(req []byte) (response []byte, err error) {
+		var authzReq latestAuthorizationRequest
+		if err := json.Unmarshal(req, &authzReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodGetLatestAuthorization, err, req)
+			return nil, err
+		}
+
+		authz, err := impl.GetLatestAuthorization(authzReq.RegID, authzReq.Identifier, authzReq.Status)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodGetLatestAuthorization, err, req)
+			return nil, err
+		}
+
+		response, err = json.Marshal(authz)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodGetLatestAuthorization, err, req)
+			return nil, err
+		}
+		return response, nil
+	})
+
+	rpc.Handle(MethodCountCertificatesByNames, func(req []byte) (response []byte, err error) {
+		var countReq countRequest
+		if err := json.Unmarshal(req, &countReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodCountCertificatesByNames, err, req)
+			return nil, err
+		}
+
+		counts, err := impl.CountCertificatesByNames(countReq.Names, countReq.Since)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodCountCertificatesByNames, err, countReq)
+			return nil, err
+		}
+
+		response, err = json.Marshal(counts)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodCountCertificatesByNames, err, req)
+			return nil, err
+		}
+		return response, nil
+	})
+
+	rpc.Handle(MethodCountCertificatesByFQDNSet, func(req []byte) (response []byte, err error) {
+		var countReq countRequest
+		if err := json.Unmarshal(req, &countReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodCountCertificatesByFQDNSet, err, req)
+			return nil, err
+		}
+
+		count, err := impl.CountCertificatesByFQDNSet(countReq.Names, countReq.Since)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodCountCertificatesByFQDNSet, err, countReq)
+			return nil, err
+		}
+
+		response, err = json.Marshal(count)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodCountCertificatesByFQDNSet, err, req)
+			return nil, err
+		}
+		return response, nil
+	})
+
+	rpc.Handle(MethodCountNamesByRegistration, func(req []byte) (response []byte, err error) {
+		var countReq countRequest
+		if err := json.Unmarshal(req, &countReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodCountNamesByRegistration, err, req)
+			return nil, err
+		}
+
+		count, err := impl.CountNamesByRegistration(countReq.RegID, countReq.Since)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodCountNamesByRegistration, err, countReq)
+			return nil, err
+		}
+
+		response, err = json.Marshal(count)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodCountNamesByRegistration, err, req)
+			return nil, err
+		}
+		return response, nil
+	})
+
+	rpc.Handle(MethodCountRegistrationsByIP, func(req []byte) (response []byte, err error) {
+		var countReq countRequest
+		if err := json.Unmarshal(req, &countReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodCountRegistrationsByIP, err, req)
+			return nil, err
+		}
+
+		count, err := impl.CountRegistrationsByIP(countReq.IP, countReq.Since)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodCountRegistrationsByIP, err, countReq)
+			return nil, err
+		}
+
+		response, err = json.Marshal(count)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodCountRegistrationsByIP, err, req)
+			return nil, err
+		}
+		return response, nil
+	})
+
+	rpc.Handle(MethodCountPendingAuthorizations, func(req []byte) (response []byte, err error) {
+		var countReq countRequest
+		if err := json.Unmarshal(req, &countReq); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodCountPendingAuthorizations, err, req)
+			return nil, err
+		}
+
+		count, err := impl.CountPendingAuthorizations(countReq.RegID)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodCountPendingAuthorizations, err, countReq)
+			return nil, err
+		}
+
+		response, err = json.Marshal(count)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodCountPendingAuthorizations, err, req)
+			return nil, err
+		}
+		return response, nil
+	})
+
+	rpc.Handle(MethodGetCertificateSerialsByRegistration, func(req []byte) (response []byte, err error) {
+		var q core.CollectionQuery
+		if err := json.Unmarshal(req, &q); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodGetCertificateSerialsByRegistration, err, req)
+			return nil, err
+		}
+
+		serials, err := impl.GetCertificateSerialsByRegistration(q)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodGetCertificateSerialsByRegistration, err, req)
+			return nil, err
+		}
+
+		response, err = json.Marshal(serials)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodGetCertificateSerialsByRegistration, err, req)
+			return nil, err
+		}
+		return response, nil
+	})
+
+	rpc.Handle(MethodGetAuthorizationIDsByRegistration, func(req []byte) (response []byte, err error) {
+		var q core.CollectionQuery
+		if err := json.Unmarshal(req, &q); err != nil {
+			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
+			improperMessage(MethodGetAuthorizationIDsByRegistration, err, req)
+			return nil, err
+		}
+
+		ids, err := impl.GetAuthorizationIDsByRegistration(q)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodGetAuthorizationIDsByRegistration, err, req)
+			return nil, err
+		}
+
+		response, err = json.Marshal(ids)
+		if err != nil {
+			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+			errorCondition(MethodGetAuthorizationIDsByRegistration, err, req)
+			return nil, err
+		}
+		return response, nil
+	})
+
+	rpc.Handle(MethodMarkCertificateRevoked, func(req []byte) (response []byte, err error) {
 		var revokeReq struct {
 			Serial       string
 			OCSPResponse []byte
@@ -805,41 +1536,40 @@ func NewStorageAuthorityServer(rpc RPCServer, impl core.StorageAuthority) error
 		if err := json.Unmarshal(req, &revokeReq); err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
 			improperMessage(MethodMarkCertificateRevoked, err, req)
-			return nil
+			return nil, err
 		}
 
-		// Error explicitly ignored since response is nil anyway
-		err := impl.MarkCertificateRevoked(revokeReq.Serial, revokeReq.OCSPResponse, revokeReq.ReasonCode)
+		err = impl.MarkCertificateRevoked(revokeReq.Serial, revokeReq.OCSPResponse, revokeReq.ReasonCode)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 			errorCondition(MethodMarkCertificateRevoked, err, revokeReq)
 		}
-		return nil
+		return nil, err
 	})
 
-	rpc.Handle(MethodAlreadyDeniedCSR, func(req []byte) []byte {
+	rpc.Handle(MethodAlreadyDeniedCSR, func(req []byte) (response []byte, err error) {
 		var csrReq struct {
 			Names []string
 		}
 
-		err := json.Unmarshal(req, &csrReq)
+		err = json.Unmarshal(req, &csrReq)
 		if err != nil {
 			// AUDIT[ Improper Messages ] 0786b6f2-91ca-4f48-9883-842a19084c64
 			improperMessage(MethodAlreadyDeniedCSR, err, req)
-			return nil
+			return nil, err
 		}
 
 		exists, err := impl.AlreadyDeniedCSR(csrReq.Names)
 		if err != nil {
 			// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 			errorCondition(MethodAlreadyDeniedCSR, err, csrReq)
-			return nil
+			return nil, err
 		}
 
 		if exists {
-			return []byte{1}
+			return []byte{1}, nil
 		} else {
-			return []byte{0}
+			return []byte{0}, nil
 		}
 	})
 
@@ -900,6 +1630,16 @@ func (cac StorageAuthorityClient) GetAuthorization(id string) (authz core.Author
 	return
 }
 
+func (cac StorageAuthorityClient) GetOrder(id string) (order core.Order, err error) {
+	jsonOrder, err := cac.rpc.DispatchSync(MethodGetOrder, []byte(id))
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(jsonOrder, &order)
+	return
+}
+
 func (cac StorageAuthorityClient) GetCertificate(id string) (cert []byte, err error) {
 	cert, err = cac.rpc.DispatchSync(MethodGetCertificate, []byte(id))
 	return
@@ -920,6 +1660,196 @@ func (cac StorageAuthorityClient) GetCertificateStatus(id string) (status core.C
 	return
 }
 
+func (cac StorageAuthorityClient) GetCertificateRegistrationID(serial string) (regID int64, err error) {
+	jsonRegID, err := cac.rpc.DispatchSync(MethodGetCertificateRegistrationID, []byte(serial))
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(jsonRegID, &regID)
+	return
+}
+
+func (cac StorageAuthorityClient) GetValidAuthorizations(regID int64, names []string, now time.Time) (authzs map[string]core.Authorization, err error) {
+	var authzReq struct {
+		RegID int64
+		Names []string
+		Now   time.Time
+	}
+	authzReq.RegID = regID
+	authzReq.Names = names
+	authzReq.Now = now
+
+	data, err := json.Marshal(authzReq)
+	if err != nil {
+		return
+	}
+
+	jsonAuthzs, err := cac.rpc.DispatchSync(MethodGetValidAuthorizations, data)
+	if err != nil {
+		return
+	}
+	if len(jsonAuthzs) == 0 {
+		err = errors.New("GetValidAuthorizations RPC failed") // XXX
+		return
+	}
+
+	err = json.Unmarshal(jsonAuthzs, &authzs)
+	return
+}
+
+func (cac StorageAuthorityClient) GetLatestAuthorization(regID int64, identifier core.AcmeIdentifier, status core.AcmeStatus) (authz core.Authorization, err error) {
+	data, err := json.Marshal(latestAuthorizationRequest{regID, identifier, status})
+	if err != nil {
+		return
+	}
+
+	jsonAuthz, err := cac.rpc.DispatchSync(MethodGetLatestAuthorization, data)
+	if err != nil {
+		return
+	}
+	if len(jsonAuthz) == 0 {
+		err = errors.New("GetLatestAuthorization RPC failed") // XXX
+		return
+	}
+
+	err = json.Unmarshal(jsonAuthz, &authz)
+	return
+}
+
+func (cac StorageAuthorityClient) CountCertificatesByNames(domains []string, since time.Time) (counts map[string]int64, err error) {
+	data, err := json.Marshal(countRequest{Names: domains, Since: since})
+	if err != nil {
+		return
+	}
+
+	response, err := cac.rpc.DispatchSync(MethodCountCertificatesByNames, data)
+	if err != nil {
+		return
+	}
+	if len(response) == 0 {
+		err = errors.New("CountCertificatesByNames RPC failed") // XXX
+		return
+	}
+
+	err = json.Unmarshal(response, &counts)
+	return
+}
+
+func (cac StorageAuthorityClient) CountCertificatesByFQDNSet(names []string, since time.Time) (count int64, err error) {
+	data, err := json.Marshal(countRequest{Names: names, Since: since})
+	if err != nil {
+		return
+	}
+
+	response, err := cac.rpc.DispatchSync(MethodCountCertificatesByFQDNSet, data)
+	if err != nil {
+		return
+	}
+	if len(response) == 0 {
+		err = errors.New("CountCertificatesByFQDNSet RPC failed") // XXX
+		return
+	}
+
+	err = json.Unmarshal(response, &count)
+	return
+}
+
+func (cac StorageAuthorityClient) CountNamesByRegistration(regID int64, since time.Time) (count int64, err error) {
+	data, err := json.Marshal(countRequest{RegID: regID, Since: since})
+	if err != nil {
+		return
+	}
+
+	response, err := cac.rpc.DispatchSync(MethodCountNamesByRegistration, data)
+	if err != nil {
+		return
+	}
+	if len(response) == 0 {
+		err = errors.New("CountNamesByRegistration RPC failed") // XXX
+		return
+	}
+
+	err = json.Unmarshal(response, &count)
+	return
+}
+
+func (cac StorageAuthorityClient) CountRegistrationsByIP(ip net.IP, since time.Time) (count int64, err error) {
+	data, err := json.Marshal(countRequest{IP: ip, Since: since})
+	if err != nil {
+		return
+	}
+
+	response, err := cac.rpc.DispatchSync(MethodCountRegistrationsByIP, data)
+	if err != nil {
+		return
+	}
+	if len(response) == 0 {
+		err = errors.New("CountRegistrationsByIP RPC failed") // XXX
+		return
+	}
+
+	err = json.Unmarshal(response, &count)
+	return
+}
+
+func (cac StorageAuthorityClient) CountPendingAuthorizations(regID int64) (count int64, err error) {
+	data, err := json.Marshal(countRequest{RegID: regID})
+	if err != nil {
+		return
+	}
+
+	response, err := cac.rpc.DispatchSync(MethodCountPendingAuthorizations, data)
+	if err != nil {
+		return
+	}
+	if len(response) == 0 {
+		err = errors.New("CountPendingAuthorizations RPC failed") // XXX
+		return
+	}
+
+	err = json.Unmarshal(response, &count)
+	return
+}
+
+func (cac StorageAuthorityClient) GetCertificateSerialsByRegistration(q core.CollectionQuery) (serials []string, err error) {
+	data, err := json.Marshal(q)
+	if err != nil {
+		return
+	}
+
+	response, err := cac.rpc.DispatchSync(MethodGetCertificateSerialsByRegistration, data)
+	if err != nil {
+		return
+	}
+	if len(response) == 0 {
+		err = errors.New("GetCertificateSerialsByRegistration RPC failed") // XXX
+		return
+	}
+
+	err = json.Unmarshal(response, &serials)
+	return
+}
+
+func (cac StorageAuthorityClient) GetAuthorizationIDsByRegistration(q core.CollectionQuery) (ids []string, err error) {
+	data, err := json.Marshal(q)
+	if err != nil {
+		return
+	}
+
+	response, err := cac.rpc.DispatchSync(MethodGetAuthorizationIDsByRegistration, data)
+	if err != nil {
+		return
+	}
+	if len(response) == 0 {
+		err = errors.New("GetAuthorizationIDsByRegistration RPC failed") // XXX
+		return
+	}
+
+	err = json.Unmarshal(response, &ids)
+	return
+}
+
 func (cac StorageAuthorityClient) MarkCertificateRevoked(serial string, ocspResponse []byte, reasonCode int) (err error) {
 	var revokeReq struct {
 		Serial       string
@@ -951,6 +1881,49 @@ func (cac StorageAuthorityClient) UpdateRegistration(reg core.Registration) (err
 	return
 }
 
+func (cac StorageAuthorityClient) UpdateRegistrationKey(reg core.Registration, newKey jose.JsonWebKey) (output core.Registration, err error) {
+	data, err := json.Marshal(registrationKeyRequest{Reg: reg, Key: newKey})
+	if err != nil {
+		return
+	}
+
+	response, err := cac.rpc.DispatchSync(MethodUpdateRegistrationKey, data)
+	if err != nil {
+		return
+	}
+	if len(response) == 0 {
+		err = errors.New("UpdateRegistrationKey RPC failed") // XXX
+		return
+	}
+
+	err = json.Unmarshal(response, &output)
+	return
+}
+
+func (cac StorageAuthorityClient) DeactivateRegistration(id int64) (output core.Registration, err error) {
+	var intReq struct {
+		ID int64
+	}
+	intReq.ID = id
+
+	data, err := json.Marshal(intReq)
+	if err != nil {
+		return
+	}
+
+	response, err := cac.rpc.DispatchSync(MethodDeactivateRegistration, data)
+	if err != nil {
+		return
+	}
+	if len(response) == 0 {
+		err = errors.New("DeactivateRegistration RPC failed") // XXX
+		return
+	}
+
+	err = json.Unmarshal(response, &output)
+	return
+}
+
 func (cac StorageAuthorityClient) NewRegistration(reg core.Registration) (output core.Registration, err error) {
 	jsonReg, err := json.Marshal(reg)
 	if err != nil {
@@ -958,7 +1931,10 @@ func (cac StorageAuthorityClient) NewRegistration(reg core.Registration) (output
 		return
 	}
 	response, err := cac.rpc.DispatchSync(MethodNewRegistration, jsonReg)
-	if err != nil || len(response) == 0 {
+	if err != nil {
+		return
+	}
+	if len(response) == 0 {
 		err = errors.New("NewRegistration RPC failed") // XXX
 		return
 	}
@@ -976,7 +1952,10 @@ func (cac StorageAuthorityClient) NewPendingAuthorization(authz core.Authorizati
 		return
 	}
 	response, err := cac.rpc.DispatchSync(MethodNewPendingAuthorization, jsonAuthz)
-	if err != nil || len(response) == 0 {
+	if err != nil {
+		return
+	}
+	if len(response) == 0 {
 		err = errors.New("NewPendingAuthorization RPC failed") // XXX
 		return
 	}
@@ -999,6 +1978,43 @@ func (cac StorageAuthorityClient) UpdatePendingAuthorization(authz core.Authoriz
 	return
 }
 
+func (cac StorageAuthorityClient) NewOrder(order core.Order) (output core.Order, err error) {
+	jsonOrder, err := json.Marshal(order)
+	if err != nil {
+		return
+	}
+	response, err := cac.rpc.DispatchSync(MethodNewOrder, jsonOrder)
+	if err != nil {
+		return
+	}
+	if len(response) == 0 {
+		err = errors.New("NewOrder RPC failed") // XXX
+		return
+	}
+	err = json.Unmarshal(response, &output)
+	return
+}
+
+func (cac StorageAuthorityClient) SetOrderProcessing(id string, staleBefore time.Time) (err error) {
+	data, err := json.Marshal(orderProcessingRequest{ID: id, StaleBefore: staleBefore})
+	if err != nil {
+		return
+	}
+
+	_, err = cac.rpc.DispatchSync(MethodSetOrderProcessing, data)
+	return
+}
+
+func (cac StorageAuthorityClient) UpdateOrder(order core.Order) (err error) {
+	jsonOrder, err := json.Marshal(order)
+	if err != nil {
+		return
+	}
+
+	_, err = cac.rpc.DispatchSync(MethodUpdateOrder, jsonOrder)
+	return
+}
+
 func (cac StorageAuthorityClient) FinalizeAuthorization(authz core.Authorization) (err error) {
 	jsonAuthz, err := json.Marshal(authz)
 	if err != nil {
@@ -1010,6 +2026,20 @@ func (cac StorageAuthorityClient) FinalizeAuthorization(authz core.Authorization
 	return
 }
 
+func (cac StorageAuthorityClient) DeactivateAuthorization(id string) (authz core.Authorization, err error) {
+	jsonAuthz, err := cac.rpc.DispatchSync(MethodDeactivateAuthorization, []byte(id))
+	if err != nil {
+		return
+	}
+	if len(jsonAuthz) == 0 {
+		err = errors.New("DeactivateAuthorization RPC failed") // XXX
+		return
+	}
+
+	err = json.Unmarshal(jsonAuthz, &authz)
+	return
+}
+
 func (cac StorageAuthorityClient) AddCertificate(cert []byte, regID int64) (id string, err error) {
 	var icReq struct {
 		Bytes []byte
@@ -1023,7 +2053,10 @@ func (cac StorageAuthorityClient) AddCertificate(cert []byte, regID int64) (id s
 	}
 
 	response, err := cac.rpc.DispatchSync(MethodAddCertificate, data)
-	if err != nil || len(response) == 0 {
+	if err != nil {
+		return
+	}
+	if len(response) == 0 {
 		err = errors.New("AddCertificate RPC failed") // XXX
 		return
 	}
@@ -1043,7 +2076,10 @@ func (cac StorageAuthorityClient) AlreadyDeniedCSR(names []string) (exists bool,
 	}
 
 	response, err := cac.rpc.DispatchSync(MethodAlreadyDeniedCSR, data)
-	if err != nil || len(response) == 0 {
+	if err != nil {
+		return
+	}
+	if len(response) == 0 {
 		err = errors.New("AlreadyDeniedCSR RPC failed") // XXX
 		return
 	}
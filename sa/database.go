@@ -10,8 +10,8 @@ import (
 	"fmt"
 
 	// Load both drivers to allow configuring either
-	_ "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/go-sql-driver/mysql"
-	_ "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/mattn/go-sqlite3"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/go-sql-driver/mysql"
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/mattn/go-sqlite3"
 
 	gorp "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/gorp.v1"
 
@@ -81,20 +81,42 @@ func (log *SQLLogger) Printf(format string, v ...interface{}) {
 // initTables constructs the table map for the ORM. If you want to also create
 // the tables, call CreateTablesIfNotExists on the DbMap.
 func initTables(dbMap *gorp.DbMap) {
-	regTable := dbMap.AddTableWithName(core.Registration{}, "registrations").SetKeys(true, "ID")
+	regTable := dbMap.AddTableWithName(regModel{}, "registrations").SetKeys(true, "ID")
 	regTable.SetVersionCol("LockCol")
 	regTable.ColMap("Key").SetMaxSize(1024).SetNotNull(true).SetUnique(true)
+	regTable.ColMap("KeySHA256").SetUnique(true)
 
 	pendingAuthzTable := dbMap.AddTableWithName(pendingauthzModel{}, "pending_authz").SetKeys(false, "ID")
 	pendingAuthzTable.SetVersionCol("LockCol")
-	pendingAuthzTable.ColMap("Challenges").SetMaxSize(1536)
+	pendingAuthzTable.ColMap("Challenges").SetMaxSize(4096)
 
 	authzTable := dbMap.AddTableWithName(authzModel{}, "authz").SetKeys(false, "ID")
-	authzTable.ColMap("Challenges").SetMaxSize(1536)
+	authzTable.ColMap("Challenges").SetMaxSize(4096)
 
 	dbMap.AddTableWithName(core.Certificate{}, "certificates").SetKeys(false, "Serial")
 	dbMap.AddTableWithName(core.CertificateStatus{}, "certificateStatus").SetKeys(false, "Serial").SetVersionCol("LockCol")
 	dbMap.AddTableWithName(core.OCSPResponse{}, "ocspResponses").SetKeys(true, "ID")
 	dbMap.AddTableWithName(core.CRL{}, "crls").SetKeys(false, "Serial")
 	dbMap.AddTableWithName(core.DeniedCSR{}, "deniedCSRs").SetKeys(true, "ID")
+
+	dbMap.AddTableWithName(issuedNameModel{}, "issuedNames").SetKeys(true, "ID")
+	dbMap.AddTableWithName(fqdnSetModel{}, "fqdnSets").SetKeys(true, "ID")
+
+	orderTable := dbMap.AddTableWithName(orderModel{}, "orders").SetKeys(false, "ID")
+	orderTable.SetVersionCol("LockCol")
+	orderTable.ColMap("Identifiers").SetMaxSize(1536)
+	orderTable.ColMap("Authorizations").SetMaxSize(1536)
+}
+
+// duplicateKeyError reports whether err is the database refusing a write
+// that would have put the same value in a unique column twice.
+func duplicateKeyError(err error) bool {
+	switch err := err.(type) {
+	case *mysql.MySQLError:
+		// ER_DUP_ENTRY
+		return err.Number == 1062
+	case sqlite3.Error:
+		return err.ExtendedCode == sqlite3.ErrConstraintUnique
+	}
+	return false
 }
@@ -8,9 +8,11 @@ package sa
 import (
 	"crypto/sha256"
 	"crypto/x509"
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"sort"
 	"strings"
 	"time"
@@ -35,6 +37,26 @@ func digest256(data []byte) []byte {
 }
 
 // Utility models
+
+// Registrations are stored along with a digest of their key, which has a
+// unique index so that no two registrations can end up with the same key.
+// Registrations stored before the digest was have it filled in the next
+// time they're looked up by key or updated, so it can be NULL.
+type regModel struct {
+	core.Registration
+
+	KeySHA256 sql.NullString `db:"jwkSHA256"`
+}
+
+func registrationToModel(reg core.Registration) (model regModel, err error) {
+	digest, err := core.KeyDigest(reg.Key)
+	if err != nil {
+		return
+	}
+	model = regModel{Registration: reg, KeySHA256: sql.NullString{String: digest, Valid: true}}
+	return
+}
+
 type pendingauthzModel struct {
 	core.Authorization
 
@@ -47,6 +69,70 @@ type authzModel struct {
 	Sequence int64 `db:"sequence"`
 }
 
+// Orders are stored along with when finalizing them last started, so that an
+// order left processing by a finalization that never finished can be picked
+// up again.
+type orderModel struct {
+	core.Order
+
+	ProcessingStarted *time.Time `db:"processingStarted"`
+}
+
+// Each name in an issued certificate gets an issuedNameModel row, for rate
+// limiting.  Names are stored with their labels reversed, so that all the
+// names under a domain share a prefix.
+type issuedNameModel struct {
+	ID           int64     `db:"id"`
+	ReversedName string    `db:"reversedName"`
+	Serial       string    `db:"serial"`
+	Issued       time.Time `db:"issued"`
+}
+
+// Each issued certificate gets an fqdnSetModel row identifying the exact set
+// of names it covers, so that duplicate certificates can be counted.
+type fqdnSetModel struct {
+	ID      int64     `db:"id"`
+	SetHash string    `db:"setHash"`
+	Serial  string    `db:"serial"`
+	Issued  time.Time `db:"issued"`
+	Expires time.Time `db:"expires"`
+}
+
+// reverseName turns "www.example.com" into "com.example.www".
+func reverseName(name string) string {
+	labels := strings.Split(strings.ToLower(name), ".")
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+	return strings.Join(labels, ".")
+}
+
+// hashNames identifies a set of names regardless of case, order or
+// repetition.
+func hashNames(names []string) string {
+	lower := make([]string, len(names))
+	for i, name := range names {
+		lower[i] = strings.ToLower(name)
+	}
+	unique := core.UniqueNames(lower)
+	sort.Strings(unique)
+	return fmt.Sprintf("%x", digest256([]byte(strings.Join(unique, ","))))
+}
+
+// certificateNames lists the names a certificate covers: its subject common
+// name and its DNS subject alternative names.
+func certificateNames(cert *x509.Certificate) []string {
+	names := make([]string, len(cert.DNSNames))
+	copy(names, cert.DNSNames)
+	if len(cert.Subject.CommonName) > 0 {
+		names = append(names, cert.Subject.CommonName)
+	}
+	for i, name := range names {
+		names[i] = strings.ToLower(name)
+	}
+	return core.UniqueNames(names)
+}
+
 // NewSQLStorageAuthority provides persistence using a SQL backend for Boulder.
 func NewSQLStorageAuthority(driver string, name string) (ssa *SQLStorageAuthority, err error) {
 	logger := blog.GetAuditLogger()
@@ -87,7 +173,7 @@ func (ssa *SQLStorageAuthority) DumpTables() error {
 	fmt.Printf("===== TABLE DUMP =====\n")
 
 	fmt.Printf("\n----- registrations -----\n")
-	var registrations []core.Registration
+	var registrations []regModel
 	_, err = tx.Select(&registrations, "SELECT * FROM registrations")
 	if err != nil {
 		tx.Rollback()
@@ -194,6 +280,12 @@ func existingFinal(tx *gorp.Transaction, id string) bool {
 	return count > 0
 }
 
+func existingOrder(tx *gorp.Transaction, id string) bool {
+	var count int64
+	_ = tx.SelectOne(&count, "SELECT count(*) FROM orders WHERE id = :id", map[string]interface{}{"id": id})
+	return count > 0
+}
+
 func existingRegistration(tx *gorp.Transaction, id int64) bool {
 	var count int64
 	_ = tx.SelectOne(&count, "SELECT count(*) FROM registrations WHERE id = :id", map[string]interface{}{"id": id})
@@ -201,7 +293,7 @@ func existingRegistration(tx *gorp.Transaction, id int64) bool {
 }
 
 func (ssa *SQLStorageAuthority) GetRegistration(id int64) (reg core.Registration, err error) {
-	regObj, err := ssa.dbMap.Get(core.Registration{}, id)
+	regObj, err := ssa.dbMap.Get(regModel{}, id)
 	if err != nil {
 		return
 	}
@@ -209,22 +301,45 @@ func (ssa *SQLStorageAuthority) GetRegistration(id int64) (reg core.Registration
 		err = fmt.Errorf("No registrations with ID %d", id)
 		return
 	}
-	regPtr, ok := regObj.(*core.Registration)
+	regPtr, ok := regObj.(*regModel)
 	if !ok {
 		err = fmt.Errorf("Invalid cast")
+		return
 	}
 
-	reg = *regPtr
+	reg = regPtr.Registration
 	return
 }
 
+// GetRegistrationByKey finds a registration by its key digest, which is
+// indexed, and then requires the JWK to match exactly as well.
 func (ssa *SQLStorageAuthority) GetRegistrationByKey(key jose.JsonWebKey) (reg core.Registration, err error) {
 	keyJson, err := json.Marshal(key)
 	if err != nil {
 		return
 	}
+	digest, err := core.KeyDigest(key)
+	if err != nil {
+		return
+	}
 
-	err = ssa.dbMap.SelectOne(&reg, "SELECT * FROM registrations WHERE jwk = :key", map[string]interface{}{"key": string(keyJson)})
+	var model regModel
+	err = ssa.dbMap.SelectOne(&model, "SELECT * FROM registrations WHERE jwkSHA256 = :digest AND jwk = :key",
+		map[string]interface{}{"digest": digest, "key": string(keyJson)})
+	if err == sql.ErrNoRows {
+		// Registrations from before key digests were stored don't have one
+		// yet, so look for one of those and fill its digest in
+		err = ssa.dbMap.SelectOne(&model, "SELECT * FROM registrations WHERE jwkSHA256 IS NULL AND jwk = :key",
+			map[string]interface{}{"key": string(keyJson)})
+		if err != nil {
+			return
+		}
+		_, fillErr := ssa.dbMap.Exec("UPDATE registrations SET jwkSHA256 = ? WHERE id = ? AND jwkSHA256 IS NULL", digest, model.ID)
+		if fillErr != nil {
+			ssa.log.Warning(fmt.Sprintf("Couldn't store the key digest of registration %d: %s", model.ID, fillErr))
+		}
+	}
+	reg = model.Registration
 	return
 }
 
@@ -263,6 +378,179 @@ func (ssa *SQLStorageAuthority) GetAuthorization(id string) (authz core.Authoriz
 	return
 }
 
+// GetValidAuthorizations returns, for each of the given DNS names that the
+// registration holds an unexpired valid authorization for, the one of those
+// authorizations that expires last.  Names are looked up one at a time, so
+// that each lookup can use regId_identifier_status_idx.
+func (ssa *SQLStorageAuthority) GetValidAuthorizations(registrationID int64, names []string, now time.Time) (latest map[string]core.Authorization, err error) {
+	latest = make(map[string]core.Authorization)
+	for _, name := range names {
+		name = strings.ToLower(name)
+		var identifierJSON []byte
+		identifierJSON, err = json.Marshal(core.AcmeIdentifier{Type: core.IdentifierDNS, Value: name})
+		if err != nil {
+			return
+		}
+
+		var auths []authzModel
+		_, err = ssa.dbMap.Select(&auths, "SELECT * FROM authz WHERE registrationID = :regID AND identifier = :identifier AND status = :status AND expires > :now ORDER BY expires DESC LIMIT 1",
+			map[string]interface{}{"regID": registrationID, "identifier": string(identifierJSON), "status": string(core.StatusValid), "now": now})
+		if err != nil {
+			return
+		}
+		if len(auths) > 0 {
+			latest[name] = auths[0].Authorization
+		}
+	}
+	return
+}
+
+// GetLatestAuthorization returns, of the registration's authorizations for
+// the given identifier that have the given status, the one that expires last.
+// Pending authorizations are looked up in pending_authz, and all others in
+// authz.
+func (ssa *SQLStorageAuthority) GetLatestAuthorization(registrationID int64, identifier core.AcmeIdentifier, status core.AcmeStatus) (authz core.Authorization, err error) {
+	identifierJSON, err := json.Marshal(identifier)
+	if err != nil {
+		return
+	}
+
+	table := "authz"
+	if statusIsPending(status) {
+		table = "pending_authz"
+	}
+	var auths []core.Authorization
+	_, err = ssa.dbMap.Select(&auths, "SELECT id, identifier, registrationID, status, expires, challenges, combinations FROM "+table+
+		" WHERE registrationID = :regID AND identifier = :identifier AND status = :status",
+		map[string]interface{}{"regID": registrationID, "identifier": string(identifierJSON), "status": string(status)})
+	if err != nil {
+		return
+	}
+	if len(auths) == 0 {
+		err = core.NotFoundError(fmt.Sprintf("No %s authorization for %s", status, identifier.Value))
+		return
+	}
+
+	authz = auths[0]
+	for _, auth := range auths[1:] {
+		if auth.Expires.After(authz.Expires) {
+			authz = auth
+		}
+	}
+	return
+}
+
+// CountCertificatesByNames returns, for each of the given domains, how many
+// certificates issued since the given time cover the domain or any name under
+// it.
+func (ssa *SQLStorageAuthority) CountCertificatesByNames(domains []string, since time.Time) (counts map[string]int64, err error) {
+	counts = make(map[string]int64, len(domains))
+	for _, domain := range domains {
+		reversed := reverseName(domain)
+		var count int64
+		count, err = ssa.dbMap.SelectInt(
+			"SELECT COUNT(DISTINCT serial) FROM issuedNames WHERE (reversedName = :reversed OR reversedName LIKE :subdomains) AND issued >= :since",
+			map[string]interface{}{"reversed": reversed, "subdomains": reversed + ".%", "since": since})
+		if err != nil {
+			return
+		}
+		counts[domain] = count
+	}
+	return
+}
+
+// CountCertificatesByFQDNSet returns how many certificates issued since the
+// given time cover exactly the given set of names.
+func (ssa *SQLStorageAuthority) CountCertificatesByFQDNSet(names []string, since time.Time) (int64, error) {
+	return ssa.dbMap.SelectInt("SELECT COUNT(*) FROM fqdnSets WHERE setHash = :setHash AND issued >= :since",
+		map[string]interface{}{"setHash": hashNames(names), "since": since})
+}
+
+// CountNamesByRegistration returns how many distinct names the registration
+// has had certificates issued for since the given time.
+func (ssa *SQLStorageAuthority) CountNamesByRegistration(registrationID int64, since time.Time) (int64, error) {
+	return ssa.dbMap.SelectInt(
+		"SELECT COUNT(DISTINCT n.reversedName) FROM issuedNames n JOIN certificates c ON c.serial = n.serial WHERE c.registrationID = :regID AND n.issued >= :since",
+		map[string]interface{}{"regID": registrationID, "since": since})
+}
+
+// CountRegistrationsByIP returns how many registrations have been created
+// from the given IP address since the given time.
+func (ssa *SQLStorageAuthority) CountRegistrationsByIP(ip net.IP, since time.Time) (int64, error) {
+	return ssa.dbMap.SelectInt(
+		"SELECT COUNT(1) FROM registrations WHERE initialIp = :ip AND createdAt >= :since",
+		map[string]interface{}{"ip": []byte(ip.To16()), "since": since})
+}
+
+// CountPendingAuthorizations returns how many unexpired pending authorizations
+// the registration holds.
+func (ssa *SQLStorageAuthority) CountPendingAuthorizations(registrationID int64) (int64, error) {
+	return ssa.dbMap.SelectInt(
+		"SELECT COUNT(1) FROM pending_authz WHERE registrationID = :regID AND status = :status AND expires > :now",
+		map[string]interface{}{
+			"regID":  registrationID,
+			"status": string(core.StatusPending),
+			"now":    time.Now(),
+		})
+}
+
+// collectionClauses builds the WHERE and ORDER BY clauses shared by the
+// paginated queries for a registration's certificates and authorizations.
+// The remaining parameters name the columns to select, page and filter on.
+func collectionClauses(q core.CollectionQuery, regID, key, status, expires string) (string, map[string]interface{}) {
+	clauses := regID + " = :regID AND " + key + " > :cursor"
+	args := map[string]interface{}{
+		"regID":  q.RegistrationID,
+		"cursor": q.Cursor,
+		"limit":  q.Limit,
+	}
+	if len(q.Status) > 0 {
+		clauses += " AND " + status + " = :status"
+		args["status"] = q.Status
+	}
+	if !q.ExpiresAfter.IsZero() {
+		clauses += " AND " + expires + " > :expires"
+		args["expires"] = q.ExpiresAfter
+	}
+	clauses += " ORDER BY " + key + " LIMIT :limit"
+	return clauses, args
+}
+
+// GetCertificateSerialsByRegistration returns one page of the serials of the
+// certificates issued to a registration.
+func (ssa *SQLStorageAuthority) GetCertificateSerialsByRegistration(q core.CollectionQuery) (serials []string, err error) {
+	clauses, args := collectionClauses(q, "c.registrationID", "c.serial", "cs.status", "c.expires")
+	_, err = ssa.dbMap.Select(&serials,
+		"SELECT c.serial FROM certificates c JOIN certificateStatus cs ON cs.serial = c.serial WHERE "+clauses,
+		args)
+	return
+}
+
+// GetAuthorizationIDsByRegistration returns one page of the IDs of the
+// authorizations, pending or final, that belong to a registration.
+func (ssa *SQLStorageAuthority) GetAuthorizationIDsByRegistration(q core.CollectionQuery) (ids []string, err error) {
+	clauses, args := collectionClauses(q, "registrationID", "id", "status", "expires")
+
+	var pendingIDs, finalIDs []string
+	_, err = ssa.dbMap.Select(&pendingIDs, "SELECT id FROM pending_authz WHERE "+clauses, args)
+	if err != nil {
+		return
+	}
+	_, err = ssa.dbMap.Select(&finalIDs, "SELECT id FROM authz WHERE "+clauses, args)
+	if err != nil {
+		return
+	}
+
+	// Each table gives us up to a page in order, so the page is the first
+	// Limit of the two merged together.
+	ids = append(pendingIDs, finalIDs...)
+	sort.Strings(ids)
+	if len(ids) > q.Limit {
+		ids = ids[:q.Limit]
+	}
+	return
+}
+
 // GetCertificateByShortSerial takes an id consisting of the first, sequential half of a
 // serial number and returns the first certificate whose full serial number is
 // lexically greater than that id. This allows clients to query on the known
@@ -317,20 +605,53 @@ func (ssa *SQLStorageAuthority) GetCertificateStatus(serial string) (status core
 	return
 }
 
+// GetCertificateRegistrationID returns the ID of the registration that a
+// certificate was issued to.
+func (ssa *SQLStorageAuthority) GetCertificateRegistrationID(serial string) (int64, error) {
+	if len(serial) != 32 {
+		err := fmt.Errorf("Invalid certificate serial %s", serial)
+		return 0, err
+	}
+
+	certObj, err := ssa.dbMap.Get(core.Certificate{}, serial)
+	if err != nil {
+		return 0, err
+	}
+	if certObj == nil {
+		err = fmt.Errorf("No certificate with serial %s", serial)
+		return 0, err
+	}
+
+	cert := certObj.(*core.Certificate)
+	return cert.RegistrationID, nil
+}
+
+// errKeyInUse is returned when a registration would get a key that another
+// registration already has.
+var errKeyInUse = core.MalformedRequestError("Key is already in use for a different registration")
+
 func (ssa *SQLStorageAuthority) NewRegistration(reg core.Registration) (core.Registration, error) {
+	model, err := registrationToModel(reg)
+	if err != nil {
+		return reg, err
+	}
+
 	tx, err := ssa.dbMap.Begin()
 	if err != nil {
 		return reg, err
 	}
 
-	err = tx.Insert(&reg)
+	err = tx.Insert(&model)
 	if err != nil {
 		tx.Rollback()
+		if duplicateKeyError(err) {
+			err = errKeyInUse
+		}
 		return reg, err
 	}
 
 	err = tx.Commit()
-	return reg, err
+	return model.Registration, err
 }
 
 // MarkCertificateRevoked stores the fact that a certificate is revoked, along
@@ -395,7 +716,12 @@ func (ssa *SQLStorageAuthority) UpdateRegistration(reg core.Registration) (err e
 		return
 	}
 
-	_, err = tx.Update(&reg)
+	model, err := registrationToModel(reg)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	_, err = tx.Update(&model)
 	if err != nil {
 		tx.Rollback()
 		return
@@ -405,6 +731,198 @@ func (ssa *SQLStorageAuthority) UpdateRegistration(reg core.Registration) (err e
 	return
 }
 
+// UpdateRegistrationKey replaces the account key of a registration, provided
+// it still has the key that authorized the change. The registration's LockCol
+// guards against a concurrent update slipping in between the check and the
+// write, and the unique index on the key digest against two registrations
+// ending up with the same key.
+func (ssa *SQLStorageAuthority) UpdateRegistrationKey(reg core.Registration, newKey jose.JsonWebKey) (updated core.Registration, err error) {
+	tx, err := ssa.dbMap.Begin()
+	if err != nil {
+		return
+	}
+
+	regObj, err := tx.Get(regModel{}, reg.ID)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	if regObj == nil {
+		err = fmt.Errorf("Requested registration not found %v", reg.ID)
+		tx.Rollback()
+		return
+	}
+	current := regObj.(*regModel)
+	if !core.KeyDigestEquals(current.Key, reg.Key) {
+		err = fmt.Errorf("Key of registration %v has changed", reg.ID)
+		tx.Rollback()
+		return
+	}
+
+	current.Key = newKey
+	digest, err := core.KeyDigest(newKey)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	current.KeySHA256 = sql.NullString{String: digest, Valid: true}
+	_, err = tx.Update(current)
+	if err != nil {
+		tx.Rollback()
+		if duplicateKeyError(err) {
+			err = errKeyInUse
+		}
+		return
+	}
+
+	err = tx.Commit()
+	updated = current.Registration
+	return
+}
+
+// DeactivateRegistration marks a registration as deactivated, and invalidates
+// any of its authorizations that are still pending so that they cannot be
+// completed later on.
+func (ssa *SQLStorageAuthority) DeactivateRegistration(id int64) (updated core.Registration, err error) {
+	tx, err := ssa.dbMap.Begin()
+	if err != nil {
+		return
+	}
+
+	regObj, err := tx.Get(regModel{}, id)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	if regObj == nil {
+		err = fmt.Errorf("Requested registration not found %v", id)
+		tx.Rollback()
+		return
+	}
+	reg := regObj.(*regModel)
+	reg.Status = core.StatusDeactivated
+	_, err = tx.Update(reg)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+
+	var pending []pendingauthzModel
+	_, err = tx.Select(&pending, "SELECT * FROM pending_authz WHERE registrationID = :regID",
+		map[string]interface{}{"regID": id})
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	for _, pa := range pending {
+		authz := pa.Authorization
+		authz.Status = core.StatusInvalid
+		if err = finalizeInTx(tx, authz, &pa); err != nil {
+			tx.Rollback()
+			return
+		}
+	}
+
+	err = tx.Commit()
+	updated = reg.Registration
+	return
+}
+
+// GetOrder fetches the order with the given ID.
+func (ssa *SQLStorageAuthority) GetOrder(id string) (order core.Order, err error) {
+	orderObj, err := ssa.dbMap.Get(orderModel{}, id)
+	if err != nil {
+		return
+	}
+	if orderObj == nil {
+		err = core.NotFoundError(fmt.Sprintf("No order with ID %s", id))
+		return
+	}
+	order = orderObj.(*orderModel).Order
+	return
+}
+
+// NewOrder stores a new order under a freshly generated ID.
+func (ssa *SQLStorageAuthority) NewOrder(order core.Order) (output core.Order, err error) {
+	tx, err := ssa.dbMap.Begin()
+	if err != nil {
+		return
+	}
+
+	order.ID = core.NewToken()
+	for existingOrder(tx, order.ID) {
+		order.ID = core.NewToken()
+	}
+
+	model := orderModel{Order: order}
+	err = tx.Insert(&model)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+
+	err = tx.Commit()
+	output = model.Order
+	return
+}
+
+// SetOrderProcessing moves an order to processing, which only one attempt to
+// finalize it can do: the others get an error and must not issue a
+// certificate for it.  The order must be pending, or have been processing
+// since before staleBefore, in which case the finalization that started it
+// is taken to have died before it could record its outcome.
+func (ssa *SQLStorageAuthority) SetOrderProcessing(id string, staleBefore time.Time) (err error) {
+	return ssa.changeOrder(id, core.MalformedRequestError(fmt.Sprintf("Order %s is no longer %s", id, core.StatusPending)),
+		"UPDATE orders SET status = ?, processingStarted = ?, LockCol = LockCol + 1 WHERE id = ? AND (status = ? OR (status = ? AND processingStarted < ?))",
+		string(core.StatusProcessing), time.Now(), id, string(core.StatusPending), string(core.StatusProcessing), staleBefore)
+}
+
+// UpdateOrder records the outcome of finalizing an order that
+// SetOrderProcessing moved to processing: its new status, and the serial of
+// its certificate if one was issued.  It fails if the order isn't processing,
+// e.g. because it's already been updated.
+func (ssa *SQLStorageAuthority) UpdateOrder(order core.Order) (err error) {
+	return ssa.changeOrder(order.ID, core.MalformedRequestError(fmt.Sprintf("Order %s is no longer %s", order.ID, core.StatusProcessing)),
+		"UPDATE orders SET status = ?, certificateSerial = ?, LockCol = LockCol + 1 WHERE id = ? AND status = ?",
+		string(order.Status), order.CertificateSerial, order.ID, string(core.StatusProcessing))
+}
+
+// changeOrder runs update against the order with the given ID.  The update
+// checks itself that the order is in a state it can be changed from, so that
+// of two concurrent changes only one can succeed; if it changes nothing,
+// changeOrder returns conflict.
+func (ssa *SQLStorageAuthority) changeOrder(id string, conflict error, update string, args ...interface{}) (err error) {
+	tx, err := ssa.dbMap.Begin()
+	if err != nil {
+		return
+	}
+
+	if !existingOrder(tx, id) {
+		err = core.NotFoundError(fmt.Sprintf("No order with ID %s", id))
+		tx.Rollback()
+		return
+	}
+
+	result, err := tx.Exec(update, args...)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	if rows == 0 {
+		err = conflict
+		tx.Rollback()
+		return
+	}
+
+	err = tx.Commit()
+	return
+}
+
 func (ssa *SQLStorageAuthority) NewPendingAuthorization(authz core.Authorization) (output core.Authorization, err error) {
 	tx, err := ssa.dbMap.Begin()
 	if err != nil {
@@ -489,6 +1007,26 @@ func (ssa *SQLStorageAuthority) FinalizeAuthorization(authz core.Authorization)
 		return
 	}
 
+	authObj, err := tx.Get(pendingauthzModel{}, authz.ID)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	oldAuth := authObj.(*pendingauthzModel)
+
+	err = finalizeInTx(tx, authz, oldAuth)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+
+	err = tx.Commit()
+	return
+}
+
+// finalizeInTx moves an authorization from the pending table to the final
+// one, with the contents of authz.
+func finalizeInTx(tx *gorp.Transaction, authz core.Authorization, oldAuth *pendingauthzModel) (err error) {
 	// Manually set the index, to avoid AUTOINCREMENT issues
 	var sequence int64
 	sequenceObj, err := tx.SelectNullInt("SELECT max(sequence) FROM authz")
@@ -502,26 +1040,67 @@ func (ssa *SQLStorageAuthority) FinalizeAuthorization(authz core.Authorization)
 	}
 
 	auth := &authzModel{authz, sequence}
-	authObj, err := tx.Get(pendingauthzModel{}, authz.ID)
+	err = tx.Insert(auth)
 	if err != nil {
-		tx.Rollback()
 		return
 	}
-	oldAuth := authObj.(*pendingauthzModel)
 
-	err = tx.Insert(auth)
+	_, err = tx.Delete(oldAuth)
+	return
+}
+
+// DeactivateAuthorization withdraws an authorization, whether it is still
+// pending or has already been validated, so that it can no longer be used to
+// issue certificates.
+func (ssa *SQLStorageAuthority) DeactivateAuthorization(id string) (authz core.Authorization, err error) {
+	tx, err := ssa.dbMap.Begin()
+	if err != nil {
+		return
+	}
+
+	authObj, err := tx.Get(pendingauthzModel{}, id)
 	if err != nil {
 		tx.Rollback()
 		return
 	}
+	if authObj != nil {
+		oldAuth := authObj.(*pendingauthzModel)
+		authz = oldAuth.Authorization
+		authz.Status = core.StatusDeactivated
+		if err = finalizeInTx(tx, authz, oldAuth); err != nil {
+			tx.Rollback()
+			return
+		}
 
-	_, err = tx.Delete(oldAuth)
+		err = tx.Commit()
+		return
+	}
+
+	authObj, err = tx.Get(authzModel{}, id)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	if authObj == nil {
+		err = fmt.Errorf("No pending_authz or authz with ID %s", id)
+		tx.Rollback()
+		return
+	}
+	auth := authObj.(*authzModel)
+	if auth.Status != core.StatusValid {
+		err = fmt.Errorf("Cannot deactivate an authorization with status %s", auth.Status)
+		tx.Rollback()
+		return
+	}
+	auth.Status = core.StatusDeactivated
+	_, err = tx.Update(auth)
 	if err != nil {
 		tx.Rollback()
 		return
 	}
 
 	err = tx.Commit()
+	authz = auth.Authorization
 	return
 }
 
@@ -570,6 +1149,30 @@ func (ssa *SQLStorageAuthority) AddCertificate(certDER []byte, regID int64) (dig
 		return
 	}
 
+	names := certificateNames(parsedCertificate)
+	for _, name := range names {
+		err = tx.Insert(&issuedNameModel{
+			ReversedName: reverseName(name),
+			Serial:       serial,
+			Issued:       cert.Issued,
+		})
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+	}
+
+	err = tx.Insert(&fqdnSetModel{
+		SetHash: hashNames(names),
+		Serial:  serial,
+		Issued:  cert.Issued,
+		Expires: cert.Expires,
+	})
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+
 	err = tx.Commit()
 	return
 }
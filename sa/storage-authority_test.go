@@ -12,7 +12,10 @@ import (
 	"crypto/x509/pkix"
 	"encoding/json"
 	"fmt"
+	"math/big"
+	"net"
 	"net/url"
+	"sort"
 	"time"
 
 	_ "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/mattn/go-sqlite3"
@@ -88,6 +91,126 @@ func TestAddRegistration(t *testing.T) {
 	test.AssertError(t, err, "Registration object for invalid key was returned")
 }
 
+func TestGetRegistrationByKeyWithoutDigest(t *testing.T) {
+	sa := initSA(t)
+
+	var jwk jose.JsonWebKey
+	err := json.Unmarshal([]byte(theKey), &jwk)
+	test.AssertNotError(t, err, "JSON unmarshal error")
+
+	// Stored before key digests were
+	legacy := &regModel{Registration: core.Registration{Key: jwk, Agreement: "yes"}}
+	err = sa.dbMap.Insert(legacy)
+	test.AssertNotError(t, err, "Couldn't store registration without a key digest")
+
+	dbReg, err := sa.GetRegistrationByKey(jwk)
+	test.AssertNotError(t, err, "Couldn't get registration without a key digest by key")
+	test.AssertEquals(t, dbReg.ID, legacy.ID)
+	test.AssertEquals(t, dbReg.Agreement, "yes")
+
+	// The digest has been filled in, so the key can't be used again
+	digest, err := core.KeyDigest(jwk)
+	test.AssertNotError(t, err, "Couldn't compute key digest")
+	stored, err := sa.dbMap.SelectStr("SELECT jwkSHA256 FROM registrations WHERE id = :id", map[string]interface{}{"id": legacy.ID})
+	test.AssertNotError(t, err, "Couldn't read key digest")
+	test.AssertEquals(t, stored, digest)
+	_, err = sa.NewRegistration(core.Registration{Key: jwk})
+	test.AssertEquals(t, err, errKeyInUse)
+
+	dbReg, err = sa.GetRegistrationByKey(jwk)
+	test.AssertNotError(t, err, "Couldn't get registration by key once its digest was filled in")
+	test.AssertEquals(t, dbReg.ID, legacy.ID)
+}
+
+func TestUpdateRegistrationKey(t *testing.T) {
+	sa := initSA(t)
+
+	var jwk jose.JsonWebKey
+	err := json.Unmarshal([]byte(theKey), &jwk)
+	test.AssertNotError(t, err, "JSON unmarshal error")
+
+	reg, err := sa.NewRegistration(core.Registration{
+		Key: jwk,
+	})
+	test.AssertNotError(t, err, "Couldn't create new registration")
+
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	test.AssertNotError(t, err, "Couldn't generate new key")
+	newKey := jose.JsonWebKey{Key: &priv.PublicKey}
+
+	updated, err := sa.UpdateRegistrationKey(reg, newKey)
+	test.AssertNotError(t, err, "Couldn't update registration key")
+	test.AssertEquals(t, updated.ID, reg.ID)
+	test.Assert(t, core.KeyDigestEquals(updated.Key, newKey), "Updated key != new key")
+
+	dbReg, err := sa.GetRegistrationByKey(newKey)
+	test.AssertNotError(t, err, "Couldn't get registration by new key")
+	test.AssertEquals(t, dbReg.ID, reg.ID)
+
+	_, err = sa.GetRegistrationByKey(jwk)
+	test.AssertError(t, err, "Registration was returned for old key")
+
+	// The registration no longer has the key it had when this request was made
+	_, err = sa.UpdateRegistrationKey(reg, jwk)
+	test.AssertError(t, err, "Updated key of a registration whose key had changed")
+
+	// A key that is in use by another registration can't be reused
+	other, err := sa.NewRegistration(core.Registration{
+		Key: jwk,
+	})
+	test.AssertNotError(t, err, "Couldn't create second registration")
+	_, err = sa.UpdateRegistrationKey(other, newKey)
+	test.AssertError(t, err, "Updated key to one used by another registration")
+	_, ok := err.(core.MalformedRequestError)
+	test.Assert(t, ok, "Reusing a key should be a malformed request")
+
+	// Nor can a new registration take it
+	_, err = sa.NewRegistration(core.Registration{
+		Key: newKey,
+	})
+	test.AssertError(t, err, "Created a registration with a key already in use")
+	_, ok = err.(core.MalformedRequestError)
+	test.Assert(t, ok, "Reusing a key should be a malformed request")
+}
+
+func TestDeactivateRegistration(t *testing.T) {
+	sa := initSA(t)
+
+	var jwk jose.JsonWebKey
+	err := json.Unmarshal([]byte(theKey), &jwk)
+	test.AssertNotError(t, err, "JSON unmarshal error")
+
+	reg, err := sa.NewRegistration(core.Registration{
+		Key:    jwk,
+		Status: core.StatusValid,
+	})
+	test.AssertNotError(t, err, "Couldn't create new registration")
+
+	pending, err := sa.NewPendingAuthorization(core.Authorization{RegistrationID: reg.ID, Status: core.StatusPending})
+	test.AssertNotError(t, err, "Couldn't create pending authorization")
+	other, err := sa.NewPendingAuthorization(core.Authorization{RegistrationID: reg.ID + 1, Status: core.StatusPending})
+	test.AssertNotError(t, err, "Couldn't create pending authorization")
+
+	updated, err := sa.DeactivateRegistration(reg.ID)
+	test.AssertNotError(t, err, "Couldn't deactivate registration")
+	test.AssertEquals(t, updated.Status, core.StatusDeactivated)
+
+	dbReg, err := sa.GetRegistration(reg.ID)
+	test.AssertNotError(t, err, "Couldn't get registration")
+	test.AssertEquals(t, dbReg.Status, core.StatusDeactivated)
+
+	authz, err := sa.GetAuthorization(pending.ID)
+	test.AssertNotError(t, err, "Couldn't get authorization")
+	test.AssertEquals(t, authz.Status, core.StatusInvalid)
+
+	authz, err = sa.GetAuthorization(other.ID)
+	test.AssertNotError(t, err, "Couldn't get authorization")
+	test.AssertEquals(t, authz.Status, core.StatusPending)
+
+	_, err = sa.DeactivateRegistration(reg.ID + 100)
+	test.AssertError(t, err, "Deactivated a registration that doesn't exist")
+}
+
 func TestAddAuthorization(t *testing.T) {
 	sa := initSA(t)
 
@@ -124,11 +247,280 @@ func TestAddAuthorization(t *testing.T) {
 	test.AssertNotError(t, err, "Couldn't update pending authorization with ID "+PA.ID)
 
 	newPa.Status = core.StatusValid
+	newPa.Challenges[0].ValidationRecord = []core.ValidationRecord{{
+		URL:               "http://wut.com/.well-known/acme-challenge/test-me",
+		Hostname:          "wut.com",
+		Port:              "80",
+		AddressesResolved: []net.IP{net.ParseIP("1.2.3.4"), net.ParseIP("::1:2:3:4")},
+		AddressUsed:       net.ParseIP("1.2.3.4"),
+	}}
 	err = sa.FinalizeAuthorization(newPa)
 	test.AssertNotError(t, err, "Couldn't finalize pending authorization with ID "+PA.ID)
 
 	dbPa, err = sa.GetAuthorization(PA.ID)
 	test.AssertNotError(t, err, "Couldn't get authorization with ID "+PA.ID)
+	test.AssertEquals(t, len(dbPa.Challenges), 1)
+	test.AssertEquals(t, len(dbPa.Challenges[0].ValidationRecord), 1)
+	record := dbPa.Challenges[0].ValidationRecord[0]
+	test.AssertEquals(t, record.URL, "http://wut.com/.well-known/acme-challenge/test-me")
+	test.AssertEquals(t, len(record.AddressesResolved), 2)
+	test.Assert(t, record.AddressUsed.Equal(net.ParseIP("1.2.3.4")), "Validation record's address wasn't stored")
+}
+
+func TestDeactivateAuthorization(t *testing.T) {
+	sa := initSA(t)
+
+	// A pending authorization is moved out of the pending table
+	pending, err := sa.NewPendingAuthorization(core.Authorization{Status: core.StatusPending})
+	test.AssertNotError(t, err, "Couldn't create pending authorization")
+	authz, err := sa.DeactivateAuthorization(pending.ID)
+	test.AssertNotError(t, err, "Couldn't deactivate pending authorization")
+	test.AssertEquals(t, authz.Status, core.StatusDeactivated)
+	dbAuthz, err := sa.GetAuthorization(pending.ID)
+	test.AssertNotError(t, err, "Couldn't get authorization")
+	test.AssertEquals(t, dbAuthz.Status, core.StatusDeactivated)
+	err = sa.UpdatePendingAuthorization(core.Authorization{ID: pending.ID, Status: core.StatusPending})
+	test.AssertError(t, err, "Updated a deactivated authorization")
+
+	// A valid authorization is updated in place
+	final, err := sa.NewPendingAuthorization(core.Authorization{Status: core.StatusPending})
+	test.AssertNotError(t, err, "Couldn't create pending authorization")
+	final.Status = core.StatusValid
+	err = sa.FinalizeAuthorization(final)
+	test.AssertNotError(t, err, "Couldn't finalize authorization")
+	authz, err = sa.DeactivateAuthorization(final.ID)
+	test.AssertNotError(t, err, "Couldn't deactivate valid authorization")
+	test.AssertEquals(t, authz.Status, core.StatusDeactivated)
+	dbAuthz, err = sa.GetAuthorization(final.ID)
+	test.AssertNotError(t, err, "Couldn't get authorization")
+	test.AssertEquals(t, dbAuthz.Status, core.StatusDeactivated)
+
+	_, err = sa.DeactivateAuthorization(final.ID)
+	test.AssertError(t, err, "Deactivated an authorization twice")
+	_, err = sa.DeactivateAuthorization("does-not-exist")
+	test.AssertError(t, err, "Deactivated an authorization that doesn't exist")
+}
+
+func TestGetValidAuthorizations(t *testing.T) {
+	sa := initSA(t)
+
+	now := time.Now()
+	finalize := func(regID int64, name string, status core.AcmeStatus, expires time.Time) core.Authorization {
+		authz, err := sa.NewPendingAuthorization(core.Authorization{RegistrationID: regID})
+		test.AssertNotError(t, err, "Couldn't create pending authorization")
+		authz.Identifier = core.AcmeIdentifier{Type: core.IdentifierDNS, Value: name}
+		authz.Status = status
+		authz.Expires = expires
+		err = sa.FinalizeAuthorization(authz)
+		test.AssertNotError(t, err, "Couldn't finalize authorization")
+		return authz
+	}
+
+	finalize(1, "example.com", core.StatusValid, now.Add(time.Hour))
+	latest := finalize(1, "example.com", core.StatusValid, now.Add(2*time.Hour))
+	finalize(1, "expired.com", core.StatusValid, now.Add(-time.Hour))
+	finalize(1, "invalid.com", core.StatusInvalid, now.Add(time.Hour))
+	finalize(2, "other.com", core.StatusValid, now.Add(time.Hour))
+	finalize(1, "unrequested.com", core.StatusValid, now.Add(time.Hour))
+
+	authzs, err := sa.GetValidAuthorizations(1, []string{"Example.com", "expired.com", "invalid.com", "other.com"}, now)
+	test.AssertNotError(t, err, "Couldn't get valid authorizations")
+	test.AssertEquals(t, len(authzs), 1)
+	test.AssertEquals(t, authzs["example.com"].ID, latest.ID)
+}
+
+func TestGetLatestAuthorization(t *testing.T) {
+	sa := initSA(t)
+
+	ident := core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "example.com"}
+	_, err := sa.GetLatestAuthorization(1, ident, core.StatusValid)
+	_, ok := err.(core.NotFoundError)
+	test.Assert(t, ok, "Should get a NotFoundError without any authorizations")
+
+	pending, err := sa.NewPendingAuthorization(core.Authorization{RegistrationID: 1, Identifier: ident, Status: core.StatusPending})
+	test.AssertNotError(t, err, "Couldn't create pending authorization")
+	got, err := sa.GetLatestAuthorization(1, ident, core.StatusPending)
+	test.AssertNotError(t, err, "Couldn't get pending authorization")
+	test.AssertEquals(t, got.ID, pending.ID)
+
+	var latestID string
+	for i := 1; i <= 3; i++ {
+		authz, err := sa.NewPendingAuthorization(core.Authorization{RegistrationID: 1, Identifier: ident})
+		test.AssertNotError(t, err, "Couldn't create pending authorization")
+		authz.Status = core.StatusValid
+		authz.Expires = time.Now().Add(time.Duration(i) * time.Hour)
+		err = sa.FinalizeAuthorization(authz)
+		test.AssertNotError(t, err, "Couldn't finalize authorization")
+		latestID = authz.ID
+	}
+
+	got, err = sa.GetLatestAuthorization(1, ident, core.StatusValid)
+	test.AssertNotError(t, err, "Couldn't get valid authorization")
+	test.AssertEquals(t, got.ID, latestID)
+	test.AssertEquals(t, got.Identifier, ident)
+
+	// Other registrations and identifiers don't match
+	_, err = sa.GetLatestAuthorization(2, ident, core.StatusValid)
+	test.AssertError(t, err, "Got another registration's authorization")
+	other := core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "www.example.com"}
+	_, err = sa.GetLatestAuthorization(1, other, core.StatusValid)
+	test.AssertError(t, err, "Got an authorization for another identifier")
+}
+
+func TestGetAuthorizationIDsByRegistration(t *testing.T) {
+	sa := initSA(t)
+
+	now := time.Now()
+	var ids []string
+	for i := 0; i < 3; i++ {
+		authz, err := sa.NewPendingAuthorization(core.Authorization{RegistrationID: 1, Status: core.StatusPending})
+		test.AssertNotError(t, err, "Couldn't create pending authorization")
+		ids = append(ids, authz.ID)
+	}
+	for i := 0; i < 3; i++ {
+		authz, err := sa.NewPendingAuthorization(core.Authorization{RegistrationID: 1})
+		test.AssertNotError(t, err, "Couldn't create pending authorization")
+		authz.Status = core.StatusValid
+		authz.Expires = now.Add(time.Duration(2*i-1) * time.Hour)
+		err = sa.FinalizeAuthorization(authz)
+		test.AssertNotError(t, err, "Couldn't finalize authorization")
+		ids = append(ids, authz.ID)
+	}
+	_, err := sa.NewPendingAuthorization(core.Authorization{RegistrationID: 2, Status: core.StatusPending})
+	test.AssertNotError(t, err, "Couldn't create pending authorization")
+	sort.Strings(ids)
+
+	// Page through everything
+	var paged []string
+	q := core.CollectionQuery{RegistrationID: 1, Limit: 4}
+	for {
+		page, err := sa.GetAuthorizationIDsByRegistration(q)
+		test.AssertNotError(t, err, "Couldn't get authorizations")
+		paged = append(paged, page...)
+		if len(page) < q.Limit {
+			break
+		}
+		q.Cursor = page[len(page)-1]
+	}
+	test.AssertMarshaledEquals(t, paged, ids)
+
+	page, err := sa.GetAuthorizationIDsByRegistration(core.CollectionQuery{
+		RegistrationID: 1,
+		Limit:          10,
+		Status:         string(core.StatusValid),
+		ExpiresAfter:   now,
+	})
+	test.AssertNotError(t, err, "Couldn't get authorizations")
+	test.AssertEquals(t, len(page), 2)
+}
+
+func TestGetCertificateSerialsByRegistration(t *testing.T) {
+	sa := initSA(t)
+
+	certDER, err := ioutil.ReadFile("www.eff.org.der")
+	test.AssertNotError(t, err, "Couldn't read example cert DER")
+	_, err = sa.AddCertificate(certDER, 7)
+	test.AssertNotError(t, err, "Couldn't add www.eff.org.der")
+
+	serials, err := sa.GetCertificateSerialsByRegistration(core.CollectionQuery{RegistrationID: 7, Limit: 10})
+	test.AssertNotError(t, err, "Couldn't get certificates")
+	test.AssertMarshaledEquals(t, serials, []string{"00000000000000000000000000021bd4"})
+
+	serials, err = sa.GetCertificateSerialsByRegistration(core.CollectionQuery{RegistrationID: 7, Limit: 10, Status: string(core.OCSPStatusRevoked)})
+	test.AssertNotError(t, err, "Couldn't get certificates")
+	test.AssertEquals(t, len(serials), 0)
+
+	serials, err = sa.GetCertificateSerialsByRegistration(core.CollectionQuery{RegistrationID: 7, Limit: 10, Cursor: "00000000000000000000000000021bd4"})
+	test.AssertNotError(t, err, "Couldn't get certificates")
+	test.AssertEquals(t, len(serials), 0)
+
+	serials, err = sa.GetCertificateSerialsByRegistration(core.CollectionQuery{RegistrationID: 8, Limit: 10})
+	test.AssertNotError(t, err, "Couldn't get certificates")
+	test.AssertEquals(t, len(serials), 0)
+}
+
+func TestGetCertificateRegistrationID(t *testing.T) {
+	sa := initSA(t)
+
+	certDER, err := ioutil.ReadFile("www.eff.org.der")
+	test.AssertNotError(t, err, "Couldn't read example cert DER")
+	_, err = sa.AddCertificate(certDER, 7)
+	test.AssertNotError(t, err, "Couldn't add www.eff.org.der")
+
+	regID, err := sa.GetCertificateRegistrationID("00000000000000000000000000021bd4")
+	test.AssertNotError(t, err, "Couldn't get registration ID for www.eff.org.der")
+	test.AssertEquals(t, regID, int64(7))
+
+	_, err = sa.GetCertificateRegistrationID("00000000000000000000000000021bd5")
+	test.AssertError(t, err, "Got registration ID for a certificate that doesn't exist")
+}
+
+func TestOrder(t *testing.T) {
+	sa := initSA(t)
+
+	_, err := sa.GetOrder("nonexistent")
+	test.AssertError(t, err, "Got an order that doesn't exist")
+	_, ok := err.(core.NotFoundError)
+	test.Assert(t, ok, "Missing order should be a NotFoundError")
+
+	order, err := sa.NewOrder(core.Order{
+		RegistrationID: 1,
+		Status:         core.StatusPending,
+		Expires:        time.Now().Add(time.Hour),
+		Identifiers: []core.AcmeIdentifier{
+			core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "example.com"},
+			core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "www.example.com"},
+		},
+		Authorizations: []string{"authz1", "authz2"},
+	})
+	test.AssertNotError(t, err, "Couldn't create order")
+	test.Assert(t, order.ID != "", "ID shouldn't be blank")
+
+	dbOrder, err := sa.GetOrder(order.ID)
+	test.AssertNotError(t, err, "Couldn't get order")
+	test.AssertEquals(t, dbOrder.RegistrationID, int64(1))
+	test.AssertEquals(t, dbOrder.Status, core.StatusPending)
+	test.AssertMarshaledEquals(t, dbOrder.Identifiers, order.Identifiers)
+	test.AssertMarshaledEquals(t, dbOrder.Authorizations, order.Authorizations)
+
+	// Only an order that's processing can be updated
+	dbOrder.Status = core.StatusValid
+	dbOrder.CertificateSerial = "00000000000000000000000000000001"
+	err = sa.UpdateOrder(dbOrder)
+	test.AssertError(t, err, "Updated an order that was still pending")
+
+	hourAgo := time.Now().Add(-time.Hour)
+	err = sa.SetOrderProcessing(order.ID, hourAgo)
+	test.AssertNotError(t, err, "Couldn't start processing order")
+	err = sa.SetOrderProcessing(order.ID, hourAgo)
+	test.AssertError(t, err, "Started processing an order twice")
+	_, ok = err.(core.MalformedRequestError)
+	test.Assert(t, ok, "Processing an order twice should be a malformed request")
+
+	// Once it's been processing for long enough, another finalization can
+	// take the order over
+	err = sa.SetOrderProcessing(order.ID, time.Now().Add(time.Minute))
+	test.AssertNotError(t, err, "Couldn't take over an order left processing")
+
+	err = sa.UpdateOrder(dbOrder)
+	test.AssertNotError(t, err, "Couldn't update order")
+
+	// The original copy is now stale and shouldn't overwrite the update
+	err = sa.UpdateOrder(order)
+	test.AssertError(t, err, "Updated order from a stale copy")
+
+	dbOrder, err = sa.GetOrder(order.ID)
+	test.AssertNotError(t, err, "Couldn't get order")
+	test.AssertEquals(t, dbOrder.Status, core.StatusValid)
+	test.AssertEquals(t, dbOrder.CertificateSerial, "00000000000000000000000000000001")
+
+	err = sa.SetOrderProcessing(order.ID, time.Now().Add(time.Minute))
+	test.AssertError(t, err, "Started processing an order that was already valid")
+
+	err = sa.UpdateOrder(core.Order{ID: "nonexistent"})
+	test.AssertError(t, err, "Updated an order that doesn't exist")
+	err = sa.SetOrderProcessing("nonexistent", hourAgo)
+	test.AssertError(t, err, "Started processing an order that doesn't exist")
 }
 
 func TestAddCertificate(t *testing.T) {
@@ -181,6 +573,103 @@ func TestAddCertificate(t *testing.T) {
 	test.Assert(t, certificateStatus2.OCSPLastUpdated.IsZero(), "OCSPLastUpdated should be nil")
 }
 
+func TestCountCertificates(t *testing.T) {
+	sa := initSA(t)
+	before := time.Now().Add(-time.Minute)
+
+	// Covers www.eff.org, eff.org and *.eff.org
+	certDER, err := ioutil.ReadFile("www.eff.org.der")
+	test.AssertNotError(t, err, "Couldn't read example cert DER")
+	_, err = sa.AddCertificate(certDER, 1)
+	test.AssertNotError(t, err, "Couldn't add www.eff.org.der")
+
+	counts, err := sa.CountCertificatesByNames([]string{"eff.org", "www.eff.org", "ff.org", "example.com"}, before)
+	test.AssertNotError(t, err, "Couldn't count certificates by name")
+	test.AssertEquals(t, counts["eff.org"], int64(1))
+	test.AssertEquals(t, counts["www.eff.org"], int64(1))
+	test.AssertEquals(t, counts["ff.org"], int64(0))
+	test.AssertEquals(t, counts["example.com"], int64(0))
+
+	counts, err = sa.CountCertificatesByNames([]string{"eff.org"}, time.Now().Add(time.Minute))
+	test.AssertNotError(t, err, "Couldn't count certificates by name")
+	test.AssertEquals(t, counts["eff.org"], int64(0))
+
+	count, err := sa.CountCertificatesByFQDNSet([]string{"EFF.org", "*.eff.org", "www.eff.org", "eff.org"}, before)
+	test.AssertNotError(t, err, "Couldn't count certificates by FQDN set")
+	test.AssertEquals(t, count, int64(1))
+	count, err = sa.CountCertificatesByFQDNSet([]string{"eff.org", "www.eff.org"}, before)
+	test.AssertNotError(t, err, "Couldn't count certificates by FQDN set")
+	test.AssertEquals(t, count, int64(0))
+
+	count, err = sa.CountNamesByRegistration(1, before)
+	test.AssertNotError(t, err, "Couldn't count names by registration")
+	test.AssertEquals(t, count, int64(3))
+	count, err = sa.CountNamesByRegistration(2, before)
+	test.AssertNotError(t, err, "Couldn't count names by registration")
+	test.AssertEquals(t, count, int64(0))
+}
+
+func TestCountRegistrationsByIP(t *testing.T) {
+	sa := initSA(t)
+	before := time.Now().Add(-time.Minute)
+
+	jwk := jose.JsonWebKey{Key: &rsa.PublicKey{N: big.NewInt(1), E: 1}}
+	_, err := sa.NewRegistration(core.Registration{
+		Key:       jwk,
+		InitialIP: net.ParseIP("43.34.43.34"),
+		CreatedAt: time.Now(),
+	})
+	test.AssertNotError(t, err, "Couldn't create new registration")
+	jwk = jose.JsonWebKey{Key: &rsa.PublicKey{N: big.NewInt(2), E: 1}}
+	_, err = sa.NewRegistration(core.Registration{
+		Key:       jwk,
+		InitialIP: net.ParseIP("43.34.43.34").To4(),
+		CreatedAt: time.Now(),
+	})
+	test.AssertNotError(t, err, "Couldn't create new registration")
+
+	count, err := sa.CountRegistrationsByIP(net.ParseIP("43.34.43.34"), before)
+	test.AssertNotError(t, err, "Couldn't count registrations by IP")
+	test.AssertEquals(t, count, int64(2))
+	count, err = sa.CountRegistrationsByIP(net.ParseIP("43.34.43.34"), time.Now().Add(time.Minute))
+	test.AssertNotError(t, err, "Couldn't count registrations by IP")
+	test.AssertEquals(t, count, int64(0))
+	count, err = sa.CountRegistrationsByIP(net.ParseIP("2001:db8::1"), before)
+	test.AssertNotError(t, err, "Couldn't count registrations by IP")
+	test.AssertEquals(t, count, int64(0))
+}
+
+func TestCountPendingAuthorizations(t *testing.T) {
+	sa := initSA(t)
+
+	count, err := sa.CountPendingAuthorizations(1)
+	test.AssertNotError(t, err, "Couldn't count pending authorizations")
+	test.AssertEquals(t, count, int64(0))
+
+	expires := time.Now().Add(time.Hour)
+	pending, err := sa.NewPendingAuthorization(core.Authorization{RegistrationID: 1, Status: core.StatusPending, Expires: expires})
+	test.AssertNotError(t, err, "Couldn't create new pending authorization")
+	_, err = sa.NewPendingAuthorization(core.Authorization{RegistrationID: 1, Status: core.StatusPending, Expires: expires})
+	test.AssertNotError(t, err, "Couldn't create new pending authorization")
+	_, err = sa.NewPendingAuthorization(core.Authorization{RegistrationID: 2, Status: core.StatusPending, Expires: expires})
+	test.AssertNotError(t, err, "Couldn't create new pending authorization")
+
+	// Expired pending authorizations don't count
+	_, err = sa.NewPendingAuthorization(core.Authorization{RegistrationID: 1, Status: core.StatusPending, Expires: time.Now().Add(-time.Hour)})
+	test.AssertNotError(t, err, "Couldn't create new pending authorization")
+
+	count, err = sa.CountPendingAuthorizations(1)
+	test.AssertNotError(t, err, "Couldn't count pending authorizations")
+	test.AssertEquals(t, count, int64(2))
+
+	pending.Status = core.StatusValid
+	err = sa.FinalizeAuthorization(pending)
+	test.AssertNotError(t, err, "Couldn't finalize pending authorization")
+	count, err = sa.CountPendingAuthorizations(1)
+	test.AssertNotError(t, err, "Couldn't count pending authorizations")
+	test.AssertEquals(t, count, int64(1))
+}
+
 // TestGetCertificateByShortSerial tests some failure conditions for GetCertificate.
 // Success conditions are tested above in TestAddCertificate.
 func TestGetCertificateByShortSerial(t *testing.T) {
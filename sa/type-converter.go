@@ -11,6 +11,7 @@ import (
 	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/square/go-jose"
 	gorp "github.com/letsencrypt/boulder/Godeps/_workspace/src/gopkg.in/gorp.v1"
 	"github.com/letsencrypt/boulder/core"
+	"net"
 )
 
 // BoulderTypeConverter is used by Gorp for storing objects in DB.
@@ -19,7 +20,7 @@ type BoulderTypeConverter struct{}
 // ToDb converts a Boulder object to one suitable for the DB representation.
 func (tc BoulderTypeConverter) ToDb(val interface{}) (interface{}, error) {
 	switch t := val.(type) {
-	case core.AcmeIdentifier, []core.Challenge, []core.AcmeURL, [][]int:
+	case core.AcmeIdentifier, []core.AcmeIdentifier, []core.Challenge, []core.AcmeURL, [][]int, []string:
 		jsonBytes, err := json.Marshal(t)
 		if err != nil {
 			return nil, err
@@ -35,6 +36,14 @@ func (tc BoulderTypeConverter) ToDb(val interface{}) (interface{}, error) {
 		return string(t), nil
 	case core.OCSPStatus:
 		return string(t), nil
+	case net.IP:
+		// Always store the 16-byte form so that lookups by IP match however
+		// the address was parsed
+		b := []byte(t.To16())
+		if b == nil {
+			b = []byte{}
+		}
+		return b, nil
 	default:
 		return val, nil
 	}
@@ -43,7 +52,7 @@ func (tc BoulderTypeConverter) ToDb(val interface{}) (interface{}, error) {
 // FromDb converts a DB representation back into a Boulder object.
 func (tc BoulderTypeConverter) FromDb(target interface{}) (gorp.CustomScanner, bool) {
 	switch target.(type) {
-	case *core.AcmeIdentifier, *[]core.Challenge, *[]core.AcmeURL, *[][]int, core.JsonBuffer:
+	case *core.AcmeIdentifier, *[]core.AcmeIdentifier, *[]core.Challenge, *[]core.AcmeURL, *[][]int, *[]string, core.JsonBuffer:
 		binder := func(holder, target interface{}) error {
 			s, ok := holder.(*string)
 			if !ok {
@@ -88,6 +97,16 @@ func (tc BoulderTypeConverter) FromDb(target interface{}) (gorp.CustomScanner, b
 			return nil
 		}
 		return gorp.CustomScanner{Holder: new(string), Target: target, Binder: binder}, true
+	case *net.IP:
+		binder := func(holder, target interface{}) error {
+			b := holder.(*[]byte)
+			ip := target.(*net.IP)
+			if len(*b) > 0 {
+				*ip = net.IP(*b)
+			}
+			return nil
+		}
+		return gorp.CustomScanner{Holder: new([]byte), Target: target, Binder: binder}, true
 	default:
 		return gorp.CustomScanner{}, false
 	}
@@ -30,6 +30,13 @@ def run(path):
         ''' % binary, shell=True))
 
 def start():
+    binary = os.path.join(tempdir, 'dns-test-srv')
+    cmd = 'go build -o %s ./test/dns-test-srv' % binary
+    print(cmd)
+    if subprocess.Popen(cmd, shell=True).wait() != 0:
+        die()
+    processes.append(subprocess.Popen('exec %s' % binary, shell=True))
+
     run('./cmd/boulder-wfe')
     run('./cmd/boulder-ra')
     run('./cmd/boulder-sa')
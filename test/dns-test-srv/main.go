@@ -0,0 +1,120 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// dns-test-srv is a stub recursive resolver for the integration tests.  Every
+// name resolves to 127.0.0.1 and has an MX record; there are no TXT or CAA
+// records and no IPv6 addresses.
+package main
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+)
+
+const (
+	typeA  = 1
+	typeMX = 15
+)
+
+// answer returns the response to query, or nil if it's malformed.
+func answer(query []byte) []byte {
+	if len(query) < 12 {
+		return nil
+	}
+	i := 12
+	for i < len(query) && query[i] != 0 {
+		i += 1 + int(query[i])
+	}
+	questionEnd := i + 5 // Terminating zero, type and class
+	if questionEnd > len(query) {
+		return nil
+	}
+	qtype := binary.BigEndian.Uint16(query[i+1:])
+
+	var rdata []byte
+	switch qtype {
+	case typeA:
+		rdata = []byte{127, 0, 0, 1}
+	case typeMX:
+		// Preference 10, then mail plus a pointer to the question name
+		rdata = []byte{0, 10, 4, 'm', 'a', 'i', 'l', 0xc0, 12}
+	}
+
+	response := []byte{query[0], query[1], 0x81, 0x80, 0, 1, 0, 0, 0, 0, 0, 0}
+	response = append(response, query[12:questionEnd]...)
+	if rdata != nil {
+		response[7] = 1
+		response = append(response,
+			0xc0, 12, // Pointer to the question name
+			byte(qtype>>8), byte(qtype),
+			0, 1, // IN
+			0, 0, 0, 60, // TTL
+			0, byte(len(rdata)))
+		response = append(response, rdata...)
+	}
+	return response
+}
+
+func serveUDP(conn net.PacketConn) {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Reading DNS query: %s\n", err)
+			os.Exit(1)
+		}
+		if response := answer(buf[:n]); response != nil {
+			conn.WriteTo(response, addr)
+		}
+	}
+}
+
+func serveTCP(conn net.Conn) {
+	defer conn.Close()
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return
+	}
+	query := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, query); err != nil {
+		return
+	}
+	response := answer(query)
+	if response == nil {
+		return
+	}
+	binary.BigEndian.PutUint16(length[:], uint16(len(response)))
+	conn.Write(append(length[:], response...))
+}
+
+func main() {
+	listen := flag.String("listen", "127.0.0.1:8053", "Address to answer DNS queries on, over UDP and TCP")
+	flag.Parse()
+
+	udpConn, err := net.ListenPacket("udp", *listen)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't listen for DNS over UDP: %s\n", err)
+		os.Exit(1)
+	}
+	tcpListener, err := net.Listen("tcp", *listen)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't listen for DNS over TCP: %s\n", err)
+		os.Exit(1)
+	}
+
+	go serveUDP(udpConn)
+	for {
+		conn, err := tcpListener.Accept()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Accepting DNS connection: %s\n", err)
+			os.Exit(1)
+		}
+		go serveTCP(conn)
+	}
+}
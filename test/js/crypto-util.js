@@ -8,7 +8,6 @@ var forge = require("node-forge");
 var util = require("./acme-util.js");
 
 var TOKEN_SIZE = 16;
-var NONCE_SIZE = 16;
 
 function bytesToBuffer(bytes) {
   return new Buffer(forge.util.bytesToHex(bytes), "hex");
@@ -139,13 +138,13 @@ module.exports = {
 
   ///// SIGNATURE GENERATION / VERIFICATION
 
-  generateSignature: function(keyPair, payload) {
-    var nonce = bytesToBuffer(forge.random.getBytesSync(NONCE_SIZE));
+  // The nonce must be one provided by the server in a Replay-Nonce header
+  generateSignature: function(keyPair, payload, nonce) {
     var privateKey = importPrivateKey(keyPair.privateKey);
 
     // Compute JWS signature
     var protectedHeader = JSON.stringify({
-      nonce: util.b64enc(nonce)
+      nonce: nonce
     });
     var protected64 = util.b64enc(new Buffer(protectedHeader));
     var payload64 = util.b64enc(payload);
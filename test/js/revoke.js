@@ -29,19 +29,27 @@ function main() {
     certificate: certDERB64URL
   });
   console.log('Requesting revocation:', revokeMessage)
-  var jws = crypto.generateSignature(key, new Buffer(revokeMessage));
-  var req = request.post(revokeUrl, function(err, resp) {
-    if (err) {
-      console.log('Error: ', err);
+  // Any response from the server carries a nonce we can use to sign with
+  request.head(revokeUrl, function(err, resp) {
+    if (err || !resp.headers['replay-nonce']) {
+      console.log('Unable to get a nonce: ', err);
       process.exit(1);
     }
-    console.log(resp.statusCode);
-    console.log(resp.headers);
-    console.log(resp.body);
+    var nonce = resp.headers['replay-nonce'];
+    var jws = crypto.generateSignature(key, new Buffer(revokeMessage), nonce);
+    var req = request.post(revokeUrl, function(err, resp) {
+      if (err) {
+        console.log('Error: ', err);
+        process.exit(1);
+      }
+      console.log(resp.statusCode);
+      console.log(resp.headers);
+      console.log(resp.body);
+    });
+    var payload = JSON.stringify(jws);
+    console.log(payload);
+    req.write(payload);
+    req.end();
   });
-  var payload = JSON.stringify(jws);
-  console.log(payload);
-  req.write(payload);
-  req.end();
 }
 main();
@@ -104,6 +104,9 @@ var state = {
   certPrivateKey: null,
   accountPrivateKey: null,
 
+  // Anti-replay nonce from the most recent response, needed for the next POST
+  nonce: null,
+
   newRegistrationURL: cliOptions.newReg,
   registrationURL: "",
 
@@ -153,9 +156,22 @@ function parseLink(link) {
   }
 }
 
+// Every response from the server carries a fresh nonce for the next POST.
+// Before the first POST there is nothing to take it from, so ask for one.
+function getNonce(url, callback) {
+  request.head(url, function(error, response) {
+    if (error || !response.headers["replay-nonce"]) {
+      console.log("Unable to get a nonce from the server");
+      process.exit(1);
+    }
+    state.nonce = response.headers["replay-nonce"];
+    callback();
+  });
+}
+
 function post(url, body, callback) {
   var payload = JSON.stringify(body, null, 2);
-  var jws = crypto.generateSignature(state.accountPrivateKey, new Buffer(payload));
+  var jws = crypto.generateSignature(state.accountPrivateKey, new Buffer(payload), state.nonce);
   var signed = JSON.stringify(jws, null, 2);
 
   console.log('Posting to', url, ':');
@@ -178,6 +194,7 @@ function post(url, body, callback) {
     callback(error, response, body)
   });
   req.on('response', function(response) {
+    state.nonce = response.headers["replay-nonce"];
     Object.keys(response.headers).forEach(function(key) {
       var value = response.headers[key];
       var upcased = key.charAt(0).toUpperCase() + key.slice(1);
@@ -265,9 +282,11 @@ function register(answers) {
   var email = answers.email;
 
   // Register public key
-  post(state.newRegistrationURL, {
-    contact: [ "mailto:" + email ]
-  }, getTerms);
+  getNonce(state.newRegistrationURL, function() {
+    post(state.newRegistrationURL, {
+      contact: [ "mailto:" + email ]
+    }, getTerms);
+  });
 }
 
 function getTerms(err, resp) {
@@ -0,0 +1,136 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package va
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/letsencrypt/boulder/core"
+)
+
+// CAASet holds the CAA records that apply to a name, sorted by property
+type CAASet struct {
+	Issue     []*core.CAA
+	Issuewild []*core.CAA
+	Iodef     []*core.CAA
+	Unknown   []*core.CAA
+}
+
+func newCAASet(caas []*core.CAA) *CAASet {
+	caaSet := &CAASet{}
+	for _, caa := range caas {
+		switch strings.ToLower(caa.Tag) {
+		case "issue":
+			caaSet.Issue = append(caaSet.Issue, caa)
+		case "issuewild":
+			caaSet.Issuewild = append(caaSet.Issuewild, caa)
+		case "iodef":
+			caaSet.Iodef = append(caaSet.Iodef, caa)
+		default:
+			caaSet.Unknown = append(caaSet.Unknown, caa)
+		}
+	}
+	return caaSet
+}
+
+// criticalUnknown reports whether any records with properties we don't
+// understand are marked critical, in which case we mustn't issue (RFC 6844
+// section 5.1).
+func (caaSet CAASet) criticalUnknown() bool {
+	for _, caa := range caaSet.Unknown {
+		if caa.Critical() {
+			return true
+		}
+	}
+	return false
+}
+
+// issuerDomain returns the domain an issue record names, leaving out any
+// parameters.  It's empty for records that forbid issuance entirely.
+func issuerDomain(value string) string {
+	if i := strings.Index(value, ";"); i >= 0 {
+		value = value[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+// Used for audit logging
+type caaCheckEvent struct {
+	Hostname string      `json:",omitempty"`
+	Records  []*core.CAA `json:",omitempty"`
+	Error    string      `json:",omitempty"`
+}
+
+// getCAASet returns the CAA records of hostname, or if it has none those of
+// its closest ancestor that does (RFC 6844 section 4).  It returns nil if
+// there are none all the way up.  The records found are also put in the
+// logEvent.
+func (va ValidationAuthorityImpl) getCAASet(hostname string, logEvent *caaCheckEvent) (*CAASet, error) {
+	labels := strings.Split(strings.TrimSuffix(hostname, "."), ".")
+	for i := range labels {
+		name := strings.Join(labels[i:], ".")
+		caas, _, err := va.DNSResolver.LookupCAA(name)
+		if err != nil {
+			return nil, err
+		}
+		if len(caas) > 0 {
+			logEvent.Records = caas
+			return newCAASet(caas), nil
+		}
+	}
+	return nil, nil
+}
+
+// validateCAASet reports whether the records allow us to issue for a name
+// that isn't a wildcard.
+func (va ValidationAuthorityImpl) validateCAASet(caaSet *CAASet) bool {
+	if caaSet.criticalUnknown() {
+		return false
+	}
+	if len(caaSet.Issue) == 0 {
+		// Only properties that don't restrict who may issue for this name
+		return true
+	}
+	for _, caa := range caaSet.Issue {
+		domain := issuerDomain(caa.Value)
+		for _, identity := range va.CAAIdentities {
+			if domain == strings.ToLower(identity) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CheckCAARecords looks up the CAA records that apply to identifier and
+// reports whether there are any, and whether they allow us to issue for it.
+func (va ValidationAuthorityImpl) CheckCAARecords(identifier core.AcmeIdentifier) (present, valid bool, err error) {
+	if identifier.Type != core.IdentifierDNS {
+		return false, false, core.MalformedRequestError("Identifier type for CAA check was not DNS")
+	}
+	hostname := strings.ToLower(identifier.Value)
+	logEvent := caaCheckEvent{Hostname: hostname}
+
+	caaSet, err := va.getCAASet(hostname, &logEvent)
+	if err != nil {
+		logEvent.Error = err.Error()
+		// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+		va.log.AuditObject("CAA lookup failed", logEvent)
+		return false, false, core.DNSError(fmt.Sprintf("Could not look up CAA records for %s: %s", hostname, err))
+	}
+	if caaSet == nil {
+		// No CAA records, so anyone may issue
+		return false, true, nil
+	}
+
+	valid = va.validateCAASet(caaSet)
+	if !valid {
+		// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+		va.log.AuditObject("CAA records forbid issuance", logEvent)
+	}
+	return true, valid, nil
+}
@@ -0,0 +1,93 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package va
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/letsencrypt/boulder/core"
+)
+
+// ValidationTarget is where on a subscriber's server the VA connects to for
+// a type of challenge.
+type ValidationTarget struct {
+	// "http" or "https", for challenges fetched over HTTP
+	Scheme string
+	Port   int
+}
+
+// Where subscribers' servers are expected to answer each type of challenge
+var defaultTargets = map[string]ValidationTarget{
+	core.ChallengeTypeSimpleHTTPS: {Scheme: "https", Port: 443},
+	core.ChallengeTypeDVSNI:       {Port: 443},
+	core.ChallengeTypeHTTP01:      {Scheme: "http", Port: 80},
+	core.ChallengeTypeTLSALPN01:   {Port: 443},
+}
+
+// Where the test servers answer instead in TestMode
+var testModeTargets = map[string]ValidationTarget{
+	core.ChallengeTypeSimpleHTTPS: {Scheme: "http", Port: 5001},
+	core.ChallengeTypeDVSNI:       {Port: 5001},
+	core.ChallengeTypeHTTP01:      {Scheme: "http", Port: 5002},
+	core.ChallengeTypeTLSALPN01:   {Port: 5001},
+}
+
+// target returns where to connect to for a challenge of type challengeType:
+// the configured scheme and port, or else the defaults for the mode we're in.
+func (va ValidationAuthorityImpl) target(challengeType string) ValidationTarget {
+	target := defaultTargets[challengeType]
+	if va.TestMode {
+		target = testModeTargets[challengeType]
+	}
+	if configured, ok := va.Validation.Targets[challengeType]; ok {
+		if configured.Scheme != "" {
+			target.Scheme = configured.Scheme
+		}
+		if configured.Port != 0 {
+			target.Port = configured.Port
+		}
+	}
+	return target
+}
+
+// hostPort returns name joined with the target's port, for dialing.
+func (target ValidationTarget) hostPort(name string) string {
+	return net.JoinHostPort(name, strconv.Itoa(target.Port))
+}
+
+// urlHost returns name as the host part of a URL on the target, which only
+// includes the port if it isn't the scheme's usual one.
+func (target ValidationTarget) urlHost(name string) string {
+	if (target.Scheme == "http" && target.Port == 80) || (target.Scheme == "https" && target.Port == 443) {
+		return name
+	}
+	return target.hostPort(name)
+}
+
+// testHostOverride returns the address and port to connect to instead of
+// host and port in TestMode, from TestHostOverrides.  The address is nil
+// outside TestMode and for hosts without an override, which are looked up
+// and checked against BlockedNetworks as usual.
+func (va ValidationAuthorityImpl) testHostOverride(host, port string) (net.IP, string, error) {
+	if !va.TestMode {
+		return nil, port, nil
+	}
+	override, ok := va.Validation.TestHostOverrides[host]
+	if !ok {
+		return nil, port, nil
+	}
+	address := override
+	if overrideHost, overridePort, err := net.SplitHostPort(override); err == nil {
+		address, port = overrideHost, overridePort
+	}
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return nil, port, fmt.Errorf("Invalid test host override for %s: %s", host, override)
+	}
+	return ip, port, nil
+}
@@ -9,12 +9,20 @@ import (
 	"crypto/sha256"
 	"crypto/subtle"
 	"crypto/tls"
+	"encoding/asn1"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
 	"github.com/letsencrypt/boulder/core"
 	blog "github.com/letsencrypt/boulder/log"
 )
@@ -23,22 +31,266 @@ type ValidationAuthorityImpl struct {
 	RA       core.RegistrationAuthority
 	log      *blog.AuditLogger
 	TestMode bool
+
+	// Used to find subscribers' servers and DNS challenge and CAA records
+	DNSResolver core.DNSResolver
+
+	// Domain names identifying this CA in CAA issue records
+	CAAIdentities []string
+
+	// Address ranges we won't connect to when validating, so subscribers
+	// can't point us at our own network.  In TestMode loopback addresses
+	// are allowed regardless, since that's where the test servers are.
+	BlockedNetworks []*net.IPNet
+
+	// How validations are scheduled, retried and timed out
+	Validation ValidationConfig
+
+	Stats statsd.Statter
+
+	// Validations waiting for a worker, once Start has been called
+	queue chan validationRequest
+}
+
+// How long to wait for a subscriber's server to connect and respond, unless
+// configured otherwise for the challenge type
+const validationTimeout = 5 * time.Second
+
+// The label under the identifier's name where DNS challenges are provisioned
+const dnsChallengePrefix = "_acme-challenge."
+
+const (
+	// How many redirects to follow when fetching an http-01 response
+	maxRedirects = 10
+
+	// The most we'll read of an http-01 response; a key authorization is
+	// much shorter
+	maxResponseSize = 128
+
+	// How much of a validation's records is kept with the challenge, which
+	// has to fit in the authorization's challenges column: the records at
+	// either end of a redirect chain, a few of the addresses each name
+	// resolved to, and the start of each URL.  The audit log gets them all.
+	maxValidationRecords   = 3
+	maxValidationAddresses = 4
+	maxValidationURLLength = 256
+)
+
+// The ALPN protocol offered when validating tls-alpn-01 challenges
+const acmeTLSALPNProtocol = "acme-tls/1"
+
+// The critical extension a tls-alpn-01 certificate carries the digest of the
+// key authorization in
+var idPeAcmeIdentifier = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}
+
+// DefaultBlockedNetworks are the special-purpose address ranges of RFC 6890
+// and RFC 5771 that no subscriber's server should be in: private, shared,
+// loopback, link-local, documentation, multicast and reserved blocks.
+var DefaultBlockedNetworks = []string{
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.0.2.0/24",
+	"192.88.99.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"198.51.100.0/24",
+	"203.0.113.0/24",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"100::/64",
+	"2001::/23",
+	"2001:db8::/32",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
 }
 
 func NewValidationAuthorityImpl(tm bool) ValidationAuthorityImpl {
 	logger := blog.GetAuditLogger()
 	logger.Notice("Validation Authority Starting")
-	return ValidationAuthorityImpl{log: logger, TestMode: tm}
+	blocked, err := core.ParseNetworks(DefaultBlockedNetworks)
+	if err != nil {
+		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
+		logger.EmergencyExit(fmt.Sprintf("Couldn't parse default blocked networks: %s", err))
+	}
+	stats, _ := statsd.NewNoopClient(nil)
+	return ValidationAuthorityImpl{log: logger, TestMode: tm, BlockedNetworks: blocked, Stats: stats}
 }
 
 // Used for audit logging
 type verificationRequestEvent struct {
-	ID           string         `json:",omitempty"`
-	Requester    int64          `json:",omitempty"`
-	Challenge    core.Challenge `json:",omitempty"`
-	RequestTime  time.Time      `json:",omitempty"`
-	ResponseTime time.Time      `json:",omitempty"`
-	Error        string         `json:",omitempty"`
+	ID               string                  `json:",omitempty"`
+	Requester        int64                   `json:",omitempty"`
+	Challenge        core.Challenge          `json:",omitempty"`
+	RequestTime      time.Time               `json:",omitempty"`
+	ResponseTime     time.Time               `json:",omitempty"`
+	Error            string                  `json:",omitempty"`
+	ValidationRecord []core.ValidationRecord `json:",omitempty"`
+}
+
+// A temporaryError is a problem reaching the subscriber's server that might
+// not happen if the validation were tried again: a timeout, a DNS server
+// failure or a reset connection.  validate retries validations that fail
+// with one, and records the error it wraps.
+type temporaryError struct {
+	error
+}
+
+// networkError classifies an error from reaching the subscriber's server as
+// a DNS, unknown host or connection problem, wrapped in a temporaryError if
+// it's worth trying again.  The second return value is false for errors that
+// happened after a connection was made.
+func networkError(err error) (error, bool) {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	if connErr, ok := err.(core.ConnectionError); ok {
+		// From our dialer refusing a blocked address
+		return connErr, true
+	}
+	if opErr, ok := err.(*net.OpError); ok {
+		dnsErr, ok := opErr.Err.(*net.DNSError)
+		if !ok {
+			connErr := core.ConnectionError(opErr.Error())
+			if opErr.Timeout() || connectionReset(opErr) {
+				return temporaryError{connErr}, true
+			}
+			return connErr, true
+		}
+		err = dnsErr
+	}
+	if dnsErr, ok := err.(*net.DNSError); ok {
+		if dnsErr.Err == "no such host" {
+			return core.UnknownHostError(dnsErr.Error()), true
+		}
+		if dnsErr.IsTimeout || dnsErr.IsTemporary {
+			return temporaryError{core.DNSError(dnsErr.Error())}, true
+		}
+		return core.DNSError(dnsErr.Error()), true
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		// Such as the HTTP client giving up
+		return temporaryError{core.ConnectionError(err.Error())}, true
+	}
+	return err, false
+}
+
+// connectionReset reports whether opErr is the subscriber's server resetting
+// the connection.
+func connectionReset(opErr *net.OpError) bool {
+	if sysErr, ok := opErr.Err.(*os.SyscallError); ok {
+		return sysErr.Err == syscall.ECONNRESET
+	}
+	return opErr.Err == syscall.ECONNRESET
+}
+
+// blocked reports whether ip is in one of the networks we won't connect to.
+func (va ValidationAuthorityImpl) blocked(ip net.IP) bool {
+	if va.TestMode && ip.IsLoopback() {
+		return false
+	}
+	for _, network := range va.BlockedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// newHTTPValidationRecord starts the record of fetching u; the dialer fills
+// in the addresses.
+func newHTTPValidationRecord(u *url.URL) core.ValidationRecord {
+	host, port, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		host = u.Host
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return core.ValidationRecord{URL: u.String(), Hostname: host, Port: port}
+}
+
+// trimValidationRecord returns as much of records as is kept with a
+// challenge, leaving records itself alone.
+func trimValidationRecord(records []core.ValidationRecord) []core.ValidationRecord {
+	if len(records) > maxValidationRecords {
+		// Keep where validation started, and where it ended up
+		records = append(records[:1:1], records[len(records)-maxValidationRecords+1:]...)
+	} else {
+		records = append([]core.ValidationRecord(nil), records...)
+	}
+	for i := range records {
+		if len(records[i].AddressesResolved) > maxValidationAddresses {
+			records[i].AddressesResolved = records[i].AddressesResolved[:maxValidationAddresses]
+		}
+		if len(records[i].URL) > maxValidationURLLength {
+			records[i].URL = records[i].URL[:maxValidationURLLength]
+		}
+	}
+	return records
+}
+
+// dialer returns a function that connects to addr like net.Dial, but looks
+// up its host through the configured resolver rather than the system one and
+// refuses blocked addresses.  In TestMode hosts in TestHostOverrides go to
+// the address there instead.  What it resolves and connects to
+// goes in the last of challenge's validation records if that's still waiting
+// for a connection, or a new one otherwise.
+func (va ValidationAuthorityImpl) dialer(challenge *core.Challenge) func(network, addr string) (net.Conn, error) {
+	return func(network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		records := challenge.ValidationRecord
+		if len(records) == 0 || records[len(records)-1].AddressesResolved != nil {
+			records = append(records, core.ValidationRecord{Hostname: host, Port: port})
+			challenge.ValidationRecord = records
+		}
+		record := &records[len(records)-1]
+
+		override, overridePort, err := va.testHostOverride(host, port)
+		if err != nil {
+			return nil, err
+		}
+		if override != nil {
+			record.AddressesResolved = []net.IP{override}
+			record.AddressUsed = override
+			record.Port = overridePort
+			return net.DialTimeout(network, net.JoinHostPort(override.String(), overridePort), va.timeout(challenge.Type))
+		}
+
+		addrs, _, err := va.DNSResolver.LookupHost(host)
+		if err != nil {
+			return nil, err
+		}
+		if len(addrs) == 0 {
+			return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		}
+		record.AddressesResolved = addrs
+
+		for _, candidate := range addrs {
+			if !va.blocked(candidate) {
+				record.AddressUsed = candidate
+				break
+			}
+		}
+		if record.AddressUsed == nil {
+			va.log.Notice(fmt.Sprintf("Refusing to connect to %s, all of its addresses are blocked: %v", host, addrs))
+			return nil, core.ConnectionError(fmt.Sprintf("%s only resolves to reserved addresses", host))
+		}
+
+		return net.DialTimeout(network, net.JoinHostPort(record.AddressUsed.String(), port), va.timeout(challenge.Type))
+	}
 }
 
 // Validation methods
@@ -48,33 +300,30 @@ func (va ValidationAuthorityImpl) validateSimpleHTTPS(identifier core.AcmeIdenti
 
 	if len(challenge.Path) == 0 {
 		challenge.Status = core.StatusInvalid
-		err := fmt.Errorf("No path provided for SimpleHTTPS challenge.")
+		err := core.MalformedRequestError("No path provided for SimpleHTTPS challenge.")
 		return challenge, err
 	}
 
 	if identifier.Type != core.IdentifierDNS {
 		challenge.Status = core.StatusInvalid
-		err := fmt.Errorf("Identifier type for SimpleHTTPS was not DNS")
+		err := core.MalformedRequestError("Identifier type for SimpleHTTPS was not DNS")
 		return challenge, err
 	}
-	hostName := identifier.Value
-	protocol := "https"
-	if va.TestMode {
-		hostName = "localhost:5001"
-		protocol = "http"
-	}
+	target := va.target(core.ChallengeTypeSimpleHTTPS)
+	hostName := target.urlHost(identifier.Value)
 
-	url := fmt.Sprintf("%s://%s/.well-known/acme-challenge/%s", protocol, hostName, challenge.Path)
+	url := fmt.Sprintf("%s://%s/.well-known/acme-challenge/%s", target.Scheme, hostName, challenge.Path)
 
 	// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
 	va.log.Audit(fmt.Sprintf("Attempting to validate SimpleHTTPS for %s", url))
 	httpRequest, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		challenge.Status = core.StatusInvalid
-		return challenge, err
+		return challenge, core.MalformedRequestError(err.Error())
 	}
 
 	httpRequest.Host = hostName
+	challenge.ValidationRecord = append(challenge.ValidationRecord, newHTTPValidationRecord(httpRequest.URL))
 	tr := &http.Transport{
 		// We are talking to a client that does not yet have a certificate,
 		// so we accept a temporary, invalid one.
@@ -83,10 +332,11 @@ func (va ValidationAuthorityImpl) validateSimpleHTTPS(identifier core.AcmeIdenti
 		// We don't expect to make multiple requests to a client, so close
 		// connection immediately.
 		DisableKeepAlives: true,
+		Dial:              va.dialer(&challenge),
 	}
 	client := http.Client{
 		Transport: tr,
-		Timeout:   5 * time.Second,
+		Timeout:   va.timeout(challenge.Type),
 	}
 	httpResponse, err := client.Do(httpRequest)
 
@@ -95,31 +345,143 @@ func (va ValidationAuthorityImpl) validateSimpleHTTPS(identifier core.AcmeIdenti
 		body, readErr := ioutil.ReadAll(httpResponse.Body)
 		if readErr != nil {
 			challenge.Status = core.StatusInvalid
-			return challenge, readErr
+			return challenge, core.ConnectionError(readErr.Error())
 		}
 
 		if subtle.ConstantTimeCompare(body, []byte(challenge.Token)) == 1 {
 			challenge.Status = core.StatusValid
 		} else {
-			err = fmt.Errorf("Incorrect token validating SimpleHTTPS for %s", url)
+			err = core.UnauthorizedError(fmt.Sprintf("Incorrect token validating SimpleHTTPS for %s", url))
 			challenge.Status = core.StatusInvalid
 		}
 	} else if err != nil {
 		va.log.Debug(fmt.Sprintf("Could not connect to %s: %s", url, err.Error()))
 		challenge.Status = core.StatusInvalid
+		if netErr, ok := networkError(err); ok {
+			err = netErr
+		} else {
+			err = core.ConnectionError(err.Error())
+		}
 	} else {
-		err = fmt.Errorf("Invalid response from %s: %d", url, httpResponse.StatusCode)
+		err = core.UnauthorizedError(fmt.Sprintf("Invalid response from %s: %d", url, httpResponse.StatusCode))
 		challenge.Status = core.StatusInvalid
 	}
 
 	return challenge, err
 }
 
+// checkHTTP01Redirect is an http.Client CheckRedirect function that only
+// follows a bounded number of redirects, to HTTP or HTTPS on their standard
+// ports or to where http-01 challenges are fetched from.
+func (va ValidationAuthorityImpl) checkHTTP01Redirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return core.UnauthorizedError(fmt.Sprintf("Too many redirects validating HTTP01 for %s", via[0].URL))
+	}
+
+	target := va.target(core.ChallengeTypeHTTP01)
+	port := ""
+	if _, p, err := net.SplitHostPort(req.URL.Host); err == nil {
+		port = p
+	}
+	switch {
+	case req.URL.Scheme == "http" && (port == "" || port == "80"):
+	case req.URL.Scheme == "https" && (port == "" || port == "443"):
+	case req.URL.Scheme == target.Scheme && port == strconv.Itoa(target.Port):
+	default:
+		return core.UnauthorizedError(fmt.Sprintf("Invalid redirect to %s validating HTTP01", req.URL))
+	}
+	return nil
+}
+
+func (va ValidationAuthorityImpl) validateHTTP01(identifier core.AcmeIdentifier, input core.Challenge) (core.Challenge, error) {
+	challenge := input
+
+	if identifier.Type != core.IdentifierDNS {
+		challenge.Status = core.StatusInvalid
+		err := core.MalformedRequestError("Identifier type for HTTP01 was not DNS")
+		return challenge, err
+	}
+	target := va.target(core.ChallengeTypeHTTP01)
+
+	challengeURL := fmt.Sprintf("%s://%s/.well-known/acme-challenge/%s", target.Scheme, target.urlHost(identifier.Value), challenge.Token)
+
+	// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+	va.log.Audit(fmt.Sprintf("Attempting to validate HTTP01 for %s", challengeURL))
+	httpRequest, err := http.NewRequest("GET", challengeURL, nil)
+	if err != nil {
+		challenge.Status = core.StatusInvalid
+		return challenge, core.MalformedRequestError(err.Error())
+	}
+	challenge.ValidationRecord = append(challenge.ValidationRecord, newHTTPValidationRecord(httpRequest.URL))
+
+	tr := &http.Transport{
+		// Redirects may lead to HTTPS, where the subscriber won't have a
+		// certificate for the name yet.
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		// We don't expect to make multiple requests to a client, so close
+		// connection immediately.
+		DisableKeepAlives: true,
+		Dial:              va.dialer(&challenge),
+	}
+	client := http.Client{
+		Transport: tr,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if err := va.checkHTTP01Redirect(req, via); err != nil {
+				return err
+			}
+			challenge.ValidationRecord = append(challenge.ValidationRecord, newHTTPValidationRecord(req.URL))
+			return nil
+		},
+		Timeout: va.timeout(challenge.Type),
+	}
+	httpResponse, err := client.Do(httpRequest)
+	if err != nil {
+		va.log.Debug(fmt.Sprintf("Could not fetch %s: %s", challengeURL, err.Error()))
+		challenge.Status = core.StatusInvalid
+		if urlErr, ok := err.(*url.Error); ok {
+			if redirectErr, ok := urlErr.Err.(core.UnauthorizedError); ok {
+				return challenge, redirectErr
+			}
+		}
+		if netErr, ok := networkError(err); ok {
+			return challenge, netErr
+		}
+		return challenge, core.ConnectionError(err.Error())
+	}
+	defer httpResponse.Body.Close()
+
+	if httpResponse.StatusCode != 200 {
+		challenge.Status = core.StatusInvalid
+		return challenge, core.UnauthorizedError(fmt.Sprintf("Invalid response from %s: %d", challengeURL, httpResponse.StatusCode))
+	}
+
+	// Read one byte more than we allow to tell if the response was too long
+	body, err := ioutil.ReadAll(io.LimitReader(httpResponse.Body, maxResponseSize+1))
+	if err != nil {
+		challenge.Status = core.StatusInvalid
+		return challenge, core.ConnectionError(err.Error())
+	}
+	if len(body) > maxResponseSize {
+		challenge.Status = core.StatusInvalid
+		return challenge, core.UnauthorizedError(fmt.Sprintf("Response from %s was longer than %d bytes", challengeURL, maxResponseSize))
+	}
+
+	// Allow for a trailing newline from the subscriber's server
+	payload := strings.TrimSpace(string(body))
+	if subtle.ConstantTimeCompare([]byte(payload), []byte(challenge.KeyAuthorization)) != 1 {
+		challenge.Status = core.StatusInvalid
+		return challenge, core.UnauthorizedError(fmt.Sprintf("Incorrect key authorization validating HTTP01 for %s", challengeURL))
+	}
+
+	challenge.Status = core.StatusValid
+	return challenge, nil
+}
+
 func (va ValidationAuthorityImpl) validateDvsni(identifier core.AcmeIdentifier, input core.Challenge) (core.Challenge, error) {
 	challenge := input
 
 	if identifier.Type != "dns" {
-		err := fmt.Errorf("Identifier type for DVSNI was not DNS")
+		err := core.MalformedRequestError("Identifier type for DVSNI was not DNS")
 		challenge.Status = core.StatusInvalid
 		return challenge, err
 	}
@@ -131,13 +493,13 @@ func (va ValidationAuthorityImpl) validateDvsni(identifier core.AcmeIdentifier,
 	if err != nil {
 		va.log.Debug("Failed to decode R value from DVSNI challenge")
 		challenge.Status = core.StatusInvalid
-		return challenge, err
+		return challenge, core.MalformedRequestError(err.Error())
 	}
 	S, err := core.B64dec(challenge.S)
 	if err != nil {
 		va.log.Debug("Failed to decode S value from DVSNI challenge")
 		challenge.Status = core.StatusInvalid
-		return challenge, err
+		return challenge, core.MalformedRequestError(err.Error())
 	}
 	RS := append(R, S...)
 
@@ -146,28 +508,37 @@ func (va ValidationAuthorityImpl) validateDvsni(identifier core.AcmeIdentifier,
 
 	// Make a connection with SNI = nonceName
 
-	hostPort := identifier.Value + ":443"
-	if va.TestMode {
-		hostPort = "localhost:5001"
-	}
+	hostPort := va.target(core.ChallengeTypeDVSNI).hostPort(identifier.Value)
 	va.log.Notice(fmt.Sprintf("Attempting to validate DVSNI for %s %s %s",
 		identifier, hostPort, zName))
-	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}, "tcp", hostPort, &tls.Config{
-		ServerName:         nonceName,
-		InsecureSkipVerify: true,
-	})
-
+	var conn *tls.Conn
+	rawConn, err := va.dialer(&challenge)("tcp", hostPort)
+	if err == nil {
+		// Bound the handshake as well as the connection
+		rawConn.SetDeadline(time.Now().Add(va.timeout(challenge.Type)))
+		conn = tls.Client(rawConn, &tls.Config{
+			ServerName:         nonceName,
+			InsecureSkipVerify: true,
+		})
+		if err = conn.Handshake(); err != nil {
+			rawConn.Close()
+		}
+	}
 	if err != nil {
 		va.log.Debug("Failed to connect to host for DVSNI challenge")
 		challenge.Status = core.StatusInvalid
-		return challenge, err
+		// Anything that isn't a failure to connect went wrong in the handshake
+		if netErr, ok := networkError(err); ok {
+			return challenge, netErr
+		}
+		return challenge, core.TLSError(err.Error())
 	}
 	defer conn.Close()
 
 	// Check that zName is a dNSName SAN in the server's certificate
 	certs := conn.ConnectionState().PeerCertificates
 	if len(certs) == 0 {
-		err = fmt.Errorf("No certs presented for DVSNI challenge")
+		err = core.TLSError("No certs presented for DVSNI challenge")
 		challenge.Status = core.StatusInvalid
 		return challenge, err
 	}
@@ -178,13 +549,148 @@ func (va ValidationAuthorityImpl) validateDvsni(identifier core.AcmeIdentifier,
 		}
 	}
 
-	err = fmt.Errorf("Correct zName not found for DVSNI challenge")
+	err = core.UnauthorizedError("Correct zName not found for DVSNI challenge")
+	challenge.Status = core.StatusInvalid
+	return challenge, err
+}
+
+func (va ValidationAuthorityImpl) validateTLSALPN01(identifier core.AcmeIdentifier, input core.Challenge) (core.Challenge, error) {
+	challenge := input
+
+	if identifier.Type != core.IdentifierDNS {
+		err := core.MalformedRequestError("Identifier type for TLS-ALPN-01 was not DNS")
+		challenge.Status = core.StatusInvalid
+		return challenge, err
+	}
+
+	hostPort := va.target(core.ChallengeTypeTLSALPN01).hostPort(identifier.Value)
+
+	// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+	va.log.Audit(fmt.Sprintf("Attempting to validate TLS-ALPN-01 for %s %s", identifier, hostPort))
+	var conn *tls.Conn
+	rawConn, err := va.dialer(&challenge)("tcp", hostPort)
+	if err == nil {
+		// Bound the handshake as well as the connection
+		rawConn.SetDeadline(time.Now().Add(va.timeout(challenge.Type)))
+		conn = tls.Client(rawConn, &tls.Config{
+			ServerName: identifier.Value,
+			NextProtos: []string{acmeTLSALPNProtocol},
+			// The certificate is self-signed, we only care what's in it
+			InsecureSkipVerify: true,
+		})
+		if err = conn.Handshake(); err != nil {
+			rawConn.Close()
+		}
+	}
+	if err != nil {
+		va.log.Debug("Failed to connect to host for TLS-ALPN-01 challenge")
+		challenge.Status = core.StatusInvalid
+		if netErr, ok := networkError(err); ok {
+			return challenge, netErr
+		}
+		return challenge, core.TLSError(err.Error())
+	}
+	defer conn.Close()
+
+	state := conn.ConnectionState()
+	if state.NegotiatedProtocol != acmeTLSALPNProtocol {
+		challenge.Status = core.StatusInvalid
+		return challenge, core.UnauthorizedError(fmt.Sprintf("Server didn't negotiate %s for TLS-ALPN-01 challenge", acmeTLSALPNProtocol))
+	}
+	if len(state.PeerCertificates) == 0 {
+		challenge.Status = core.StatusInvalid
+		return challenge, core.TLSError("No certs presented for TLS-ALPN-01 challenge")
+	}
+	cert := state.PeerCertificates[0]
+
+	// The certificate must be for the identifier and nothing else
+	if len(cert.DNSNames) != 1 || !strings.EqualFold(cert.DNSNames[0], identifier.Value) {
+		challenge.Status = core.StatusInvalid
+		return challenge, core.UnauthorizedError(fmt.Sprintf("Certificate for TLS-ALPN-01 challenge wasn't only for %s", identifier.Value))
+	}
+
+	expected := sha256.Sum256([]byte(challenge.KeyAuthorization))
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(idPeAcmeIdentifier) {
+			continue
+		}
+		if !ext.Critical {
+			break
+		}
+		var digest []byte
+		if rest, err := asn1.Unmarshal(ext.Value, &digest); err != nil || len(rest) > 0 {
+			break
+		}
+		if subtle.ConstantTimeCompare(digest, expected[:]) == 1 {
+			challenge.Status = core.StatusValid
+			return challenge, nil
+		}
+		break
+	}
+
+	err = core.UnauthorizedError("Correct acmeIdentifier extension not found for TLS-ALPN-01 challenge")
+	challenge.Status = core.StatusInvalid
+	return challenge, err
+}
+
+func (va ValidationAuthorityImpl) validateDNS(identifier core.AcmeIdentifier, input core.Challenge) (core.Challenge, error) {
+	challenge := input
+
+	if identifier.Type != core.IdentifierDNS {
+		err := core.MalformedRequestError("Identifier type for DNS challenge was not DNS")
+		challenge.Status = core.StatusInvalid
+		return challenge, err
+	}
+
+	challengeName := dnsChallengePrefix + identifier.Value
+
+	// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
+	va.log.Audit(fmt.Sprintf("Attempting to validate DNS for %s", challengeName))
+	challenge.ValidationRecord = append(challenge.ValidationRecord, core.ValidationRecord{Hostname: challengeName})
+	txts, _, err := va.DNSResolver.LookupTXT(challengeName)
+	if err != nil {
+		va.log.Debug(fmt.Sprintf("Failed to look up TXT records for %s: %s", challengeName, err))
+		challenge.Status = core.StatusInvalid
+		if netErr, ok := networkError(err); ok {
+			return challenge, netErr
+		}
+		return challenge, core.DNSError(err.Error())
+	}
+
+	// The record holds the digest of the key authorization rather than the
+	// key authorization itself, so that it fits in a TXT record
+	expected := core.Fingerprint256([]byte(challenge.KeyAuthorization))
+	for _, txt := range txts {
+		if subtle.ConstantTimeCompare([]byte(txt), []byte(expected)) == 1 {
+			challenge.Status = core.StatusValid
+			return challenge, nil
+		}
+	}
+
+	err = core.UnauthorizedError(fmt.Sprintf("Correct value not found for DNS challenge at %s", challengeName))
 	challenge.Status = core.StatusInvalid
 	return challenge, err
 }
 
 // Overall validation process
 
+// validateChallenge carries out one attempt at validating challenge.
+func (va ValidationAuthorityImpl) validateChallenge(identifier core.AcmeIdentifier, challenge core.Challenge) (core.Challenge, error) {
+	switch challenge.Type {
+	case core.ChallengeTypeSimpleHTTPS:
+		return va.validateSimpleHTTPS(identifier, challenge)
+	case core.ChallengeTypeDVSNI:
+		return va.validateDvsni(identifier, challenge)
+	case core.ChallengeTypeDNS:
+		return va.validateDNS(identifier, challenge)
+	case core.ChallengeTypeHTTP01:
+		return va.validateHTTP01(identifier, challenge)
+	case core.ChallengeTypeTLSALPN01:
+		return va.validateTLSALPN01(identifier, challenge)
+	}
+	return challenge, nil
+}
+
 func (va ValidationAuthorityImpl) validate(authz core.Authorization, challengeIndex int) {
 
 	// Select the first supported validation method
@@ -197,23 +703,35 @@ func (va ValidationAuthorityImpl) validate(authz core.Authorization, challengeIn
 	if !authz.Challenges[challengeIndex].IsSane(true) {
 		authz.Challenges[challengeIndex].Status = core.StatusInvalid
 		logEvent.Error = fmt.Sprintf("Challenge failed sanity check.")
+		authz.Challenges[challengeIndex].Error = core.ProblemDetailsForError(core.MalformedRequestError(logEvent.Error))
 		logEvent.Challenge = authz.Challenges[challengeIndex]
 	} else {
 		var err error
 
-		switch authz.Challenges[challengeIndex].Type {
-		case core.ChallengeTypeSimpleHTTPS:
-			authz.Challenges[challengeIndex], err = va.validateSimpleHTTPS(authz.Identifier, authz.Challenges[challengeIndex])
-			break
-		case core.ChallengeTypeDVSNI:
-			authz.Challenges[challengeIndex], err = va.validateDvsni(authz.Identifier, authz.Challenges[challengeIndex])
-			break
+		// Only record what this attempt does
+		challenge := authz.Challenges[challengeIndex]
+		challenge.ValidationRecord = nil
+
+		started := time.Now()
+		for attempt := 0; ; attempt++ {
+			authz.Challenges[challengeIndex], err = va.validateChallenge(authz.Identifier, challenge)
+			var retry bool
+			if err, retry = transient(err); !retry || attempt >= va.Validation.MaxRetries {
+				break
+			}
+			va.log.Debug(fmt.Sprintf("Retrying validation of %s after %s", authz.ID, err))
+			va.Stats.Inc(fmt.Sprintf("VA.Validations.Retries.%s", challenge.Type), 1, 1.0)
+			time.Sleep(va.Validation.RetryBackoff.Duration << uint(attempt))
 		}
+		va.Stats.TimingDuration(fmt.Sprintf("VA.Validations.Latency.%s", challenge.Type), time.Since(started), 1.0)
 
-		logEvent.Challenge = authz.Challenges[challengeIndex]
 		if err != nil {
 			logEvent.Error = err.Error()
+			authz.Challenges[challengeIndex].Error = core.ProblemDetailsForError(err)
 		}
+		logEvent.Challenge = authz.Challenges[challengeIndex]
+		logEvent.ValidationRecord = authz.Challenges[challengeIndex].ValidationRecord
+		authz.Challenges[challengeIndex].ValidationRecord = trimValidationRecord(logEvent.ValidationRecord)
 	}
 
 	// AUDIT[ Certificate Requests ] 11917fa4-10ef-4e0d-9105-bacbe7836a3c
@@ -223,8 +741,3 @@ func (va ValidationAuthorityImpl) validate(authz core.Authorization, challengeIn
 
 	va.RA.OnValidationUpdate(authz)
 }
-
-func (va ValidationAuthorityImpl) UpdateValidations(authz core.Authorization, challengeIndex int) error {
-	go va.validate(authz, challengeIndex)
-	return nil
-}
@@ -12,7 +12,9 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"math/big"
 	"net"
@@ -21,7 +23,9 @@ import (
 	"testing"
 	"time"
 
+	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/square/go-jose"
 	"github.com/letsencrypt/boulder/core"
+	"github.com/letsencrypt/boulder/mocks"
 	"github.com/letsencrypt/boulder/test"
 )
 
@@ -93,6 +97,62 @@ func simpleSrv(t *testing.T, token string, stopChan, waitChan chan bool) {
 	httpsServer.Serve(conn)
 }
 
+const pathRedirectOK = "redirect-ok"
+const pathRedirectPort = "redirect-port"
+const pathRedirectLoop = "redirect-loop"
+const pathTooLarge = "too-large"
+const pathSlow = "slow"
+
+// http01Srv signals waitChan once it's listening and again once it has
+// stopped.
+func http01Srv(t *testing.T, keyAuthz string, stopChan, waitChan chan bool) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, path404) {
+			t.Logf("HTTP01SRV: Got a 404 req\n")
+			http.NotFound(w, r)
+		} else if strings.HasSuffix(r.URL.Path, pathWrongToken) {
+			t.Logf("HTTP01SRV: Got a wrongtoken req\n")
+			fmt.Fprintf(w, "wrongtoken")
+		} else if strings.HasSuffix(r.URL.Path, pathRedirectOK) {
+			t.Logf("HTTP01SRV: Got a redirect req\n")
+			http.Redirect(w, r, "/.well-known/acme-challenge/valid", 301)
+		} else if strings.HasSuffix(r.URL.Path, pathRedirectPort) {
+			t.Logf("HTTP01SRV: Got a redirect to another port\n")
+			http.Redirect(w, r, "http://localhost:8080/.well-known/acme-challenge/valid", 301)
+		} else if strings.HasSuffix(r.URL.Path, pathRedirectLoop) {
+			t.Logf("HTTP01SRV: Got a redirect loop req\n")
+			http.Redirect(w, r, r.URL.Path, 301)
+		} else if strings.HasSuffix(r.URL.Path, pathSlow) {
+			t.Logf("HTTP01SRV: Got a slow req\n")
+			time.Sleep(6 * time.Second)
+			fmt.Fprintf(w, "%s\n", keyAuthz)
+		} else if strings.HasSuffix(r.URL.Path, pathTooLarge) {
+			t.Logf("HTTP01SRV: Got a too large req\n")
+			fmt.Fprintf(w, "%s%s", keyAuthz, strings.Repeat(".", maxResponseSize))
+		} else {
+			t.Logf("HTTP01SRV: Got a valid req\n")
+			fmt.Fprintf(w, "%s\n", keyAuthz)
+		}
+	})
+
+	httpServer := &http.Server{Addr: testModeTargets[core.ChallengeTypeHTTP01].hostPort("localhost"), Handler: mux}
+	conn, err := net.Listen("tcp", httpServer.Addr)
+	if err != nil {
+		waitChan <- true
+		t.Fatalf("Couldn't listen on %s: %s", httpServer.Addr, err)
+	}
+
+	go func() {
+		<-stopChan
+		conn.Close()
+	}()
+
+	waitChan <- true
+	httpServer.Serve(conn)
+	waitChan <- true
+}
+
 func dvsniSrv(t *testing.T, R, S []byte, stopChan, waitChan chan bool) {
 	RS := append(R, S...)
 	z := sha256.Sum256(RS)
@@ -148,14 +208,177 @@ func dvsniSrv(t *testing.T, R, S []byte, stopChan, waitChan chan bool) {
 	httpsServer.Serve(tlsListener)
 }
 
+// tlsalpnCert makes a self-signed certificate for names carrying an
+// acmeIdentifier extension for keyAuthz.
+func tlsalpnCert(key *rsa.PrivateKey, names []string, keyAuthz string, critical bool) *tls.Certificate {
+	digest := sha256.Sum256([]byte(keyAuthz))
+	extValue, _ := asn1.Marshal(digest[:])
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1337),
+		Subject: pkix.Name{
+			Organization: []string{"tests"},
+		},
+		NotBefore: time.Now(),
+		NotAfter:  time.Now().AddDate(0, 0, 1),
+
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+
+		DNSNames: names,
+		ExtraExtensions: []pkix.Extension{
+			{Id: idPeAcmeIdentifier, Critical: critical, Value: extValue},
+		},
+	}
+
+	certBytes, _ := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	return &tls.Certificate{
+		Certificate: [][]byte{certBytes},
+		PrivateKey:  key,
+	}
+}
+
+// tlsalpnSrv stands in for a subscriber's server answering tls-alpn-01
+// challenges for keyAuthz.  Which certificate it presents depends on the SNI:
+//
+// * wrongdigest.test: one for another key authorization
+// * noncritical.test: one whose acmeIdentifier extension isn't critical
+// * extraname.test: one for another name as well
+// * anything else: the right one
+//
+// It signals waitChan once it's listening and again once it has stopped.
+func tlsalpnSrv(t *testing.T, keyAuthz string, protos []string, stopChan, waitChan chan bool) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		waitChan <- true
+		t.Fatalf("Couldn't generate key: %s", err)
+	}
+
+	tlsConfig := &tls.Config{
+		ClientAuth: tls.NoClientCert,
+		GetCertificate: func(clientHello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			name := clientHello.ServerName
+			switch name {
+			case "wrongdigest.test":
+				return tlsalpnCert(key, []string{name}, "wrong", true), nil
+			case "noncritical.test":
+				return tlsalpnCert(key, []string{name}, keyAuthz, false), nil
+			case "extraname.test":
+				return tlsalpnCert(key, []string{name, "other.test"}, keyAuthz, true), nil
+			}
+			return tlsalpnCert(key, []string{name}, keyAuthz, true), nil
+		},
+		NextProtos: protos,
+	}
+
+	httpsServer := &http.Server{Addr: "localhost:5001"}
+	conn, err := net.Listen("tcp", httpsServer.Addr)
+	if err != nil {
+		waitChan <- true
+		t.Fatalf("Couldn't listen on %s: %s", httpsServer.Addr, err)
+	}
+	tlsListener := tls.NewListener(conn, tlsConfig)
+
+	go func() {
+		<-stopChan
+		conn.Close()
+	}()
+
+	waitChan <- true
+	httpsServer.Serve(tlsListener)
+	waitChan <- true
+}
+
+func TestDNSValidation(t *testing.T) {
+	va := NewValidationAuthorityImpl(true)
+	va.DNSResolver = &mocks.MockDNS{}
+	chall := core.DNSChallenge()
+	chall.Token = mocks.DNSChallengeToken
+	chall.KeyAuthorization = mocks.DNSChallengeKeyAuthorization
+
+	finChall, err := va.validateDNS(core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "good.test"}, chall)
+	test.AssertNotError(t, err, "Failed to validate DNS challenge")
+	test.AssertEquals(t, finChall.Status, core.StatusValid)
+	test.AssertEquals(t, len(finChall.ValidationRecord), 1)
+	test.AssertEquals(t, finChall.ValidationRecord[0].Hostname, "_acme-challenge.good.test")
+
+	// Publishing the token itself, rather than the digest of the key
+	// authorization, doesn't prove anything about the account key
+	bareToken := chall
+	bareToken.KeyAuthorization = mocks.DNSChallengeToken
+	invalidChall, err := va.validateDNS(core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "good.test"}, bareToken)
+	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
+	_, ok := err.(core.UnauthorizedError)
+	test.Assert(t, ok, "Wrong error type for a TXT record that doesn't match")
+
+	invalidChall, err = va.validateDNS(core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "wrong.test"}, chall)
+	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
+	_, ok = err.(core.UnauthorizedError)
+	test.Assert(t, ok, "Wrong error type for incorrect TXT record")
+
+	invalidChall, err = va.validateDNS(core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "missing.test"}, chall)
+	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
+	_, ok = err.(core.UnknownHostError)
+	test.Assert(t, ok, "Wrong error type for missing TXT record")
+
+	invalidChall, err = va.validateDNS(core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "servfail.letsencrypt.org"}, chall)
+	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
+	err, ok = transient(err)
+	test.Assert(t, ok, "Server failure wasn't worth trying again")
+	_, ok = err.(core.DNSError)
+	test.Assert(t, ok, "Wrong error type for failed lookup")
+
+	invalidChall, err = va.validateDNS(core.AcmeIdentifier{Type: core.IdentifierType("ip"), Value: "127.0.0.1"}, chall)
+	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
+	_, ok = err.(core.MalformedRequestError)
+	test.Assert(t, ok, "Wrong error type for non-DNS identifier")
+}
+
+func TestCheckCAARecords(t *testing.T) {
+	va := NewValidationAuthorityImpl(true)
+	va.DNSResolver = &mocks.MockDNS{}
+	va.CAAIdentities = []string{"letsencrypt.org"}
+
+	checkCAA := func(name string, expectPresent, expectValid bool) {
+		present, valid, err := va.CheckCAARecords(core.AcmeIdentifier{Type: core.IdentifierDNS, Value: name})
+		test.AssertNotError(t, err, fmt.Sprintf("CAA check failed for %s", name))
+		test.AssertEquals(t, present, expectPresent)
+		test.AssertEquals(t, valid, expectValid)
+	}
+
+	// No records anywhere up the tree
+	checkCAA("letsencrypt.org", false, true)
+	// Another CA's identity, both on the name and on its parent
+	checkCAA("reserved.com", true, false)
+	checkCAA("www.reserved.com", true, false)
+	// Critical property we don't understand
+	checkCAA("critical.com", true, false)
+	// Our identity, with parameters and an iodef alongside
+	checkCAA("present.com", true, true)
+	checkCAA("www.present.com", true, true)
+	// Nobody may issue
+	checkCAA("forbidden.com", true, false)
+
+	_, _, err := va.CheckCAARecords(core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "servfail.letsencrypt.org"})
+	_, ok := err.(core.DNSError)
+	test.Assert(t, ok, "Wrong error type for failed CAA lookup")
+
+	va.CAAIdentities = []string{"symantec.com"}
+	checkCAA("reserved.com", true, true)
+	checkCAA("present.com", true, false)
+}
+
 func TestSimpleHttps(t *testing.T) {
 	va := NewValidationAuthorityImpl(true)
+	va.DNSResolver = &mocks.MockDNS{}
 
 	chall := core.Challenge{Path: "test", Token: expectedToken}
 
 	invalidChall, err := va.validateSimpleHTTPS(ident, chall)
 	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
 	test.AssertError(t, err, "Server's not up yet; expected refusal. Where did we connect?")
+	_, ok := err.(core.ConnectionError)
+	test.Assert(t, ok, "Refused connection should be a connection problem")
 
 	stopChan := make(chan bool, 1)
 	waitChan := make(chan bool, 1)
@@ -176,6 +399,8 @@ func TestSimpleHttps(t *testing.T) {
 	invalidChall, err = va.validateSimpleHTTPS(ident, chall)
 	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
 	test.AssertError(t, err, "The path should have given us the wrong token.")
+	_, ok = err.(core.UnauthorizedError)
+	test.Assert(t, ok, "Wrong token should be an unauthorized problem")
 
 	chall.Path = ""
 	invalidChall, err = va.validateSimpleHTTPS(ident, chall)
@@ -198,8 +423,210 @@ func TestSimpleHttps(t *testing.T) {
 	test.AssertError(t, err, "Connection should've timed out")
 }
 
+func TestHTTP01(t *testing.T) {
+	va := NewValidationAuthorityImpl(true)
+	va.DNSResolver = &mocks.MockDNS{}
+
+	keyAuthz := "THETOKEN.THETHUMBPRINT"
+	chall := core.Challenge{Token: "valid", KeyAuthorization: keyAuthz}
+
+	invalidChall, err := va.validateHTTP01(ident, chall)
+	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
+	test.AssertError(t, err, "Server's not up yet; expected refusal. Where did we connect?")
+	_, ok := err.(core.ConnectionError)
+	test.Assert(t, ok, "Refused connection should be a connection problem")
+
+	stopChan := make(chan bool, 1)
+	waitChan := make(chan bool, 1)
+	go http01Srv(t, keyAuthz, stopChan, waitChan)
+	defer func() {
+		stopChan <- true
+		<-waitChan
+	}()
+	<-waitChan
+
+	finChall, err := va.validateHTTP01(ident, chall)
+	test.AssertEquals(t, finChall.Status, core.StatusValid)
+	test.AssertNotError(t, err, chall.Token)
+	test.AssertEquals(t, len(finChall.ValidationRecord), 1)
+	record := finChall.ValidationRecord[0]
+	test.AssertEquals(t, record.URL, "http://localhost:5002/.well-known/acme-challenge/valid")
+	test.AssertEquals(t, record.Hostname, "localhost")
+	test.AssertEquals(t, record.Port, "5002")
+	test.AssertEquals(t, len(record.AddressesResolved), 1)
+	test.Assert(t, record.AddressUsed.Equal(net.ParseIP("127.0.0.1")), "Wrong address recorded")
+
+	chall.Token = pathRedirectOK
+	finChall, err = va.validateHTTP01(ident, chall)
+	test.AssertEquals(t, finChall.Status, core.StatusValid)
+	test.AssertNotError(t, err, chall.Token)
+	test.AssertEquals(t, len(finChall.ValidationRecord), 2)
+	test.AssertEquals(t, finChall.ValidationRecord[1].URL, "http://localhost:5002/.well-known/acme-challenge/valid")
+	test.Assert(t, finChall.ValidationRecord[1].AddressUsed != nil, "Redirect wasn't recorded")
+
+	chall.Token = path404
+	invalidChall, err = va.validateHTTP01(ident, chall)
+	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
+	test.AssertError(t, err, "Should have found a 404 for the challenge.")
+
+	chall.Token = pathWrongToken
+	invalidChall, err = va.validateHTTP01(ident, chall)
+	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
+	_, ok = err.(core.UnauthorizedError)
+	test.Assert(t, ok, "Wrong key authorization should be an unauthorized problem")
+
+	chall.Token = pathRedirectPort
+	invalidChall, err = va.validateHTTP01(ident, chall)
+	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
+	_, ok = err.(core.UnauthorizedError)
+	test.Assert(t, ok, "Redirect to a non-standard port should be an unauthorized problem")
+
+	chall.Token = pathRedirectLoop
+	invalidChall, err = va.validateHTTP01(ident, chall)
+	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
+	_, ok = err.(core.UnauthorizedError)
+	test.Assert(t, ok, "Too many redirects should be an unauthorized problem")
+
+	chall.Token = pathTooLarge
+	invalidChall, err = va.validateHTTP01(ident, chall)
+	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
+	_, ok = err.(core.UnauthorizedError)
+	test.Assert(t, ok, "Oversized response should be an unauthorized problem")
+
+	chall.Token = "valid"
+	invalidChall, err = va.validateHTTP01(core.AcmeIdentifier{Type: core.IdentifierType("ip"), Value: "127.0.0.1"}, chall)
+	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
+	_, ok = err.(core.MalformedRequestError)
+	test.Assert(t, ok, "IdentifierType IP shouldn't have worked.")
+}
+
+func TestBlockedNetworks(t *testing.T) {
+	va := NewValidationAuthorityImpl(false)
+	va.DNSResolver = &mocks.MockDNS{}
+
+	for _, addr := range []string{"10.1.2.3", "127.0.0.1", "169.254.169.254", "172.31.0.1", "192.168.1.1", "::1", "fe80::1", "fd00::1", "::ffff:10.0.0.1"} {
+		test.Assert(t, va.blocked(net.ParseIP(addr)), fmt.Sprintf("%s should be blocked", addr))
+	}
+	for _, addr := range []string{"8.8.8.8", "172.32.0.1", "2001:4860:4860::8888"} {
+		test.Assert(t, !va.blocked(net.ParseIP(addr)), fmt.Sprintf("%s shouldn't be blocked", addr))
+	}
+
+	// Everything resolves to 127.0.0.1, which we mustn't connect to outside
+	// of test mode
+	chall := core.Challenge{Token: "valid", KeyAuthorization: "THETOKEN.THETHUMBPRINT"}
+	invalidChall, err := va.validateHTTP01(ident, chall)
+	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
+	_, ok := err.(core.ConnectionError)
+	test.Assert(t, ok, "Blocked address should be a connection problem")
+	test.AssertEquals(t, len(invalidChall.ValidationRecord), 1)
+	test.AssertEquals(t, len(invalidChall.ValidationRecord[0].AddressesResolved), 1)
+	test.Assert(t, invalidChall.ValidationRecord[0].AddressUsed == nil, "Recorded a blocked address as used")
+
+	va.TestMode = true
+	test.Assert(t, !va.blocked(net.ParseIP("127.0.0.1")), "Loopback should be allowed in test mode")
+	test.Assert(t, va.blocked(net.ParseIP("10.1.2.3")), "Only loopback should be allowed in test mode")
+
+	networks, err := core.ParseNetworks([]string{"8.8.8.0/24"})
+	test.AssertNotError(t, err, "Couldn't parse networks")
+	va.BlockedNetworks = networks
+	test.Assert(t, va.blocked(net.ParseIP("8.8.8.8")), "Configured network should be blocked")
+	test.Assert(t, !va.blocked(net.ParseIP("10.1.2.3")), "Only configured networks should be blocked")
+}
+
+func TestValidationTargets(t *testing.T) {
+	va := NewValidationAuthorityImpl(false)
+	test.AssertEquals(t, va.target(core.ChallengeTypeHTTP01), ValidationTarget{Scheme: "http", Port: 80})
+	test.AssertEquals(t, va.target(core.ChallengeTypeDVSNI).hostPort("example.com"), "example.com:443")
+	test.AssertEquals(t, va.target(core.ChallengeTypeSimpleHTTPS).urlHost("example.com"), "example.com")
+
+	va.TestMode = true
+	test.AssertEquals(t, va.target(core.ChallengeTypeHTTP01), ValidationTarget{Scheme: "http", Port: 5002})
+	test.AssertEquals(t, va.target(core.ChallengeTypeTLSALPN01).hostPort("example.com"), "example.com:5001")
+	test.AssertEquals(t, va.target(core.ChallengeTypeSimpleHTTPS).urlHost("example.com"), "example.com:5001")
+
+	va.Validation.Targets = map[string]ValidationTarget{
+		core.ChallengeTypeSimpleHTTPS: {Scheme: "https"},
+		core.ChallengeTypeDVSNI:       {Port: 5010},
+	}
+	test.AssertEquals(t, va.target(core.ChallengeTypeSimpleHTTPS), ValidationTarget{Scheme: "https", Port: 5001})
+	test.AssertEquals(t, va.target(core.ChallengeTypeDVSNI).hostPort("example.com"), "example.com:5010")
+	test.AssertEquals(t, va.target(core.ChallengeTypeHTTP01).urlHost("example.com"), "example.com:5002")
+}
+
+// privateDNS is a MockDNS that resolves every name to a private address
+type privateDNS struct {
+	mocks.MockDNS
+}
+
+func (dns *privateDNS) LookupHost(hostname string) ([]net.IP, time.Duration, error) {
+	return []net.IP{net.ParseIP("10.1.2.3")}, 0, nil
+}
+
+func TestHostOverrides(t *testing.T) {
+	va := NewValidationAuthorityImpl(true)
+	va.DNSResolver = &mocks.MockDNS{}
+	// Nothing listens here, so only the override can get through
+	va.Validation.Targets = map[string]ValidationTarget{core.ChallengeTypeHTTP01: {Port: 5010}}
+	va.Validation.TestHostOverrides = map[string]string{
+		"other.test": "127.0.0.1:5002",
+		"bogus.test": "not an address",
+	}
+
+	keyAuthz := "THETOKEN.THETHUMBPRINT"
+	stopChan := make(chan bool, 1)
+	waitChan := make(chan bool, 1)
+	go http01Srv(t, keyAuthz, stopChan, waitChan)
+	defer func() {
+		stopChan <- true
+		<-waitChan
+	}()
+	<-waitChan
+
+	other := core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "other.test"}
+	chall := core.Challenge{Token: "valid", KeyAuthorization: keyAuthz}
+	finChall, err := va.validateHTTP01(other, chall)
+	test.AssertNotError(t, err, "Override wasn't used")
+	test.AssertEquals(t, finChall.Status, core.StatusValid)
+	test.AssertEquals(t, len(finChall.ValidationRecord), 1)
+	record := finChall.ValidationRecord[0]
+	test.AssertEquals(t, record.URL, "http://other.test:5010/.well-known/acme-challenge/valid")
+	test.AssertEquals(t, record.Hostname, "other.test")
+	test.AssertEquals(t, record.Port, "5002")
+	test.Assert(t, record.AddressUsed.Equal(net.ParseIP("127.0.0.1")), "Wrong address recorded")
+
+	invalidChall, err := va.validateHTTP01(ident, chall)
+	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
+	test.AssertError(t, err, "Names without overrides should use the configured port")
+
+	bogus := core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "bogus.test"}
+	invalidChall, err = va.validateHTTP01(bogus, chall)
+	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
+	test.AssertError(t, err, "Used an invalid override")
+
+	ip, port, err := va.testHostOverride("example.com", "5001")
+	test.AssertNotError(t, err, "No override for example.com")
+	test.Assert(t, ip == nil, "Names without overrides should be looked up")
+	test.AssertEquals(t, port, "5001")
+
+	// Which means they're checked against the blocked networks too
+	va.DNSResolver = &privateDNS{}
+	invalidChall, err = va.validateHTTP01(ident, chall)
+	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
+	_, ok := err.(core.ConnectionError)
+	test.Assert(t, ok, "Blocked address should be a connection problem")
+	test.Assert(t, invalidChall.ValidationRecord[0].AddressUsed == nil, "Connected to a blocked address in test mode")
+
+	// Overrides only apply in test mode
+	va.TestMode = false
+	ip, port, err = va.testHostOverride("other.test", "80")
+	test.AssertNotError(t, err, "Override applied outside test mode")
+	test.Assert(t, ip == nil, "Override applied outside test mode")
+	test.AssertEquals(t, port, "80")
+}
+
 func TestDvsni(t *testing.T) {
 	va := NewValidationAuthorityImpl(true)
+	va.DNSResolver = &mocks.MockDNS{}
 
 	a := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 0}
 	ba := core.B64enc(a)
@@ -246,8 +673,61 @@ func TestDvsni(t *testing.T) {
 	test.AssertError(t, err, "Connection should've timed out")
 }
 
+func TestTLSALPN01(t *testing.T) {
+	va := NewValidationAuthorityImpl(true)
+	va.DNSResolver = &mocks.MockDNS{}
+
+	keyAuthz := "THETOKEN.THETHUMBPRINT"
+	chall := core.Challenge{Token: "THETOKEN", KeyAuthorization: keyAuthz}
+
+	invalidChall, err := va.validateTLSALPN01(ident, chall)
+	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
+	test.AssertError(t, err, "Server's not up yet; expected refusal. Where did we connect?")
+	err, _ = transient(err)
+	_, ok := err.(core.ConnectionError)
+	test.Assert(t, ok, "Refused connection should be a connection problem")
+
+	waitChan := make(chan bool, 1)
+	stopChan := make(chan bool, 1)
+	go tlsalpnSrv(t, keyAuthz, []string{"http/1.1", acmeTLSALPNProtocol}, stopChan, waitChan)
+	<-waitChan
+
+	finChall, err := va.validateTLSALPN01(ident, chall)
+	test.AssertEquals(t, finChall.Status, core.StatusValid)
+	test.AssertNotError(t, err, "")
+	test.AssertEquals(t, len(finChall.ValidationRecord), 1)
+	test.AssertEquals(t, finChall.ValidationRecord[0].Hostname, "localhost")
+	test.AssertEquals(t, finChall.ValidationRecord[0].Port, "5001")
+	test.Assert(t, finChall.ValidationRecord[0].AddressUsed.Equal(net.ParseIP("127.0.0.1")), "Wrong address recorded")
+
+	for _, name := range []string{"wrongdigest.test", "noncritical.test", "extraname.test"} {
+		invalidChall, err = va.validateTLSALPN01(core.AcmeIdentifier{Type: core.IdentifierDNS, Value: name}, chall)
+		test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
+		_, ok = err.(core.UnauthorizedError)
+		test.Assert(t, ok, fmt.Sprintf("Wrong error type for %s", name))
+	}
+
+	invalidChall, err = va.validateTLSALPN01(core.AcmeIdentifier{Type: core.IdentifierType("ip"), Value: "127.0.0.1"}, chall)
+	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
+	_, ok = err.(core.MalformedRequestError)
+	test.Assert(t, ok, "IdentifierType IP shouldn't have worked.")
+
+	// A server that doesn't speak the ACME protocol over ALPN
+	stopChan <- true
+	<-waitChan
+	go tlsalpnSrv(t, keyAuthz, nil, stopChan, waitChan)
+	defer func() { stopChan <- true }()
+	<-waitChan
+
+	invalidChall, err = va.validateTLSALPN01(ident, chall)
+	test.AssertEquals(t, invalidChall.Status, core.StatusInvalid)
+	_, ok = err.(core.UnauthorizedError)
+	test.Assert(t, ok, "Missing ALPN protocol should be an unauthorized problem")
+}
+
 func TestValidateHTTPS(t *testing.T) {
 	va := NewValidationAuthorityImpl(true)
+	va.DNSResolver = &mocks.MockDNS{}
 	mockRA := &MockRegistrationAuthority{}
 	va.RA = mockRA
 
@@ -279,6 +759,7 @@ func TestValidateHTTPS(t *testing.T) {
 
 func TestValidateDvsni(t *testing.T) {
 	va := NewValidationAuthorityImpl(true)
+	va.DNSResolver = &mocks.MockDNS{}
 	mockRA := &MockRegistrationAuthority{}
 	va.RA = mockRA
 
@@ -312,6 +793,7 @@ func TestValidateDvsni(t *testing.T) {
 
 func TestValidateDvsniNotSane(t *testing.T) {
 	va := NewValidationAuthorityImpl(true)
+	va.DNSResolver = &mocks.MockDNS{}
 	mockRA := &MockRegistrationAuthority{}
 	va.RA = mockRA
 
@@ -345,6 +827,7 @@ func TestValidateDvsniNotSane(t *testing.T) {
 
 func TestUpdateValidations(t *testing.T) {
 	va := NewValidationAuthorityImpl(true)
+	va.DNSResolver = &mocks.MockDNS{}
 	mockRA := &MockRegistrationAuthority{}
 	va.RA = mockRA
 
@@ -378,8 +861,190 @@ func TestUpdateValidations(t *testing.T) {
 	test.Assert(t, (took < (time.Second * 3)), "UpdateValidations blocked")
 }
 
+// countingDNS is a MockDNS that counts host and TXT lookups
+type countingDNS struct {
+	mocks.MockDNS
+	hostLookups int
+	txtLookups  int
+}
+
+func (dns *countingDNS) LookupHost(hostname string) ([]net.IP, time.Duration, error) {
+	dns.hostLookups++
+	return dns.MockDNS.LookupHost(hostname)
+}
+
+func (dns *countingDNS) LookupTXT(hostname string) ([]string, time.Duration, error) {
+	dns.txtLookups++
+	return dns.MockDNS.LookupTXT(hostname)
+}
+
+func TestTrimValidationRecord(t *testing.T) {
+	// A long chain of redirects between long names with many addresses
+	longName := strings.Repeat(strings.Repeat("a", 62)+".", 4) + "com"
+	var addrs []net.IP
+	for i := 0; i < 20; i++ {
+		addrs = append(addrs, net.ParseIP(fmt.Sprintf("2001:db8:ffff:ffff:ffff:ffff:ffff:%x", i)))
+	}
+	var records []core.ValidationRecord
+	for i := 0; i <= maxRedirects; i++ {
+		records = append(records, core.ValidationRecord{
+			URL:               fmt.Sprintf("http://%s/%d/%s", longName, i, strings.Repeat("x", 2000)),
+			Hostname:          longName,
+			Port:              "80",
+			AddressesResolved: addrs,
+			AddressUsed:       addrs[len(addrs)-1],
+		})
+	}
+
+	trimmed := trimValidationRecord(records)
+	test.AssertEquals(t, len(trimmed), maxValidationRecords)
+	test.AssertEquals(t, trimmed[0].URL, records[0].URL[:maxValidationURLLength])
+	test.AssertEquals(t, trimmed[len(trimmed)-1].URL, records[len(records)-1].URL[:maxValidationURLLength])
+	test.AssertEquals(t, len(trimmed[0].AddressesResolved), maxValidationAddresses)
+	test.Assert(t, trimmed[0].AddressUsed.Equal(addrs[len(addrs)-1]), "Lost the address used")
+	test.AssertEquals(t, len(records), maxRedirects+1)
+	test.AssertEquals(t, len(records[0].AddressesResolved), len(addrs))
+
+	// What's kept still fits in the authorization's challenges column
+	challenges := []core.Challenge{
+		core.SimpleHTTPSChallenge(),
+		core.DvsniChallenge(),
+		core.DNSChallenge(),
+		core.HTTP01Challenge(),
+		core.TLSALPN01Challenge(),
+	}
+	for i := range challenges {
+		challenges[i].URI = core.AcmeURL{Scheme: "https", Host: "acme.example.com", Path: "/acme/challenge/" + core.NewToken() + "/" + fmt.Sprint(i)}
+	}
+	http01 := &challenges[3]
+	http01.KeyAuthorization = http01.Token + ".9jg46WB3rR_AHD-EBXdN7cBkH1WOu0tA3M9fm21mqTI"
+	http01.Status = core.StatusInvalid
+	http01.Error = core.ProblemDetailsForError(core.UnauthorizedError("Too many redirects validating HTTP01 for " + trimmed[0].URL))
+	http01.ValidationRecord = trimmed
+	stored, err := json.Marshal(challenges)
+	test.AssertNotError(t, err, "Couldn't marshal challenges")
+	test.Assert(t, len(stored) <= 4096, fmt.Sprintf("Challenges take %d bytes, more than the column holds", len(stored)))
+}
+
+func TestValidationRetries(t *testing.T) {
+	va := NewValidationAuthorityImpl(true)
+	dns := &countingDNS{}
+	va.DNSResolver = dns
+	mockRA := &MockRegistrationAuthority{}
+	va.RA = mockRA
+	va.Validation.MaxRetries = 2
+	va.Validation.RetryBackoff = core.ConfigDuration{Duration: time.Millisecond}
+
+	chall := core.DNSChallenge()
+	chall.KeyAuthorization = chall.Token + ".9jg46WB3rR_AHD-EBXdN7cBkH1WOu0tA3M9fm21mqTI"
+
+	// A server failure might go away, so is retried
+	authz := core.Authorization{
+		ID:             core.NewToken(),
+		RegistrationID: 1,
+		Identifier:     core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "servfail.letsencrypt.org"},
+		Challenges:     []core.Challenge{chall},
+	}
+	va.validate(authz, 0)
+	test.AssertEquals(t, dns.txtLookups, 3)
+	test.AssertEquals(t, mockRA.lastAuthz.Challenges[0].Status, core.StatusInvalid)
+	test.AssertEquals(t, mockRA.lastAuthz.Challenges[0].Error.Type, core.DNSProblem)
+
+	// The wrong record won't change by asking again
+	dns.txtLookups = 0
+	authz.Identifier.Value = "wrong.test"
+	authz.Challenges = []core.Challenge{chall}
+	va.validate(authz, 0)
+	test.AssertEquals(t, dns.txtLookups, 1)
+	test.AssertEquals(t, mockRA.lastAuthz.Challenges[0].Status, core.StatusInvalid)
+
+	// Nor will a name that doesn't exist, or one that only resolves to
+	// addresses we won't connect to
+	va.TestMode = false
+	http01 := core.HTTP01Challenge()
+	http01.KeyAuthorization = http01.Token + ".9jg46WB3rR_AHD-EBXdN7cBkH1WOu0tA3M9fm21mqTI"
+	for _, name := range []string{"nxdomain.letsencrypt.org", "blocked.letsencrypt.org"} {
+		dns.hostLookups = 0
+		authz.Identifier.Value = name
+		authz.Challenges = []core.Challenge{http01}
+		va.validate(authz, 0)
+		test.AssertEquals(t, dns.hostLookups, 1)
+		test.AssertEquals(t, mockRA.lastAuthz.Challenges[0].Status, core.StatusInvalid)
+	}
+	test.AssertEquals(t, mockRA.lastAuthz.Challenges[0].Error.Type, core.ConnectionProblem)
+}
+
+func TestValidationTimeouts(t *testing.T) {
+	va := NewValidationAuthorityImpl(true)
+	test.AssertEquals(t, va.timeout(core.ChallengeTypeHTTP01), validationTimeout)
+
+	va.Validation.Timeouts = map[string]core.ConfigDuration{
+		core.ChallengeTypeHTTP01: core.ConfigDuration{Duration: time.Second},
+	}
+	test.AssertEquals(t, va.timeout(core.ChallengeTypeHTTP01), time.Second)
+	test.AssertEquals(t, va.timeout(core.ChallengeTypeTLSALPN01), validationTimeout)
+
+	// The configured timeout covers the whole request, even when it's longer
+	// than the default
+	va.DNSResolver = &mocks.MockDNS{}
+	va.Validation.Timeouts[core.ChallengeTypeHTTP01] = core.ConfigDuration{Duration: validationTimeout + 5*time.Second}
+	keyAuthz := "THETOKEN.THETHUMBPRINT"
+	stopChan := make(chan bool, 1)
+	waitChan := make(chan bool, 1)
+	go http01Srv(t, keyAuthz, stopChan, waitChan)
+	defer func() {
+		stopChan <- true
+		<-waitChan
+	}()
+	<-waitChan
+
+	chall := core.Challenge{Type: core.ChallengeTypeHTTP01, Token: pathSlow, KeyAuthorization: keyAuthz}
+	finChall, err := va.validateHTTP01(ident, chall)
+	test.AssertNotError(t, err, "Slow response wasn't waited for")
+	test.AssertEquals(t, finChall.Status, core.StatusValid)
+}
+
+func TestValidationWorkers(t *testing.T) {
+	va := NewValidationAuthorityImpl(true)
+	va.DNSResolver = &mocks.MockDNS{}
+	mockRA := &MockRegistrationAuthority{updates: make(chan core.Authorization, 1)}
+	va.RA = mockRA
+	va.Validation.MaxConcurrent = 1
+	va.Validation.MaxQueued = 1
+	va.Start()
+
+	chall := core.DNSChallenge()
+	chall.Token = mocks.DNSChallengeToken
+	chall.KeyAuthorization = mocks.DNSChallengeKeyAuthorization
+	authz := core.Authorization{
+		ID:             core.NewToken(),
+		RegistrationID: 1,
+		Identifier:     core.AcmeIdentifier{Type: core.IdentifierDNS, Value: "good.test"},
+		Challenges:     []core.Challenge{chall},
+	}
+	err := va.UpdateValidations(authz, 0)
+	test.AssertNotError(t, err, "Couldn't queue validation")
+	select {
+	case updated := <-mockRA.updates:
+		test.AssertEquals(t, updated.Challenges[0].Status, core.StatusValid)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Queued validation never happened")
+	}
+
+	// Without workers taking validations off the queue it fills up
+	va.queue = make(chan validationRequest, 1)
+	err = va.UpdateValidations(authz, 0)
+	test.AssertNotError(t, err, "Couldn't queue validation")
+	err = va.UpdateValidations(authz, 0)
+	_, ok := err.(core.InternalServerError)
+	test.Assert(t, ok, "Queued a validation beyond the limit")
+}
+
 type MockRegistrationAuthority struct {
 	lastAuthz *core.Authorization
+
+	// If set, every update is sent here as well
+	updates chan core.Authorization
 }
 
 func (ra *MockRegistrationAuthority) NewRegistration(reg core.Registration) (core.Registration, error) {
@@ -398,15 +1063,38 @@ func (ra *MockRegistrationAuthority) UpdateRegistration(reg core.Registration, u
 	return reg, nil
 }
 
+func (ra *MockRegistrationAuthority) UpdateRegistrationKey(reg core.Registration, newKey jose.JsonWebKey) (core.Registration, error) {
+	return reg, nil
+}
+
+func (ra *MockRegistrationAuthority) DeactivateAuthorization(authz core.Authorization) (core.Authorization, error) {
+	return authz, nil
+}
+
+func (ra *MockRegistrationAuthority) DeactivateRegistration(reg core.Registration) (core.Registration, error) {
+	return reg, nil
+}
+
 func (ra *MockRegistrationAuthority) UpdateAuthorization(authz core.Authorization, foo int, challenge core.Challenge) (core.Authorization, error) {
 	return authz, nil
 }
 
-func (ra *MockRegistrationAuthority) RevokeCertificate(cert x509.Certificate) error {
+func (ra *MockRegistrationAuthority) RevokeCertificate(cert x509.Certificate, reasonCode int) error {
 	return nil
 }
 
+func (ra *MockRegistrationAuthority) NewOrder(order core.Order, regID int64) (core.Order, error) {
+	return order, nil
+}
+
+func (ra *MockRegistrationAuthority) FinalizeOrder(order core.Order, csr x509.CertificateRequest) (core.Order, error) {
+	return order, nil
+}
+
 func (ra *MockRegistrationAuthority) OnValidationUpdate(authz core.Authorization) error {
 	ra.lastAuthz = &authz
+	if ra.updates != nil {
+		ra.updates <- authz
+	}
 	return nil
 }
@@ -0,0 +1,113 @@
+// Copyright 2015 ISRG.  All rights reserved
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package va
+
+import (
+	"time"
+
+	"github.com/letsencrypt/boulder/core"
+)
+
+// Used when ValidationConfig leaves the limits out
+const (
+	defaultMaxConcurrentValidations = 100
+	defaultMaxQueuedValidations     = 1000
+)
+
+// ValidationConfig controls how the VA schedules validations and where it
+// connects to for them.
+type ValidationConfig struct {
+	// How many validations to carry out at once, and how many more may wait
+	// for a worker before UpdateValidations refuses them
+	MaxConcurrent int
+	MaxQueued     int
+
+	// How many times to retry a validation that failed on a network error
+	// that might go away, and how long to wait before the first retry.  The
+	// wait doubles for each further retry.
+	MaxRetries   int
+	RetryBackoff core.ConfigDuration
+
+	// How long to wait for a subscriber's server to connect and respond, by
+	// challenge type
+	Timeouts map[string]core.ConfigDuration
+
+	// Where to connect to, by challenge type; anything left out gets the
+	// defaults for production or TestMode
+	Targets map[string]ValidationTarget
+
+	// Only in TestMode: addresses to connect to instead of looking names up,
+	// e.g. "127.0.0.1" or "127.0.0.1:5010" to use another port as well.
+	// Names left out are looked up as usual.
+	TestHostOverrides map[string]string
+}
+
+type validationRequest struct {
+	authz          core.Authorization
+	challengeIndex int
+	queued         time.Time
+}
+
+// timeout returns how long to wait for a subscriber's server when validating
+// a challenge of type challengeType.
+func (va ValidationAuthorityImpl) timeout(challengeType string) time.Duration {
+	if timeout, ok := va.Validation.Timeouts[challengeType]; ok && timeout.Duration > 0 {
+		return timeout.Duration
+	}
+	return validationTimeout
+}
+
+// transient reports whether err is a network problem that might not happen
+// if the validation were tried again, and returns the error to record for it.
+func transient(err error) (error, bool) {
+	if tempErr, ok := err.(temporaryError); ok {
+		return tempErr.error, true
+	}
+	return err, false
+}
+
+// Start launches the workers that carry out validations queued by
+// UpdateValidations.  Until it's called each validation runs in a goroutine
+// of its own, without any limits.
+func (va *ValidationAuthorityImpl) Start() {
+	workers := va.Validation.MaxConcurrent
+	if workers <= 0 {
+		workers = defaultMaxConcurrentValidations
+	}
+	queued := va.Validation.MaxQueued
+	if queued <= 0 {
+		queued = defaultMaxQueuedValidations
+	}
+
+	va.queue = make(chan validationRequest, queued)
+	for i := 0; i < workers; i++ {
+		go va.worker()
+	}
+}
+
+func (va *ValidationAuthorityImpl) worker() {
+	for req := range va.queue {
+		va.Stats.Gauge("VA.Validations.QueueDepth", int64(len(va.queue)), 1.0)
+		va.Stats.TimingDuration("VA.Validations.QueueLatency", time.Since(req.queued), 1.0)
+		va.validate(req.authz, req.challengeIndex)
+	}
+}
+
+func (va ValidationAuthorityImpl) UpdateValidations(authz core.Authorization, challengeIndex int) error {
+	if va.queue == nil {
+		go va.validate(authz, challengeIndex)
+		return nil
+	}
+
+	select {
+	case va.queue <- validationRequest{authz: authz, challengeIndex: challengeIndex, queued: time.Now()}:
+		va.Stats.Gauge("VA.Validations.QueueDepth", int64(len(va.queue)), 1.0)
+		return nil
+	default:
+		va.Stats.Inc("VA.Validations.QueueFull", 1, 1.0)
+		return core.InternalServerError("Too many validations in progress, try again later")
+	}
+}
@@ -10,33 +10,41 @@ import (
 	"crypto/x509"
 	"database/sql"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"html/template"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/cactus/go-statsd-client/statsd"
 	jose "github.com/letsencrypt/boulder/Godeps/_workspace/src/github.com/square/go-jose"
 	"github.com/letsencrypt/boulder/core"
 	blog "github.com/letsencrypt/boulder/log"
+	"github.com/letsencrypt/boulder/nonce"
 )
 
 const (
 	NewRegPath     = "/acme/new-reg"
 	RegPath        = "/acme/reg/"
+	KeyChangePath  = "/acme/key-change"
 	NewAuthzPath   = "/acme/new-authz"
 	AuthzPath      = "/acme/authz/"
 	NewCertPath    = "/acme/new-cert"
 	CertPath       = "/acme/cert/"
+	NewOrderPath   = "/acme/new-order"
+	OrderPath      = "/acme/order/"
 	RevokeCertPath = "/acme/revoke-cert/"
 	TermsPath      = "/terms"
 	IssuerPath     = "/acme/issuer-cert"
 	BuildIDPath    = "/build"
+	DirectoryPath  = "/directory"
 )
 
 // WebFrontEndImpl represents a Boulder web service and its resources
@@ -46,6 +54,10 @@ type WebFrontEndImpl struct {
 	Stats statsd.Statter
 	log   *blog.AuditLogger
 
+	// Issues the anti-replay nonces sent in Replay-Nonce headers and checks
+	// the ones that come back in signed requests
+	nonceService *nonce.NonceService
+
 	// URL configuration parameters
 	BaseURL   string
 	NewReg    string
@@ -58,28 +70,155 @@ type WebFrontEndImpl struct {
 	// Issuer certificate (DER) for /acme/issuer-cert
 	IssuerCert []byte
 
+	// Any certificates (DER) above the issuer, in order, sent after it when a
+	// client asks for a PEM certificate chain
+	IssuerChain [][]byte
+
 	// URL to the current subscriber agreement (should contain some version identifier)
 	SubscriberAgreementURL string
+
+	// Proxies in front of the WFE whose X-Real-IP header is believed.  The
+	// header is ignored on requests from anywhere else, since clients could
+	// set it to whatever they like.
+	TrustedProxies []*net.IPNet
+
+	// The text of the current subscriber agreement, served at /terms
+	SubscriberAgreement []byte
+
+	// Domain names that CAA records may use to authorize this CA, advertised
+	// in the meta section of the directory
+	CAAIdentities []string
 }
 
+// Collections of a registration's resources, listed at RegPath + ID + "/" +
+// the collection name, a page at a time.
+const (
+	certificatesCollection   = "certificates"
+	authorizationsCollection = "authorizations"
+	collectionPageSize       = 100
+)
+
+// Representations of certificates that clients can ask for in the Accept
+// header of requests for certificate resources.
+const (
+	derCertContentType  = "application/pkix-cert"
+	pemCertContentType  = "application/x-pem-file"
+	pemChainContentType = "application/pem-certificate-chain"
+)
+
+// negotiateCertificateType picks the representation with the highest q-value
+// in the request's Accept header that we can provide, the first listed among
+// equals, defaulting to DER.  Types with a q-value of 0 are never picked.
+func negotiateCertificateType(request *http.Request) string {
+	best, bestQ := derCertContentType, 0.0
+	for _, accepted := range strings.Split(request.Header.Get("Accept"), ",") {
+		params := strings.Split(accepted, ";")
+		mediaType := strings.TrimSpace(params[0])
+		switch mediaType {
+		case derCertContentType, pemCertContentType, pemChainContentType:
+		default:
+			continue
+		}
+
+		q := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if !strings.HasPrefix(param, "q=") {
+				continue
+			}
+			var err error
+			if q, err = strconv.ParseFloat(param[len("q="):], 64); err != nil {
+				q = 0
+			}
+		}
+		if q > bestQ {
+			best, bestQ = mediaType, q
+		}
+	}
+	return best
+}
+
+// encodeCertificates renders the first of the given DER certificates in the
+// requested representation, or all of them when a PEM chain was requested.
+func encodeCertificates(contentType string, certs ...[]byte) []byte {
+	switch contentType {
+	case pemCertContentType:
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certs[0]})
+	case pemChainContentType:
+		var chain []byte
+		for _, cert := range certs {
+			chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert})...)
+		}
+		return chain
+	default:
+		return certs[0]
+	}
+}
+
+// The revocation reasons a subscriber may give.  The rest of
+// core.RevocationReasons are for the CA to use: a subscriber can't put a
+// certificate on hold or take it off a CRL, and doesn't know about CA
+// compromises or withdrawn privileges.
+var subscriberRevocationReasons = map[int]bool{
+	0: true, // unspecified
+	1: true, // keyCompromise
+	3: true, // affiliationChanged
+	4: true, // superseded
+	5: true, // cessationOfOperation
+}
+
+// statusTooManyRequests is the status code for a rate limited request
+// (RFC 6585); net/http has no constant for it.
+const statusTooManyRequests = 429
+
 func statusCodeFromError(err interface{}) int {
-	// Populate these as needed.  We probably should trim the error list in util.go
 	switch err.(type) {
-	case core.MalformedRequestError:
+	case core.MalformedRequestError, core.SyntaxError, core.SignatureValidationError,
+		core.BadNonceError, core.BadCSRError, core.InvalidEmailError:
+		return http.StatusBadRequest
+	case core.ConnectionError, core.DNSError, core.TLSError, core.UnknownHostError:
+		// A problem reaching the subscriber's server during validation
 		return http.StatusBadRequest
-	case core.UnauthorizedError:
+	case core.UnauthorizedError, core.AgreementRequiredError:
 		return http.StatusForbidden
+	case core.NotFoundError:
+		return http.StatusNotFound
+	case core.RateLimitedError:
+		return statusTooManyRequests
+	case core.NotSupportedError:
+		return http.StatusNotImplemented
 	default:
 		return http.StatusInternalServerError
 	}
 }
 
-// NewWebFrontEndImpl constructs a web service for Boulder
-func NewWebFrontEndImpl() WebFrontEndImpl {
+// NewWebFrontEndImpl constructs a web service for Boulder, whose nonces are
+// encrypted under nonceKey (see nonce.NewNonceService)
+func NewWebFrontEndImpl(nonceKey []byte) (WebFrontEndImpl, error) {
 	logger := blog.GetAuditLogger()
 	logger.Notice("Web Front End Starting")
+
+	nonceService, err := nonce.NewNonceService(nonceKey)
+	if err != nil {
+		return WebFrontEndImpl{}, err
+	}
+
 	return WebFrontEndImpl{
-		log: logger,
+		log:          logger,
+		nonceService: nonceService,
+	}, nil
+}
+
+// withNonce wraps a handler so that every response it sends, successful or
+// not, carries a fresh anti-replay nonce for the client's next POST.
+func (wfe *WebFrontEndImpl) withNonce(handler func(http.ResponseWriter, *http.Request)) func(http.ResponseWriter, *http.Request) {
+	return func(response http.ResponseWriter, request *http.Request) {
+		if nonce, err := wfe.nonceService.Nonce(); err == nil {
+			response.Header().Set("Replay-Nonce", nonce)
+		} else {
+			wfe.log.Warning(fmt.Sprintf("Could not generate nonce: %s", err))
+		}
+		handler(response, request)
 	}
 }
 
@@ -91,17 +230,21 @@ func (wfe *WebFrontEndImpl) HandlePaths() {
 	wfe.NewCert = wfe.BaseURL + NewCertPath
 	wfe.CertBase = wfe.BaseURL + CertPath
 
-	http.HandleFunc("/", wfe.Index)
-	http.HandleFunc(NewRegPath, wfe.NewRegistration)
-	http.HandleFunc(NewAuthzPath, wfe.NewAuthorization)
-	http.HandleFunc(NewCertPath, wfe.NewCertificate)
-	http.HandleFunc(RegPath, wfe.Registration)
-	http.HandleFunc(AuthzPath, wfe.Authorization)
-	http.HandleFunc(CertPath, wfe.Certificate)
-	http.HandleFunc(RevokeCertPath, wfe.RevokeCertificate)
-	http.HandleFunc(TermsPath, wfe.Terms)
-	http.HandleFunc(IssuerPath, wfe.Issuer)
-	http.HandleFunc(BuildIDPath, wfe.BuildID)
+	http.HandleFunc("/", wfe.withNonce(wfe.Index))
+	http.HandleFunc(DirectoryPath, wfe.withNonce(wfe.Directory))
+	http.HandleFunc(NewRegPath, wfe.withNonce(wfe.NewRegistration))
+	http.HandleFunc(NewAuthzPath, wfe.withNonce(wfe.NewAuthorization))
+	http.HandleFunc(NewCertPath, wfe.withNonce(wfe.NewCertificate))
+	http.HandleFunc(RegPath, wfe.withNonce(wfe.Registration))
+	http.HandleFunc(KeyChangePath, wfe.withNonce(wfe.KeyChange))
+	http.HandleFunc(AuthzPath, wfe.withNonce(wfe.Authorization))
+	http.HandleFunc(CertPath, wfe.withNonce(wfe.Certificate))
+	http.HandleFunc(NewOrderPath, wfe.withNonce(wfe.NewOrder))
+	http.HandleFunc(OrderPath, wfe.withNonce(wfe.Order))
+	http.HandleFunc(RevokeCertPath, wfe.withNonce(wfe.RevokeCertificate))
+	http.HandleFunc(TermsPath, wfe.withNonce(wfe.Terms))
+	http.HandleFunc(IssuerPath, wfe.withNonce(wfe.Issuer))
+	http.HandleFunc(BuildIDPath, wfe.withNonce(wfe.BuildID))
 }
 
 // Method implementations
@@ -120,6 +263,7 @@ func (wfe *WebFrontEndImpl) Index(response http.ResponseWriter, request *http.Re
     This is an <a href="https://github.com/letsencrypt/acme-spec/">ACME</a>
     Certificate Authority running <a href="https://github.com/letsencrypt/boulder">Boulder</a>,
     New registration is available at <a href="{{.NewReg}}">{{.NewReg}}</a>.
+    The list of available resources is at <a href="{{.BaseURL}}/directory">{{.BaseURL}}/directory</a>.
   </body>
 </html>
 `))
@@ -127,28 +271,104 @@ func (wfe *WebFrontEndImpl) Index(response http.ResponseWriter, request *http.Re
 	response.Header().Set("Content-Type", "text/html")
 }
 
+type directoryMeta struct {
+	TermsOfService string   `json:"terms-of-service,omitempty"`
+	CAAIdentities  []string `json:"caa-identities,omitempty"`
+}
+
+type directory struct {
+	NewReg     string        `json:"new-reg"`
+	NewAuthz   string        `json:"new-authz"`
+	NewCert    string        `json:"new-cert"`
+	NewOrder   string        `json:"new-order"`
+	RevokeCert string        `json:"revoke-cert"`
+	KeyChange  string        `json:"key-change"`
+	Terms      string        `json:"terms"`
+	IssuerCert string        `json:"issuer-cert"`
+	Meta       directoryMeta `json:"meta"`
+}
+
+// Directory lists the URLs of the ACME resources offered by this server, so
+// that clients only need to be configured with a single URL.
+func (wfe *WebFrontEndImpl) Directory(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		wfe.sendError(response, "Method not allowed", request.Method, http.StatusMethodNotAllowed)
+		return
+	}
+
+	dir := directory{
+		NewReg:     wfe.NewReg,
+		NewAuthz:   wfe.NewAuthz,
+		NewCert:    wfe.NewCert,
+		NewOrder:   wfe.BaseURL + NewOrderPath,
+		RevokeCert: wfe.BaseURL + RevokeCertPath,
+		KeyChange:  wfe.BaseURL + KeyChangePath,
+		Terms:      wfe.BaseURL + TermsPath,
+		IssuerCert: wfe.BaseURL + IssuerPath,
+		Meta: directoryMeta{
+			TermsOfService: wfe.SubscriberAgreementURL,
+			CAAIdentities:  wfe.CAAIdentities,
+		},
+	}
+	jsonReply, err := json.Marshal(dir)
+	if err != nil {
+		wfe.sendError(response, "Failed to marshal directory", err, http.StatusInternalServerError)
+		return
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(http.StatusOK)
+	if _, err = response.Write(jsonReply); err != nil {
+		wfe.log.Warning(fmt.Sprintf("Could not write response: %s", err))
+	}
+}
+
 // The ID is always the last slash-separated token in the path
 func parseIDFromPath(path string) string {
 	re := regexp.MustCompile("^.*/")
 	return re.ReplaceAllString(path, "")
 }
 
-// ProblemType objects represent problem documents, which are
-// returned with HTTP error responses
-// https://tools.ietf.org/html/draft-ietf-appsawg-http-problem-00
-type ProblemType string
+// protectedNonce extracts the anti-replay nonce from the protected header of
+// a JWS in either the compact or the JSON serialization. A nonce in the
+// unprotected header is ignored, since anybody replaying the request could
+// replace it.
+func protectedNonce(body string) (string, error) {
+	var protected64 string
+	if strings.HasPrefix(strings.TrimSpace(body), "{") {
+		var jws struct {
+			Protected  string `json:"protected"`
+			Signatures []struct {
+				Protected string `json:"protected"`
+			} `json:"signatures"`
+		}
+		if err := json.Unmarshal([]byte(body), &jws); err != nil {
+			return "", err
+		}
+		protected64 = jws.Protected
+		if len(jws.Signatures) == 1 {
+			protected64 = jws.Signatures[0].Protected
+		}
+	} else {
+		protected64 = strings.Split(body, ".")[0]
+	}
+	if len(protected64) == 0 {
+		return "", nil
+	}
 
-type problem struct {
-	Type   ProblemType `json:"type,omitempty"`
-	Detail string      `json:"detail,omitempty"`
+	protectedJSON, err := core.B64dec(protected64)
+	if err != nil {
+		return "", err
+	}
+	var header struct {
+		Nonce string `json:"nonce"`
+	}
+	if err = json.Unmarshal(protectedJSON, &header); err != nil {
+		return "", err
+	}
+	return header.Nonce, nil
 }
 
-const (
-	MalformedProblem      = ProblemType("urn:acme:error:malformed")
-	UnauthorizedProblem   = ProblemType("urn:acme:error:unauthorized")
-	ServerInternalProblem = ProblemType("urn:acme:error:serverInternal")
-)
-
 func (wfe *WebFrontEndImpl) verifyPOST(request *http.Request, regCheck bool) ([]byte, *jose.JsonWebKey, core.Registration, error) {
 	var reg core.Registration
 
@@ -191,12 +411,29 @@ func (wfe *WebFrontEndImpl) verifyPOST(request *http.Request, regCheck bool) ([]
 		return nil, nil, reg, err
 	}
 
+	// Check that the request carries a nonce that we issued and that has not
+	// been used before, so that captured requests cannot be replayed.
+	nonce, err := protectedNonce(string(body))
+	if err != nil {
+		wfe.log.Debug(fmt.Sprintf("Error reading JWS protected header: %v", err))
+		return nil, nil, reg, err
+	}
+	if len(nonce) == 0 {
+		return nil, nil, reg, core.BadNonceError("JWS has no anti-replay nonce")
+	}
+	if !wfe.nonceService.Valid(nonce) {
+		return nil, nil, reg, core.BadNonceError(fmt.Sprintf("JWS has invalid anti-replay nonce %s", nonce))
+	}
+
 	if regCheck {
 		// Check that the key is assosiated with an actual account
 		reg, err = wfe.SA.GetRegistrationByKey(*key)
 		if err != nil {
 			return nil, nil, reg, err
 		}
+		if reg.Status == core.StatusDeactivated || reg.Status == core.StatusRevoked {
+			return nil, nil, reg, core.UnauthorizedError(fmt.Sprintf("Registration has status %s", reg.Status))
+		}
 	}
 
 	return []byte(payload), key, reg, nil
@@ -204,20 +441,48 @@ func (wfe *WebFrontEndImpl) verifyPOST(request *http.Request, regCheck bool) ([]
 
 // Notify the client of an error condition and log it for audit purposes.
 func (wfe *WebFrontEndImpl) sendError(response http.ResponseWriter, details string, debug interface{}, code int) {
-	problem := problem{Detail: details}
+	problem := core.ProblemDetails{Detail: details}
 	switch code {
 	case http.StatusForbidden:
-		problem.Type = UnauthorizedProblem
+		problem.Type = core.UnauthorizedProblem
 	case http.StatusConflict:
 		fallthrough
 	case http.StatusMethodNotAllowed:
 		fallthrough
 	case http.StatusNotFound:
 		fallthrough
+	case http.StatusNotImplemented:
+		fallthrough
 	case http.StatusBadRequest:
-		problem.Type = MalformedProblem
+		problem.Type = core.MalformedProblem
+	case statusTooManyRequests:
+		problem.Type = core.RateLimitedProblem
 	case http.StatusInternalServerError:
-		problem.Type = ServerInternalProblem
+		problem.Type = core.ServerInternalProblem
+	}
+
+	// Errors that have a more specific problem type than their status code
+	// are reported with it, so that the client can tell what to fix (or, for
+	// a bad nonce, that it should retry with the nonce sent along with this
+	// response).
+	switch debug.(type) {
+	case core.BadNonceError, core.BadCSRError, core.RateLimitedError,
+		core.InvalidEmailError, core.ConnectionError, core.DNSError,
+		core.TLSError, core.UnknownHostError, core.AgreementRequiredError:
+		problem = *core.ProblemDetailsForError(debug.(error))
+	}
+
+	// Tell a rate-limited client when it may try again
+	if rateLimited, ok := debug.(core.RateLimitedError); ok {
+		if retryAt, ok := rateLimited.RetryAfter(); ok {
+			response.Header().Set("Retry-After", retryAt.Format(http.TimeFormat))
+		}
+	}
+
+	// Point a client that has to agree to the subscriber agreement (again)
+	// at the current version.
+	if problem.Type == core.AgreementRequiredProblem {
+		wfe.addTermsLink(response)
 	}
 
 	problemDoc, err := json.Marshal(problem)
@@ -229,7 +494,7 @@ func (wfe *WebFrontEndImpl) sendError(response http.ResponseWriter, details stri
 
 	// Only audit log internal errors so users cannot purposefully cause
 	// auditable events.
-	if problem.Type == ServerInternalProblem {
+	if problem.Type == core.ServerInternalProblem {
 		// AUDIT[ Error Conditions ] 9cc4d537-8534-4970-8665-4b382abe82f3
 		wfe.log.Audit(fmt.Sprintf("Internal error - %s - %s", details, debug))
 	}
@@ -245,6 +510,49 @@ func link(url, relation string) string {
 	return fmt.Sprintf("<%s>;rel=\"%s\"", url, relation)
 }
 
+// clientIP returns the address the request came from, preferring the
+// X-Real-IP header if the request came through one of the trusted proxies.
+// It returns nil if neither gives a usable address.
+func (wfe *WebFrontEndImpl) clientIP(request *http.Request) net.IP {
+	var remote net.IP
+	if host, _, err := net.SplitHostPort(request.RemoteAddr); err == nil {
+		remote = net.ParseIP(host)
+	}
+	if remote == nil {
+		return nil
+	}
+
+	for _, proxy := range wfe.TrustedProxies {
+		if proxy.Contains(remote) {
+			if ip := net.ParseIP(request.Header.Get("X-Real-IP")); ip != nil {
+				return ip
+			}
+			break
+		}
+	}
+	return remote
+}
+
+func (wfe *WebFrontEndImpl) addTermsLink(response http.ResponseWriter) {
+	if len(wfe.SubscriberAgreementURL) > 0 {
+		response.Header().Add("Link", link(wfe.SubscriberAgreementURL, "terms-of-service"))
+	}
+}
+
+// agreedToTerms checks that a registration has agreed to the current version
+// of the subscriber agreement.  If it hasn't, perhaps because the agreement
+// changed since it last agreed, agreedToTerms sends an error asking the client
+// to agree to the new version and returns false.
+func (wfe *WebFrontEndImpl) agreedToTerms(response http.ResponseWriter, reg core.Registration) bool {
+	if reg.Agreement == wfe.SubscriberAgreementURL {
+		return true
+	}
+	err := core.AgreementRequiredError(fmt.Sprintf(
+		"Must agree to the current subscriber agreement [%s] before any further actions", wfe.SubscriberAgreementURL))
+	wfe.sendError(response, err.Error(), err, http.StatusForbidden)
+	return false
+}
+
 func (wfe *WebFrontEndImpl) NewRegistration(response http.ResponseWriter, request *http.Request) {
 	if request.Method != "POST" {
 		wfe.sendError(response, "Method not allowed", "", http.StatusMethodNotAllowed)
@@ -273,6 +581,11 @@ func (wfe *WebFrontEndImpl) NewRegistration(response http.ResponseWriter, reques
 		return
 	}
 	init.Key = *key
+	init.InitialIP = wfe.clientIP(request)
+	if init.InitialIP == nil {
+		wfe.sendError(response, "Couldn't determine client IP address", request.RemoteAddr, http.StatusInternalServerError)
+		return
+	}
 
 	reg, err := wfe.RA.NewRegistration(init)
 	if err != nil {
@@ -293,9 +606,8 @@ func (wfe *WebFrontEndImpl) NewRegistration(response http.ResponseWriter, reques
 	response.Header().Add("Location", regURL)
 	response.Header().Set("Content-Type", "application/json")
 	response.Header().Add("Link", link(wfe.NewAuthz, "next"))
-	if len(wfe.SubscriberAgreementURL) > 0 {
-		response.Header().Add("Link", link(wfe.SubscriberAgreementURL, "terms-of-service"))
-	}
+	addCollectionLinks(response, regURL)
+	wfe.addTermsLink(response)
 
 	response.WriteHeader(http.StatusCreated)
 	response.Write(responseBody)
@@ -314,16 +626,14 @@ func (wfe *WebFrontEndImpl) NewAuthorization(response http.ResponseWriter, reque
 	if err != nil {
 		if err == sql.ErrNoRows {
 			wfe.sendError(response, "No registration exists matching provided key", err, http.StatusForbidden)
+		} else if _, ok := err.(core.UnauthorizedError); ok {
+			wfe.sendError(response, err.Error(), err, http.StatusForbidden)
 		} else {
 			wfe.sendError(response, "Unable to read/verify body", err, http.StatusBadRequest)
 		}
 		return
 	}
-	// Any version of the agreement is acceptable here. Version match is enforced in
-	// wfe.Registration when agreeing the first time. Agreement updates happen
-	// by mailing subscribers and don't require a registration update.
-	if currReg.Agreement == "" {
-		wfe.sendError(response, "Must agree to subscriber agreement before any further actions", nil, http.StatusForbidden)
+	if !wfe.agreedToTerms(response, currReg) {
 		return
 	}
 
@@ -361,6 +671,39 @@ func (wfe *WebFrontEndImpl) NewAuthorization(response http.ResponseWriter, reque
 	wfe.Stats.Inc("PendingAuthorizations", 1, 1.0)
 }
 
+// accountMayRevoke checks whether the registration with the given key may
+// revoke a certificate, either because the certificate was issued to it or
+// because it holds valid authorizations for every name in the certificate.
+func (wfe *WebFrontEndImpl) accountMayRevoke(key jose.JsonWebKey, serial string, cert *x509.Certificate) bool {
+	reg, err := wfe.SA.GetRegistrationByKey(key)
+	if err != nil || reg.Status == core.StatusDeactivated || reg.Status == core.StatusRevoked {
+		return false
+	}
+
+	if regID, err := wfe.SA.GetCertificateRegistrationID(serial); err == nil && regID == reg.ID {
+		return true
+	}
+
+	names := make([]string, len(cert.DNSNames))
+	copy(names, cert.DNSNames)
+	if len(cert.Subject.CommonName) > 0 {
+		names = append(names, cert.Subject.CommonName)
+	}
+	if len(names) == 0 {
+		return false
+	}
+	authzs, err := wfe.SA.GetValidAuthorizations(reg.ID, names, time.Now())
+	if err != nil {
+		return false
+	}
+	for _, name := range names {
+		if _, ok := authzs[strings.ToLower(name)]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
 func (wfe *WebFrontEndImpl) RevokeCertificate(response http.ResponseWriter, request *http.Request) {
 	if request.Method != "POST" {
 		wfe.sendError(response, "Method not allowed", request.Method, http.StatusMethodNotAllowed)
@@ -377,6 +720,7 @@ func (wfe *WebFrontEndImpl) RevokeCertificate(response http.ResponseWriter, requ
 
 	type RevokeRequest struct {
 		CertificateDER core.JsonBuffer `json:"certificate"`
+		Reason         int             `json:"reason"`
 	}
 	var revokeRequest RevokeRequest
 	if err = json.Unmarshal(body, &revokeRequest); err != nil {
@@ -384,6 +728,10 @@ func (wfe *WebFrontEndImpl) RevokeCertificate(response http.ResponseWriter, requ
 		wfe.sendError(response, "Unable to read/verify body", err, http.StatusBadRequest)
 		return
 	}
+	if !subscriberRevocationReasons[revokeRequest.Reason] {
+		wfe.sendError(response, "Invalid revocation reason code", revokeRequest.Reason, http.StatusBadRequest)
+		return
+	}
 	providedCert, err := x509.ParseCertificate(revokeRequest.CertificateDER)
 	if err != nil {
 		wfe.log.Debug("Couldn't parse cert in revoke request.")
@@ -414,18 +762,17 @@ func (wfe *WebFrontEndImpl) RevokeCertificate(response http.ResponseWriter, requ
 		return
 	}
 
-	// TODO: Implement other methods of validating revocation, e.g. through
-	// authorizations on account.
-	if !core.KeyDigestEquals(requestKey, parsedCertificate.PublicKey) {
+	if !core.KeyDigestEquals(requestKey, parsedCertificate.PublicKey) &&
+		!wfe.accountMayRevoke(*requestKey, serial, parsedCertificate) {
 		wfe.log.Debug("Key mismatch for revoke")
 		wfe.sendError(response,
-			"Revocation request must be signed by private key of cert to be revoked",
+			"Revocation request must be signed by private key of cert to be revoked, or by an account authorized for it",
 			requestKey,
 			http.StatusForbidden)
 		return
 	}
 
-	err = wfe.RA.RevokeCertificate(*parsedCertificate)
+	err = wfe.RA.RevokeCertificate(*parsedCertificate, revokeRequest.Reason)
 	if err != nil {
 		wfe.sendError(response, "Failed to revoke certificate", err, statusCodeFromError(err))
 	} else {
@@ -446,16 +793,14 @@ func (wfe *WebFrontEndImpl) NewCertificate(response http.ResponseWriter, request
 	if err != nil {
 		if err == sql.ErrNoRows {
 			wfe.sendError(response, "No registration exists matching provided key", err, http.StatusForbidden)
+		} else if _, ok := err.(core.UnauthorizedError); ok {
+			wfe.sendError(response, err.Error(), err, http.StatusForbidden)
 		} else {
 			wfe.sendError(response, "Unable to read/verify body", err, http.StatusBadRequest)
 		}
 		return
 	}
-	// Any version of the agreement is acceptable here. Version match is enforced in
-	// wfe.Registration when agreeing the first time. Agreement updates happen
-	// by mailing subscribers and don't require a registration update.
-	if reg.Agreement == "" {
-		wfe.sendError(response, "Must agree to subscriber agreement before any further actions", nil, http.StatusForbidden)
+	if !wfe.agreedToTerms(response, reg) {
 		return
 	}
 
@@ -507,6 +852,176 @@ func (wfe *WebFrontEndImpl) NewCertificate(response http.ResponseWriter, request
 	wfe.Stats.Inc("Certificates", 1, 1.0)
 }
 
+// The finalize resource of an order lives at OrderPath + ID + finalizeSuffix.
+const finalizeSuffix = "/finalize"
+
+// orderResponse is the representation of an order sent to clients, with the
+// order's authorizations, finalize resource and certificate given as URLs.
+type orderResponse struct {
+	Status         core.AcmeStatus       `json:"status"`
+	Expires        time.Time             `json:"expires"`
+	Identifiers    []core.AcmeIdentifier `json:"identifiers"`
+	Authorizations []string              `json:"authorizations"`
+	Finalize       string                `json:"finalize"`
+	Certificate    string                `json:"certificate,omitempty"`
+}
+
+func (wfe *WebFrontEndImpl) orderURL(order core.Order) string {
+	return wfe.BaseURL + OrderPath + order.ID
+}
+
+// writeOrder sends the client's view of an order with the given status code.
+func (wfe *WebFrontEndImpl) writeOrder(response http.ResponseWriter, order core.Order, code int) {
+	reply := orderResponse{
+		Status:      order.Status,
+		Expires:     order.Expires,
+		Identifiers: order.Identifiers,
+		Finalize:    wfe.orderURL(order) + finalizeSuffix,
+	}
+	for _, id := range order.Authorizations {
+		reply.Authorizations = append(reply.Authorizations, wfe.AuthzBase+id)
+	}
+	// Certificate URLs use only the sequential part of the serial number, as
+	// in NewCertificate.
+	if len(order.CertificateSerial) == 32 {
+		reply.Certificate = wfe.CertBase + order.CertificateSerial[:16]
+	}
+
+	jsonReply, err := json.Marshal(reply)
+	if err != nil {
+		wfe.sendError(response, "Failed to marshal order", err, http.StatusInternalServerError)
+		return
+	}
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(code)
+	if _, err = response.Write(jsonReply); err != nil {
+		wfe.log.Warning(fmt.Sprintf("Could not write response: %s", err))
+	}
+}
+
+func (wfe *WebFrontEndImpl) NewOrder(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "POST" {
+		wfe.sendError(response, "Method not allowed", request.Method, http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, _, currReg, err := wfe.verifyPOST(request, true)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			wfe.sendError(response, "No registration exists matching provided key", err, http.StatusForbidden)
+		} else if _, ok := err.(core.UnauthorizedError); ok {
+			wfe.sendError(response, err.Error(), err, http.StatusForbidden)
+		} else {
+			wfe.sendError(response, "Unable to read/verify body", err, http.StatusBadRequest)
+		}
+		return
+	}
+	if !wfe.agreedToTerms(response, currReg) {
+		return
+	}
+
+	var init struct {
+		Identifiers []core.AcmeIdentifier `json:"identifiers"`
+	}
+	if err = json.Unmarshal(body, &init); err != nil {
+		wfe.sendError(response, "Error unmarshaling JSON", err, http.StatusBadRequest)
+		return
+	}
+
+	order, err := wfe.RA.NewOrder(core.Order{Identifiers: init.Identifiers}, currReg.ID)
+	if err != nil {
+		wfe.sendError(response, "Error creating new order", err, statusCodeFromError(err))
+		return
+	}
+
+	response.Header().Add("Location", wfe.orderURL(order))
+	wfe.writeOrder(response, order, http.StatusCreated)
+
+	// incr order stat
+	wfe.Stats.Inc("Orders", 1, 1.0)
+}
+
+// Order serves an order to anybody who asks for it, and finalizes it when its
+// owner posts a CSR to the order's finalize resource.
+func (wfe *WebFrontEndImpl) Order(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" && request.Method != "POST" {
+		wfe.sendError(response, "Method not allowed", request.Method, http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.TrimPrefix(request.URL.Path, OrderPath)
+	finalize := strings.HasSuffix(id, finalizeSuffix)
+	id = strings.TrimSuffix(id, finalizeSuffix)
+	if len(id) == 0 || strings.Contains(id, "/") {
+		wfe.sendError(response, "Not found", request.URL.Path, http.StatusNotFound)
+		return
+	}
+
+	order, err := wfe.SA.GetOrder(id)
+	if err != nil {
+		wfe.sendError(response, "Unable to find order", err, http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case request.Method == "GET" && !finalize:
+		wfe.writeOrder(response, order, http.StatusOK)
+
+	case request.Method == "POST" && finalize:
+		body, _, currReg, err := wfe.verifyPOST(request, true)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				wfe.sendError(response, "No registration exists matching provided key", err, http.StatusForbidden)
+			} else if _, ok := err.(core.UnauthorizedError); ok {
+				wfe.sendError(response, err.Error(), err, http.StatusForbidden)
+			} else {
+				wfe.sendError(response, "Unable to read/verify body", err, http.StatusBadRequest)
+			}
+			return
+		}
+
+		if order.RegistrationID != currReg.ID {
+			wfe.sendError(response, "User registration ID doesn't match registration ID in order",
+				fmt.Sprintf("User: %v != Order: %v", currReg.ID, order.RegistrationID),
+				http.StatusForbidden)
+			return
+		}
+		if !wfe.agreedToTerms(response, currReg) {
+			return
+		}
+
+		var finalizeRequest struct {
+			CSR core.JsonBuffer `json:"csr"`
+		}
+		if err = json.Unmarshal(body, &finalizeRequest); err != nil {
+			wfe.sendError(response, "Error unmarshaling finalize request", err, http.StatusBadRequest)
+			return
+		}
+		csr, err := x509.ParseCertificateRequest(finalizeRequest.CSR)
+		if err != nil {
+			err = core.BadCSRError(fmt.Sprintf("Error parsing CSR: %s", err))
+			wfe.sendError(response, "Error parsing CSR", err, http.StatusBadRequest)
+			return
+		}
+
+		wfe.log.Notice(fmt.Sprintf("Client requested finalization of order %s: %v", order.ID, request.RemoteAddr))
+
+		finalized, err := wfe.RA.FinalizeOrder(order, *csr)
+		if err != nil {
+			wfe.sendError(response, "Error finalizing order", err, statusCodeFromError(err))
+			return
+		}
+
+		wfe.writeOrder(response, finalized, http.StatusOK)
+
+		// incr cert stat
+		wfe.Stats.Inc("Certificates", 1, 1.0)
+
+	default:
+		wfe.sendError(response, "Method not allowed", request.Method, http.StatusMethodNotAllowed)
+	}
+}
+
 func (wfe *WebFrontEndImpl) Challenge(authz core.Authorization, response http.ResponseWriter, request *http.Request) {
 	if request.Method != "GET" && request.Method != "POST" {
 		wfe.sendError(response, "Method not allowed", request.Method, http.StatusMethodNotAllowed)
@@ -558,16 +1073,14 @@ func (wfe *WebFrontEndImpl) Challenge(authz core.Authorization, response http.Re
 		if err != nil {
 			if err == sql.ErrNoRows {
 				wfe.sendError(response, "No registration exists matching provided key", err, http.StatusForbidden)
+			} else if _, ok := err.(core.UnauthorizedError); ok {
+				wfe.sendError(response, err.Error(), err, http.StatusForbidden)
 			} else {
 				wfe.sendError(response, "Unable to read/verify body", err, http.StatusBadRequest)
 			}
 			return
 		}
-		// Any version of the agreement is acceptable here. Version match is enforced in
-		// wfe.Registration when agreeing the first time. Agreement updates happen
-		// by mailing subscribers and don't require a registration update.
-		if currReg.Agreement == "" {
-			wfe.sendError(response, "Must agree to subscriber agreement before any further actions", nil, http.StatusForbidden)
+		if !wfe.agreedToTerms(response, currReg) {
 			return
 		}
 
@@ -626,6 +1139,8 @@ func (wfe *WebFrontEndImpl) Registration(response http.ResponseWriter, request *
 			wfe.sendError(response,
 				"No registration exists matching provided key",
 				err, http.StatusForbidden)
+		} else if _, ok := err.(core.UnauthorizedError); ok {
+			wfe.sendError(response, err.Error(), err, http.StatusForbidden)
 		} else {
 			wfe.sendError(response,
 				"Unable to read/verify body", err, http.StatusBadRequest)
@@ -634,8 +1149,16 @@ func (wfe *WebFrontEndImpl) Registration(response http.ResponseWriter, request *
 	}
 
 	// Requests to this handler should have a path that leads to a known
-	// registration
-	idStr := parseIDFromPath(request.URL.Path)
+	// registration, or to one of its collections
+	path := request.URL.Path
+	var collection string
+	for _, c := range []string{certificatesCollection, authorizationsCollection} {
+		if strings.HasSuffix(path, "/"+c) {
+			collection = c
+			path = strings.TrimSuffix(path, "/"+c)
+		}
+	}
+	idStr := parseIDFromPath(path)
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
 		wfe.sendError(response, "Registration ID must be an integer", err, http.StatusBadRequest)
@@ -648,6 +1171,11 @@ func (wfe *WebFrontEndImpl) Registration(response http.ResponseWriter, request *
 		return
 	}
 
+	if len(collection) > 0 {
+		wfe.registrationCollection(response, request, currReg, collection)
+		return
+	}
+
 	var update core.Registration
 	err = json.Unmarshal(body, &update)
 	if err != nil {
@@ -662,17 +1190,33 @@ func (wfe *WebFrontEndImpl) Registration(response http.ResponseWriter, request *
 		return
 	}
 
-	// Registration objects contain a JWK object, which must be non-nil. We know
-	// the key of the updated registration object is going to be the same as the
-	// key of the current one, so we set it here. This ensures we can cleanly
-	// serialize the update as JSON to send via AMQP to the RA.
-	update.Key = currReg.Key
+	var updatedReg core.Registration
+	if len(update.Status) > 0 && update.Status != currReg.Status {
+		// The only status change a subscriber can make is to deactivate their
+		// own registration, which can't be undone.
+		if update.Status != core.StatusDeactivated {
+			wfe.sendError(response, "Invalid value provided for status field", update.Status, http.StatusBadRequest)
+			return
+		}
 
-	// Ask the RA to update this authorization.
-	updatedReg, err := wfe.RA.UpdateRegistration(currReg, update)
-	if err != nil {
-		wfe.sendError(response, "Unable to update registration", err, statusCodeFromError(err))
-		return
+		updatedReg, err = wfe.RA.DeactivateRegistration(currReg)
+		if err != nil {
+			wfe.sendError(response, "Unable to deactivate registration", err, statusCodeFromError(err))
+			return
+		}
+	} else {
+		// Registration objects contain a JWK object, which must be non-nil. We know
+		// the key of the updated registration object is going to be the same as the
+		// key of the current one, so we set it here. This ensures we can cleanly
+		// serialize the update as JSON to send via AMQP to the RA.
+		update.Key = currReg.Key
+
+		// Ask the RA to update this authorization.
+		updatedReg, err = wfe.RA.UpdateRegistration(currReg, update)
+		if err != nil {
+			wfe.sendError(response, "Unable to update registration", err, statusCodeFromError(err))
+			return
+		}
 	}
 
 	jsonReply, err := json.Marshal(updatedReg)
@@ -681,10 +1225,169 @@ func (wfe *WebFrontEndImpl) Registration(response http.ResponseWriter, request *
 		return
 	}
 	response.Header().Set("Content-Type", "application/json")
+	addCollectionLinks(response, fmt.Sprintf("%s%d", wfe.RegBase, id))
+	wfe.addTermsLink(response)
 	response.WriteHeader(http.StatusAccepted)
 	response.Write(jsonReply)
 }
 
+// addCollectionLinks points clients at the collections of the registration
+// at regURL.
+func addCollectionLinks(response http.ResponseWriter, regURL string) {
+	response.Header().Add("Link", link(regURL+"/"+authorizationsCollection, authorizationsCollection))
+	response.Header().Add("Link", link(regURL+"/"+certificatesCollection, certificatesCollection))
+}
+
+// registrationCollection lists a page of the certificates or authorizations
+// that belong to a registration. The "cursor" query parameter continues from
+// an earlier page, and "status" and "expires-after" (RFC 3339) narrow down the
+// results. When the page is full, a Link with relation "next" leads on to the
+// following one.
+func (wfe *WebFrontEndImpl) registrationCollection(response http.ResponseWriter, request *http.Request, reg core.Registration, collection string) {
+	params := request.URL.Query()
+	q := core.CollectionQuery{
+		RegistrationID: reg.ID,
+		Cursor:         params.Get("cursor"),
+		Limit:          collectionPageSize,
+		Status:         params.Get("status"),
+	}
+	if expiresAfter := params.Get("expires-after"); len(expiresAfter) > 0 {
+		t, err := time.Parse(time.RFC3339, expiresAfter)
+		if err != nil {
+			wfe.sendError(response, "Invalid expires-after time", err, http.StatusBadRequest)
+			return
+		}
+		q.ExpiresAfter = t
+	}
+
+	var ids []string
+	var err error
+	urls := []string{}
+	switch collection {
+	case certificatesCollection:
+		ids, err = wfe.SA.GetCertificateSerialsByRegistration(q)
+		for _, serial := range ids {
+			// Certificate URLs are keyed on the sequential half of the serial
+			urls = append(urls, wfe.CertBase+serial[:16])
+		}
+	case authorizationsCollection:
+		ids, err = wfe.SA.GetAuthorizationIDsByRegistration(q)
+		for _, id := range ids {
+			urls = append(urls, wfe.AuthzBase+id)
+		}
+	}
+	if err != nil {
+		wfe.sendError(response, "Unable to list "+collection, err, http.StatusInternalServerError)
+		return
+	}
+
+	jsonReply, err := json.Marshal(map[string][]string{collection: urls})
+	if err != nil {
+		wfe.sendError(response, "Failed to marshal "+collection, err, http.StatusInternalServerError)
+		return
+	}
+
+	// Use an explicitly typed variable. Otherwise `go vet' incorrectly complains
+	// that reg.ID is a string being passed to %d.
+	var id int64 = reg.ID
+	if len(ids) == collectionPageSize {
+		params.Set("cursor", ids[len(ids)-1])
+		next := fmt.Sprintf("%s%d/%s?%s", wfe.RegBase, id, collection, params.Encode())
+		response.Header().Add("Link", link(next, "next"))
+	}
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(http.StatusOK)
+	if _, err = response.Write(jsonReply); err != nil {
+		wfe.log.Warning(fmt.Sprintf("Could not write response: %s", err))
+	}
+}
+
+// KeyChange moves the registration whose key signed the request over to a new
+// key. The payload of the request is itself a JWS signed by the new key, which
+// names the registration and the old key so that it can't be used to move any
+// other registration.
+func (wfe *WebFrontEndImpl) KeyChange(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "POST" {
+		wfe.sendError(response, "Method not allowed", request.Method, http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, oldKey, currReg, err := wfe.verifyPOST(request, true)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			wfe.sendError(response, "No registration exists matching provided key", err, http.StatusForbidden)
+		} else if _, ok := err.(core.UnauthorizedError); ok {
+			wfe.sendError(response, err.Error(), err, http.StatusForbidden)
+		} else {
+			wfe.sendError(response, "Unable to read/verify body", err, http.StatusBadRequest)
+		}
+		return
+	}
+
+	innerJws, err := jose.ParseSigned(string(body))
+	if err != nil {
+		wfe.sendError(response, "Key change request must be a JWS signed by the new key", err, http.StatusBadRequest)
+		return
+	}
+	if len(innerJws.Signatures) != 1 || innerJws.Signatures[0].Header.JsonWebKey == nil {
+		wfe.sendError(response, "Key change request must have exactly one signature, with a key", nil, http.StatusBadRequest)
+		return
+	}
+	newKey := innerJws.Signatures[0].Header.JsonWebKey
+	innerPayload, err := innerJws.Verify(newKey)
+	if err != nil {
+		wfe.sendError(response, "Key change request must be signed by the new key", err, http.StatusBadRequest)
+		return
+	}
+
+	var keyChange struct {
+		Account string          `json:"account"`
+		OldKey  jose.JsonWebKey `json:"oldKey"`
+	}
+	if err = json.Unmarshal(innerPayload, &keyChange); err != nil {
+		wfe.sendError(response, "Error unmarshaling key change request", err, http.StatusBadRequest)
+		return
+	}
+
+	// Use an explicitly typed variable. Otherwise `go vet' incorrectly complains
+	// that reg.ID is a string being passed to %d.
+	var id int64 = currReg.ID
+	regURL := fmt.Sprintf("%s%d", wfe.RegBase, id)
+	if keyChange.Account != regURL {
+		wfe.sendError(response, "Key change request is for a different registration",
+			fmt.Sprintf("Requested: %s != Signer: %s", keyChange.Account, regURL),
+			http.StatusForbidden)
+		return
+	}
+	if !core.KeyDigestEquals(keyChange.OldKey, oldKey) {
+		wfe.sendError(response, "Key change request does not name the key it was signed with", nil, http.StatusForbidden)
+		return
+	}
+	if core.KeyDigestEquals(newKey, oldKey) {
+		wfe.sendError(response, "New key is the same as the old key", nil, http.StatusBadRequest)
+		return
+	}
+
+	updatedReg, err := wfe.RA.UpdateRegistrationKey(currReg, *newKey)
+	if err != nil {
+		wfe.sendError(response, "Unable to change registration key", err, statusCodeFromError(err))
+		return
+	}
+
+	jsonReply, err := json.Marshal(updatedReg)
+	if err != nil {
+		wfe.sendError(response, "Failed to marshal registration", err, http.StatusInternalServerError)
+		return
+	}
+	response.Header().Set("Content-Type", "application/json")
+	response.Header().Add("Location", regURL)
+	addCollectionLinks(response, regURL)
+	response.WriteHeader(http.StatusOK)
+	if _, err = response.Write(jsonReply); err != nil {
+		wfe.log.Warning(fmt.Sprintf("Could not write response: %s", err))
+	}
+}
+
 func (wfe *WebFrontEndImpl) Authorization(response http.ResponseWriter, request *http.Request) {
 	if request.Method != "GET" && request.Method != "POST" {
 		wfe.sendError(response, "Method not allowed", request.Method, http.StatusMethodNotAllowed)
@@ -712,6 +1415,61 @@ func (wfe *WebFrontEndImpl) Authorization(response http.ResponseWriter, request
 		wfe.sendError(response, "Method not allowed", request.Method, http.StatusMethodNotAllowed)
 		return
 
+	case "POST":
+		body, _, currReg, err := wfe.verifyPOST(request, true)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				wfe.sendError(response, "No registration exists matching provided key", err, http.StatusForbidden)
+			} else if _, ok := err.(core.UnauthorizedError); ok {
+				wfe.sendError(response, err.Error(), err, http.StatusForbidden)
+			} else {
+				wfe.sendError(response, "Unable to read/verify body", err, http.StatusBadRequest)
+			}
+			return
+		}
+
+		if authz.RegistrationID != currReg.ID {
+			wfe.sendError(response, "User registration ID doesn't match registration ID in authorization",
+				fmt.Sprintf("User: %v != Authorization: %v", currReg.ID, authz.RegistrationID),
+				http.StatusForbidden)
+			return
+		}
+
+		// The only change a subscriber can make to an authorization directly is
+		// to deactivate it, e.g. because they no longer control the domain.
+		var update struct {
+			Status core.AcmeStatus `json:"status"`
+		}
+		if err = json.Unmarshal(body, &update); err != nil {
+			wfe.sendError(response, "Error unmarshaling authorization", err, http.StatusBadRequest)
+			return
+		}
+		if update.Status != core.StatusDeactivated {
+			wfe.sendError(response, "Invalid value provided for status field", update.Status, http.StatusBadRequest)
+			return
+		}
+
+		updatedAuthz, err := wfe.RA.DeactivateAuthorization(authz)
+		if err != nil {
+			wfe.sendError(response, "Unable to deactivate authorization", err, statusCodeFromError(err))
+			return
+		}
+
+		// Blank out ID and regID
+		updatedAuthz.ID = ""
+		updatedAuthz.RegistrationID = 0
+
+		jsonReply, err := json.Marshal(updatedAuthz)
+		if err != nil {
+			wfe.sendError(response, "Failed to marshal authz", err, http.StatusInternalServerError)
+			return
+		}
+		response.Header().Set("Content-Type", "application/json")
+		response.WriteHeader(http.StatusOK)
+		if _, err = response.Write(jsonReply); err != nil {
+			wfe.log.Warning(fmt.Sprintf("Could not write response: %s", err))
+		}
+
 	case "GET":
 		// Blank out ID and regID
 		authz.ID = ""
@@ -769,11 +1527,12 @@ func (wfe *WebFrontEndImpl) Certificate(response http.ResponseWriter, request *h
 			return
 		}
 
-		// TODO Content negotiation
-		response.Header().Set("Content-Type", "application/pkix-cert")
+		contentType := negotiateCertificateType(request)
+		certs := append([][]byte{cert, wfe.IssuerCert}, wfe.IssuerChain...)
+		response.Header().Set("Content-Type", contentType)
 		response.Header().Add("Link", link(IssuerPath, "up"))
 		response.WriteHeader(http.StatusOK)
-		if _, err = response.Write(cert); err != nil {
+		if _, err = response.Write(encodeCertificates(contentType, certs...)); err != nil {
 			wfe.log.Warning(fmt.Sprintf("Could not write response: %s", err))
 		}
 	}
@@ -785,7 +1544,23 @@ func (wfe *WebFrontEndImpl) Terms(response http.ResponseWriter, request *http.Re
 		return
 	}
 
-	fmt.Fprintf(response, "TODO: Add terms of use here")
+	// Without a copy of the agreement to serve, send clients to wherever the
+	// current version lives.
+	if len(wfe.SubscriberAgreement) == 0 {
+		if len(wfe.SubscriberAgreementURL) == 0 {
+			wfe.sendError(response, "No subscriber agreement", "", http.StatusNotFound)
+			return
+		}
+		http.Redirect(response, request, wfe.SubscriberAgreementURL, http.StatusFound)
+		return
+	}
+
+	response.Header().Set("Content-Type", http.DetectContentType(wfe.SubscriberAgreement))
+	wfe.addTermsLink(response)
+	response.WriteHeader(http.StatusOK)
+	if _, err := response.Write(wfe.SubscriberAgreement); err != nil {
+		wfe.log.Warning(fmt.Sprintf("Could not write response: %s", err))
+	}
 }
 
 func (wfe *WebFrontEndImpl) Issuer(response http.ResponseWriter, request *http.Request) {
@@ -794,10 +1569,11 @@ func (wfe *WebFrontEndImpl) Issuer(response http.ResponseWriter, request *http.R
 		return
 	}
 
-	// TODO Content negotiation
-	response.Header().Set("Content-Type", "application/pkix-cert")
+	contentType := negotiateCertificateType(request)
+	certs := append([][]byte{wfe.IssuerCert}, wfe.IssuerChain...)
+	response.Header().Set("Content-Type", contentType)
 	response.WriteHeader(http.StatusOK)
-	if _, err := response.Write(wfe.IssuerCert); err != nil {
+	if _, err := response.Write(encodeCertificates(contentType, certs...)); err != nil {
 		wfe.log.Warning(fmt.Sprintf("Could not write response: %s", err))
 	}
 }